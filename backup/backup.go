@@ -0,0 +1,261 @@
+// Package backup sends incremental backups of a subvolume.
+//
+// Every run takes a read only snapshot of the source subvolume, looks for the newest older
+// snapshot the destination already has and sends the new snapshot incrementally against it,
+// or in full if there is none. The snapshots stay next to the source and are the parents of
+// the next runs, the destination records what it has received.
+package backup
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	_ "github.com/plar/btrfs/receive"
+	_ "github.com/plar/btrfs/send"
+	_ "github.com/plar/btrfs/subvolume"
+	"github.com/satori/go.uuid"
+)
+
+// nameFormat is the time format of the snapshot names
+const nameFormat = "20060102T150405Z"
+
+// Snapshot is a read only snapshot of the source subvolume
+type Snapshot struct {
+	Name string
+	Path string
+	UUID uuid.UUID
+	// Generation is the transaction the snapshot was created in
+	Generation uint64
+}
+
+// Result describes a backup run
+type Result struct {
+	Snapshot Snapshot
+	// Parent is the snapshot the stream is incremental against, nil for a full backup
+	Parent *Snapshot
+	// Size is the size of the sent stream in bytes
+	Size int64
+}
+
+type Backup struct {
+	api       btrfs.API
+	source    string
+	snapshots string
+	dest      Destination
+	prefix    string
+	now       func() time.Time
+}
+
+// New creates a backup of the source subvolume, the snapshots are created in the snapshots directory
+// which must be on the same filesystem
+func New(source, snapshots string, dest Destination) *Backup {
+	return &Backup{
+		api:       btrfs.NewIoctl(),
+		source:    source,
+		snapshots: snapshots,
+		dest:      dest,
+		prefix:    filepath.Base(source),
+		now:       time.Now,
+	}
+}
+
+// Prefix sets the prefix of the snapshot names, the name of the source is used by default
+func (b *Backup) Prefix(prefix string) *Backup {
+	b.prefix = prefix
+	return b
+}
+
+func (b *Backup) validate() error {
+	if len(b.source) == 0 {
+		return fmt.Errorf("source is empty")
+	}
+	if len(b.snapshots) == 0 {
+		return fmt.Errorf("snapshot directory is empty")
+	}
+	if b.dest == nil {
+		return fmt.Errorf("destination is not set")
+	}
+	if ok, err := ioctl.TestIsSubvolume(b.source); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("'%s' is not a subvolume", b.source)
+	}
+	return nil
+}
+
+// Snapshots returns the read only snapshots of the source in the snapshot directory, the oldest first
+func (b *Backup) Snapshots() ([]Snapshot, error) {
+	subvols, err := b.api.Subvolume().List().Path(b.source).Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	sourceId, err := ioctl.GetRootId(b.source)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := map[uint64]btrfs.SubvolInfo{}
+	for _, s := range subvols {
+		byId[s.ID] = s
+	}
+	source, ok := byId[sourceId]
+	if !ok {
+		return nil, fmt.Errorf("subvolume '%s' not found", b.source)
+	}
+
+	entries, err := ioutil.ReadDir(b.snapshots)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		path := filepath.Join(b.snapshots, entry.Name())
+		if ok, err := ioctl.TestIsSubvolume(path); err != nil || !ok {
+			continue
+		}
+
+		id, err := ioctl.GetRootId(path)
+		if err != nil {
+			return nil, err
+		}
+
+		s, ok := byId[id]
+		if !ok || !s.IsReadOnly || !uuid.Equal(s.ParentUUID, source.UUID) {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Name: entry.Name(), Path: path, UUID: s.UUID, Generation: s.OriginGeneration})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Generation != snapshots[j].Generation {
+			return snapshots[i].Generation < snapshots[j].Generation
+		}
+		return snapshots[i].Name < snapshots[j].Name
+	})
+	return snapshots, nil
+}
+
+// name returns a free snapshot name for the current time
+func (b *Backup) name() string {
+	name := b.prefix + "." + b.now().UTC().Format(nameFormat)
+	candidate := name
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(filepath.Join(b.snapshots, candidate)); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// parent returns the newest snapshot the destination has
+func (b *Backup) parent(snapshots []Snapshot) (*Snapshot, error) {
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		ok, err := b.dest.Has(snapshots[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Run snapshots the source and sends the snapshot to the destination. The new snapshot is
+// deleted if the destination doesn't receive it.
+func (b *Backup) Run() (*Result, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := b.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := b.parent(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	name := b.name()
+	path := filepath.Join(b.snapshots, name)
+	err = b.api.Subvolume().Snapshot().ReadOnly().Source(b.source).Destination(path).Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := b.send(name, path, parent)
+	if err != nil {
+		if delErr := b.api.Subvolume().Delete().Destination(path).Execute(); delErr != nil {
+			return nil, fmt.Errorf("%v, failed to delete the snapshot '%s': %v", err, path, delErr)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *Backup) send(name, path string, parent *Snapshot) (*Result, error) {
+	snapshots, err := b.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot *Snapshot
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			snapshot = &snapshots[i]
+		}
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot '%s' not found", path)
+	}
+
+	r, w := io.Pipe()
+	counter := &countingWriter{w: w}
+
+	sent := make(chan error, 1)
+	go func() {
+		send := b.api.Send().Subvolume(path).Writer(counter)
+		if parent != nil {
+			send.Parent(parent.Path)
+		}
+		err := send.Execute()
+		w.CloseWithError(err)
+		sent <- err
+	}()
+
+	err = b.dest.Receive(*snapshot, parent, r)
+	// unblock the sender if the destination stopped reading
+	r.CloseWithError(fmt.Errorf("destination stopped reading"))
+	sendErr := <-sent
+
+	if sendErr != nil && err == nil {
+		err = sendErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Snapshot: *snapshot, Parent: parent, Size: counter.n}, nil
+}
@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	"github.com/plar/btrfs/sendstream"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+type failingDestination struct{}
+
+func (d *failingDestination) Has(snapshot Snapshot) (bool, error) {
+	return false, nil
+}
+
+func (d *failingDestination) Receive(snapshot Snapshot, parent *Snapshot, stream io.Reader) error {
+	return io.ErrShortWrite
+}
+
+func source(t *testing.T, name string) (string, string) {
+	src := filepath.Join(mount, name)
+	err := btrfs.NewIoctl().Subvolume().Create().Destination(src).Execute()
+	assert.NoError(t, err)
+
+	snapshots := filepath.Join(mount, name+"-snapshots")
+	assert.NoError(t, os.Mkdir(snapshots, 0700))
+	return src, snapshots
+}
+
+func clock(b *Backup) *Backup {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	}
+	return b
+}
+
+func TestBackupValidation(t *testing.T) {
+	_, err := New("", mount, NewFileDestination(mount)).Run()
+	assert.EqualError(t, err, "source is empty")
+
+	_, err = New(mount, "", NewFileDestination(mount)).Run()
+	assert.EqualError(t, err, "snapshot directory is empty")
+
+	_, err = New(mount, mount, nil).Run()
+	assert.EqualError(t, err, "destination is not set")
+
+	dir := filepath.Join(mount, "backup-dir")
+	assert.NoError(t, os.Mkdir(dir, 0700))
+	_, err = New(dir, mount, NewFileDestination(mount)).Run()
+	assert.Contains(t, err.Error(), "is not a subvolume")
+}
+
+func TestBackupFile(t *testing.T) {
+	src, snapshots := source(t, "backup-file")
+	dest := filepath.Join(loop.RootDir, "backup-files")
+	assert.NoError(t, os.Mkdir(dest, 0700))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "file1"), bytes.Repeat([]byte("backup"), 4096), 0600))
+
+	fileDest := NewFileDestination(dest)
+	b := clock(New(src, snapshots, fileDest))
+
+	full, err := b.Run()
+	assert.NoError(t, err)
+	assert.Nil(t, full.Parent)
+	assert.Equal(t, "backup-file.20260101T010000Z", full.Snapshot.Name)
+	assert.True(t, full.Size > 0)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "file2"), []byte("incremental"), 0600))
+
+	incremental, err := b.Run()
+	assert.NoError(t, err)
+	if assert.NotNil(t, incremental.Parent) {
+		assert.Equal(t, full.Snapshot.UUID, incremental.Parent.UUID)
+	}
+	assert.True(t, incremental.Size < full.Size)
+
+	streams, err := fileDest.Streams()
+	assert.NoError(t, err)
+	assert.Len(t, streams, 2)
+	assert.Nil(t, streams[0].ParentUUID)
+	if assert.NotNil(t, streams[1].ParentUUID) {
+		assert.Equal(t, full.Snapshot.UUID, *streams[1].ParentUUID)
+	}
+
+	// the second stream is a snapshot of the first one
+	f, err := os.Open(filepath.Join(dest, streams[1].File))
+	assert.NoError(t, err)
+	defer f.Close()
+	cmd, err := sendstream.NewDecoder(f).Next()
+	assert.NoError(t, err)
+	if snapshot, ok := cmd.(*sendstream.Snapshot); assert.True(t, ok) {
+		assert.Equal(t, full.Snapshot.UUID, snapshot.CloneUUID)
+	}
+
+	all, err := b.Snapshots()
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestBackupBtrfs(t *testing.T) {
+	src, snapshots := source(t, "backup-btrfs")
+	dest := filepath.Join(mount, "backup-received")
+	assert.NoError(t, os.Mkdir(dest, 0700))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "file1"), []byte("full"), 0600))
+
+	b := clock(New(src, snapshots, NewBtrfsDestination(dest)))
+
+	full, err := b.Run()
+	assert.NoError(t, err)
+	assert.Nil(t, full.Parent)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "file2"), []byte("incremental"), 0600))
+
+	incremental, err := b.Run()
+	assert.NoError(t, err)
+	if assert.NotNil(t, incremental.Parent) {
+		assert.Equal(t, full.Snapshot.UUID, incremental.Parent.UUID)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dest, incremental.Snapshot.Name, "file2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "incremental", string(data))
+
+	// without the newest received snapshot the next run is incremental against the older one
+	err = btrfs.NewIoctl().Subvolume().Delete().Destination(filepath.Join(dest, incremental.Snapshot.Name)).Execute()
+	assert.NoError(t, err)
+	ok, err := NewBtrfsDestination(dest).Has(incremental.Snapshot)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	next, err := b.Run()
+	assert.NoError(t, err)
+	if assert.NotNil(t, next.Parent) {
+		assert.Equal(t, full.Snapshot.UUID, next.Parent.UUID)
+	}
+}
+
+func TestBackupFailure(t *testing.T) {
+	src, snapshots := source(t, "backup-failure")
+
+	_, err := New(src, snapshots, &failingDestination{}).Run()
+	assert.Equal(t, io.ErrShortWrite, err)
+
+	// the snapshot of the failed run is deleted
+	entries, err := ioutil.ReadDir(snapshots)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/satori/go.uuid"
+)
+
+// Destination stores the send streams of the snapshots
+type Destination interface {
+	// Has reports whether the destination has received the snapshot, so it can be the parent of the next stream
+	Has(snapshot Snapshot) (bool, error)
+	// Receive reads the stream of the snapshot, it is incremental against parent if that is not nil
+	Receive(snapshot Snapshot, parent *Snapshot, stream io.Reader) error
+}
+
+// BtrfsDestination receives the streams into subvolumes of a local btrfs filesystem, the received
+// subvolumes carry the uuid of the sent snapshot as received uuid
+type BtrfsDestination struct {
+	dir string
+}
+
+func NewBtrfsDestination(dir string) *BtrfsDestination {
+	return &BtrfsDestination{dir: dir}
+}
+
+func (d *BtrfsDestination) Has(snapshot Snapshot) (bool, error) {
+	ids, err := ioctl.UUIDTreeLookup(d.dir, snapshot.UUID.Bytes(), ioctl.UUIDKeyReceivedSubvol)
+	if err != nil || len(ids) == 0 {
+		return false, err
+	}
+
+	// the subvolume must be in the destination directory, not anywhere on the filesystem
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(d.dir, entry.Name())
+		if ok, err := ioctl.TestIsSubvolume(path); err != nil || !ok {
+			continue
+		}
+
+		id, err := ioctl.GetRootId(path)
+		if err != nil {
+			return false, err
+		}
+		for _, received := range ids {
+			if id == received {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (d *BtrfsDestination) Receive(snapshot Snapshot, parent *Snapshot, stream io.Reader) error {
+	_, err := btrfs.NewIoctl().Receive().Destination(d.dir).Reader(stream).Execute()
+	return err
+}
+
+// stateFile lists the streams stored by a file destination
+const stateFile = "state.json"
+
+// StreamInfo is a stream stored by a file destination
+type StreamInfo struct {
+	// File is the name of the stream file in the destination directory
+	File       string
+	Snapshot   string
+	UUID       uuid.UUID
+	ParentUUID *uuid.UUID `json:",omitempty"`
+	Time       time.Time
+}
+
+// FileDestination stores every stream as a file and records them in a state file, the streams
+// can be received in order with `btrfs receive` or Receive
+type FileDestination struct {
+	dir string
+}
+
+func NewFileDestination(dir string) *FileDestination {
+	return &FileDestination{dir: dir}
+}
+
+// Streams returns the stored streams in the order they were written
+func (d *FileDestination) Streams() ([]StreamInfo, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.dir, stateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []StreamInfo
+	if err := json.Unmarshal(data, &streams); err != nil {
+		return nil, fmt.Errorf("invalid state file: %v", err)
+	}
+	return streams, nil
+}
+
+func (d *FileDestination) Has(snapshot Snapshot) (bool, error) {
+	streams, err := d.Streams()
+	if err != nil {
+		return false, err
+	}
+	for _, s := range streams {
+		if uuid.Equal(s.UUID, snapshot.UUID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// writeFile writes the file atomically through a temporary file
+func writeFile(path string, r io.Reader) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *FileDestination) Receive(snapshot Snapshot, parent *Snapshot, stream io.Reader) error {
+	streams, err := d.Streams()
+	if err != nil {
+		return err
+	}
+
+	info := StreamInfo{File: snapshot.Name + ".btrfs", Snapshot: snapshot.Name, UUID: snapshot.UUID, Time: time.Now().UTC()}
+	if parent != nil {
+		parentUUID := parent.UUID
+		info.ParentUUID = &parentUUID
+	}
+
+	if err := writeFile(filepath.Join(d.dir, info.File), stream); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(append(streams, info), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(d.dir, stateFile), bytes.NewReader(data))
+}
@@ -0,0 +1,86 @@
+package balance
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/poll"
+	"github.com/plar/btrfs/ioctl"
+)
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdBalanceStart, ioctlStart)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdBalancePause, ioctlPause)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdBalanceResume, ioctlResume)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdBalanceCancel, ioctlCancel)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdBalanceStatus, ioctlStatus)
+
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdBalanceStart, cliStart)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdBalancePause, cliPause)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdBalanceResume, cliResume)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdBalanceCancel, cliCancel)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdBalanceStatus, cliStatus)
+}
+
+// how often a background balance checks whether the kernel is running it
+var startPollInterval = 100 * time.Millisecond
+
+func newProgress(status *ioctl.BalanceStatus, paused bool) *btrfs.BalanceProgress {
+	return &btrfs.BalanceProgress{
+		Running:         status.Running,
+		Paused:          paused,
+		PauseRequested:  status.PauseRequested,
+		CancelRequested: status.CancelRequested,
+		Expected:        status.Expected,
+		Considered:      status.Considered,
+		Completed:       status.Completed,
+	}
+}
+
+// balanceRun runs the blocking balance ioctl of a start or a resume
+type balanceRun struct {
+	path   string
+	task   *poll.Task
+	status *ioctl.BalanceStatus
+}
+
+// start runs the balance, in background mode it returns as soon as the kernel reports the balance
+// as running, the ioctl goes on in its goroutine and wait returns its result
+func (r *balanceRun) start(path string, background bool, balance func() (*ioctl.BalanceStatus, error)) (*btrfs.BalanceProgress, error) {
+	r.path = path
+	r.task = poll.Go(func() error {
+		var err error
+		r.status, err = balance()
+		return err
+	})
+
+	var progress *btrfs.BalanceProgress
+	if background && r.task.WaitStarted(startPollInterval, func() bool {
+		status, err := ioctl.GetBalanceStatus(path)
+		if err != nil || status == nil || !status.Running {
+			return false
+		}
+		progress = newProgress(status, false)
+		return true
+	}) {
+		return progress, nil
+	}
+	return r.wait()
+}
+
+// wait blocks until the balance ioctl returned and returns its result
+func (r *balanceRun) wait() (*btrfs.BalanceProgress, error) {
+	if r.task == nil {
+		return nil, errors.New("balance was not started")
+	}
+
+	err := r.task.Wait()
+	if r.status == nil {
+		return nil, err
+	}
+
+	// a paused balance stays registered in the kernel
+	current, _ := ioctl.GetBalanceStatus(r.path)
+	return newProgress(r.status, current != nil && !current.Running), err
+}
@@ -0,0 +1,183 @@
+package balance
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	"github.com/plar/btrfs/ioctl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func TestParseFilters(t *testing.T) {
+	args, err := parseFilters("")
+	assert.NoError(t, err)
+	assert.Equal(t, &ioctl.BalanceArgs{}, args)
+
+	args, err = parseFilters("usage=50")
+	assert.NoError(t, err)
+	assert.Equal(t, &ioctl.BalanceArgs{Flags: ioctl.BalanceArgsUsage, Usage: 50}, args)
+
+	args, err = parseFilters("usage=10..")
+	assert.NoError(t, err)
+	assert.Equal(t, &ioctl.BalanceArgs{Flags: ioctl.BalanceArgsUsageRange, UsageMin: 10, UsageMax: 100}, args)
+
+	args, err = parseFilters("devid=2,drange=1G..2G,vrange=..4k")
+	assert.NoError(t, err)
+	assert.Equal(t, &ioctl.BalanceArgs{
+		Flags:  ioctl.BalanceArgsDevid | ioctl.BalanceArgsDrange | ioctl.BalanceArgsVrange,
+		Devid:  2,
+		PStart: 1 << 30,
+		PEnd:   2 << 30,
+		VStart: 0,
+		VEnd:   4096,
+	}, args)
+
+	args, err = parseFilters("limit=3,stripes=2..")
+	assert.NoError(t, err)
+	assert.Equal(t, &ioctl.BalanceArgs{
+		Flags:      ioctl.BalanceArgsLimit | ioctl.BalanceArgsStripesRange,
+		Limit:      3,
+		StripesMin: 2,
+		StripesMax: math.MaxUint32,
+	}, args)
+
+	args, err = parseFilters("limit=1..5")
+	assert.NoError(t, err)
+	assert.Equal(t, &ioctl.BalanceArgs{Flags: ioctl.BalanceArgsLimitRange, LimitMin: 1, LimitMax: 5}, args)
+
+	args, err = parseFilters("profiles=raid1|dup,convert=single,soft")
+	assert.NoError(t, err)
+	assert.Equal(t, &ioctl.BalanceArgs{
+		Flags:    ioctl.BalanceArgsProfiles | ioctl.BalanceArgsConvert | ioctl.BalanceArgsSoft,
+		Profiles: ioctl.BlockGroupProfiles["raid1"] | ioctl.BlockGroupProfiles["dup"],
+		Target:   ioctl.BlockGroupProfiles["single"],
+	}, args)
+
+	invalid := map[string]string{
+		"usage=101":         "must be between 0 and 100",
+		"usage=50..10":      "start is greater than end",
+		"usage=x":           "invalid number 'x'",
+		"usage":             "the usage filter requires a value",
+		"devid=0":           "must be greater than zero",
+		"drange=1G":         "expected start..end",
+		"convert=raid7":     "unknown profile 'raid7'",
+		"convert=raid1|dup": "convert accepts a single profile",
+		"soft":              "the soft filter requires convert",
+		"speed=fast":        "unknown balance filter 'speed'",
+	}
+	for filters, msg := range invalid {
+		_, err := parseFilters(filters)
+		if assert.Error(t, err, filters) {
+			assert.Contains(t, err.Error(), msg, filters)
+		}
+	}
+}
+
+func TestBalanceValidation(t *testing.T) {
+	balance := btrfs.NewIoctl().Balance()
+
+	_, err := balance.Start().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = balance.Start().Path(mount).System("").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "balancing system chunks requires force")
+
+	_, err = balance.Start().Path(mount).Metadata("usage=200").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "metadata: invalid usage")
+
+	err = balance.Pause().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = balance.Resume().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = balance.Cancel().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = balance.Status().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+}
+
+func TestBalance(t *testing.T) {
+	balance := btrfs.NewIoctl().Balance()
+
+	for i := 0; i < 8; i++ {
+		data := make([]byte, 4*1024*1024)
+		err := ioutil.WriteFile(filepath.Join(mount, fmt.Sprintf("file%d", i)), data, 0600)
+		assert.NoError(t, err)
+	}
+
+	progress, err := balance.Status().Path(mount).Execute()
+	assert.NoError(t, err)
+	assert.Nil(t, progress)
+
+	progress, err = balance.Start().Path(mount).Data("usage=100").Metadata("usage=100").Execute()
+	assert.NoError(t, err)
+	if assert.NotNil(t, progress) {
+		assert.False(t, progress.Running)
+		assert.False(t, progress.Paused)
+		assert.True(t, progress.Completed <= progress.Considered)
+	}
+
+	// full balance of all chunk types
+	_, err = balance.Start().Path(mount).Execute()
+	assert.NoError(t, err)
+
+	// a background balance reports its result through Wait
+	start := balance.Start().Path(mount).Background()
+	_, err = start.Execute()
+	assert.NoError(t, err)
+	progress, err = start.Wait()
+	assert.NoError(t, err)
+	if assert.NotNil(t, progress) {
+		assert.False(t, progress.Running)
+	}
+
+	progress, err = balance.Status().Path(mount).Execute()
+	assert.NoError(t, err)
+	assert.Nil(t, progress)
+}
+
+func TestBalanceNotRunning(t *testing.T) {
+	balance := btrfs.NewIoctl().Balance()
+
+	err := balance.Pause().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "No balance is running")
+
+	err = balance.Cancel().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "No balance is running")
+
+	_, err = balance.Resume().Path(mount).Execute()
+	assert.Error(t, err)
+
+	_, err = balance.Start().Wait()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "balance was not started")
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
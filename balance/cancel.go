@@ -0,0 +1,67 @@
+package balance
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type balanceCancel struct {
+	path string
+
+	executor func(c *balanceCancel) error
+}
+
+func (c *balanceCancel) Path(path string) btrfs.BalanceCancel {
+	c.path = path
+	return c
+}
+
+func (c *balanceCancel) context() string {
+	return fmt.Sprintf("path='%s'", c.path)
+}
+
+func (c *balanceCancel) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdBalanceCancel), Context: c.context(), Err: err}
+}
+
+func (c *balanceCancel) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *balanceCancel) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlCancelExecute(c *balanceCancel) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return ioctl.BalanceCancel(c.path)
+}
+
+// btrfs cli executor
+func cliCancelExecute(c *balanceCancel) error {
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlCancel() interface{} {
+	return &balanceCancel{executor: ioctlCancelExecute}
+}
+
+func cliCancel() interface{} {
+	return &balanceCancel{executor: cliCancelExecute}
+}
@@ -0,0 +1,179 @@
+package balance
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+// parseRange parses "min..max", "min..", "..max" or a single value, the missing bounds are 0 and max
+func parseRange(value string, max uint64, parse func(string) (uint64, error)) (from, to uint64, isRange bool, err error) {
+	idx := strings.Index(value, "..")
+	if idx < 0 {
+		from, err = parse(value)
+		return from, from, false, err
+	}
+
+	from, to = 0, max
+	if idx > 0 {
+		if from, err = parse(value[:idx]); err != nil {
+			return
+		}
+	}
+	if idx+2 < len(value) {
+		if to, err = parse(value[idx+2:]); err != nil {
+			return
+		}
+	}
+
+	if from > to {
+		err = fmt.Errorf("invalid range '%s', start is greater than end", value)
+	}
+	return from, to, true, err
+}
+
+func parseUint(value string) (uint64, error) {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number '%s'", value)
+	}
+	return n, nil
+}
+
+func parseProfile(name string) (uint64, error) {
+	profile, ok := ioctl.BlockGroupProfiles[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown profile '%s'", name)
+	}
+	return profile, nil
+}
+
+// parseFilters parses the comma separated balance filters of one chunk type, e.g. "usage=0..50,limit=10"
+func parseFilters(filters string) (*ioctl.BalanceArgs, error) {
+	args := &ioctl.BalanceArgs{}
+	if len(filters) == 0 {
+		return args, nil
+	}
+
+	for _, filter := range strings.Split(filters, ",") {
+		var name, value string
+		if idx := strings.Index(filter, "="); idx >= 0 {
+			name, value = filter[:idx], filter[idx+1:]
+		} else {
+			name = filter
+		}
+
+		if len(value) == 0 && name != "soft" {
+			return nil, fmt.Errorf("the %s filter requires a value", name)
+		}
+
+		switch name {
+		case "profiles":
+			for _, p := range strings.Split(value, "|") {
+				profile, err := parseProfile(p)
+				if err != nil {
+					return nil, err
+				}
+				args.Profiles |= profile
+			}
+			args.Flags |= ioctl.BalanceArgsProfiles
+
+		case "usage":
+			from, to, isRange, err := parseRange(value, 100, parseUint)
+			if err != nil {
+				return nil, err
+			}
+			if to > 100 {
+				return nil, fmt.Errorf("invalid usage '%s', must be between 0 and 100", value)
+			}
+			if isRange {
+				args.Flags |= ioctl.BalanceArgsUsageRange
+				args.UsageMin, args.UsageMax = uint32(from), uint32(to)
+			} else {
+				args.Flags |= ioctl.BalanceArgsUsage
+				args.Usage = from
+			}
+
+		case "devid":
+			devid, err := parseUint(value)
+			if err != nil {
+				return nil, err
+			}
+			if devid == 0 {
+				return nil, fmt.Errorf("invalid devid '%s', must be greater than zero", value)
+			}
+			args.Flags |= ioctl.BalanceArgsDevid
+			args.Devid = devid
+
+		case "drange", "vrange":
+			from, to, isRange, err := parseRange(value, math.MaxUint64, validators.ParseSize)
+			if err != nil {
+				return nil, err
+			}
+			if !isRange {
+				return nil, fmt.Errorf("invalid %s '%s', expected start..end", name, value)
+			}
+			if name == "drange" {
+				args.Flags |= ioctl.BalanceArgsDrange
+				args.PStart, args.PEnd = from, to
+			} else {
+				args.Flags |= ioctl.BalanceArgsVrange
+				args.VStart, args.VEnd = from, to
+			}
+
+		case "limit":
+			from, to, isRange, err := parseRange(value, math.MaxUint32, parseUint)
+			if err != nil {
+				return nil, err
+			}
+			if isRange {
+				if to > math.MaxUint32 {
+					return nil, fmt.Errorf("invalid limit '%s'", value)
+				}
+				args.Flags |= ioctl.BalanceArgsLimitRange
+				args.LimitMin, args.LimitMax = uint32(from), uint32(to)
+			} else {
+				args.Flags |= ioctl.BalanceArgsLimit
+				args.Limit = from
+			}
+
+		case "stripes":
+			from, to, _, err := parseRange(value, math.MaxUint32, parseUint)
+			if err != nil {
+				return nil, err
+			}
+			if to > math.MaxUint32 {
+				return nil, fmt.Errorf("invalid stripes '%s'", value)
+			}
+			args.Flags |= ioctl.BalanceArgsStripesRange
+			args.StripesMin, args.StripesMax = uint32(from), uint32(to)
+
+		case "convert":
+			if strings.Contains(value, "|") {
+				return nil, fmt.Errorf("convert accepts a single profile '%s'", value)
+			}
+			profile, err := parseProfile(value)
+			if err != nil {
+				return nil, err
+			}
+			args.Flags |= ioctl.BalanceArgsConvert
+			args.Target = profile
+
+		case "soft":
+			args.Flags |= ioctl.BalanceArgsSoft
+
+		default:
+			return nil, fmt.Errorf("unknown balance filter '%s'", name)
+		}
+	}
+
+	if args.Flags&ioctl.BalanceArgsSoft != 0 && args.Flags&ioctl.BalanceArgsConvert == 0 {
+		return nil, fmt.Errorf("the soft filter requires convert")
+	}
+
+	return args, nil
+}
@@ -0,0 +1,67 @@
+package balance
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type balancePause struct {
+	path string
+
+	executor func(c *balancePause) error
+}
+
+func (c *balancePause) Path(path string) btrfs.BalancePause {
+	c.path = path
+	return c
+}
+
+func (c *balancePause) context() string {
+	return fmt.Sprintf("path='%s'", c.path)
+}
+
+func (c *balancePause) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdBalancePause), Context: c.context(), Err: err}
+}
+
+func (c *balancePause) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *balancePause) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlPauseExecute(c *balancePause) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return ioctl.BalancePause(c.path)
+}
+
+// btrfs cli executor
+func cliPauseExecute(c *balancePause) error {
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlPause() interface{} {
+	return &balancePause{executor: ioctlPauseExecute}
+}
+
+func cliPause() interface{} {
+	return &balancePause{executor: cliPauseExecute}
+}
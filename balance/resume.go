@@ -0,0 +1,90 @@
+package balance
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type balanceResume struct {
+	path       string
+	background bool
+	run        balanceRun
+
+	executor func(c *balanceResume) (*btrfs.BalanceProgress, error)
+}
+
+func (c *balanceResume) Path(path string) btrfs.BalanceResume {
+	c.path = path
+	return c
+}
+
+func (c *balanceResume) Background() btrfs.BalanceResume {
+	c.background = true
+	return c
+}
+
+func (c *balanceResume) context() string {
+	return fmt.Sprintf("path='%s', background=%v", c.path, c.background)
+}
+
+func (c *balanceResume) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdBalanceResume), Context: c.context(), Err: err}
+}
+
+func (c *balanceResume) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *balanceResume) Execute() (*btrfs.BalanceProgress, error) {
+	progress, err := c.executor(c)
+	if err != nil {
+		return progress, c.error(err)
+	}
+	return progress, nil
+}
+
+func (c *balanceResume) Wait() (*btrfs.BalanceProgress, error) {
+	progress, err := c.run.wait()
+	if err != nil {
+		return progress, c.error(err)
+	}
+	return progress, nil
+}
+
+// btrfs ioctl executor
+func ioctlResumeExecute(c *balanceResume) (*btrfs.BalanceProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// the kernel keeps the filters of the paused balance
+	return c.run.start(c.path, c.background, func() (*ioctl.BalanceStatus, error) {
+		return ioctl.Balance(c.path, ioctl.BalanceResume, nil, nil, nil)
+	})
+}
+
+// btrfs cli executor
+func cliResumeExecute(c *balanceResume) (*btrfs.BalanceProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlResume() interface{} {
+	return &balanceResume{executor: ioctlResumeExecute}
+}
+
+func cliResume() interface{} {
+	return &balanceResume{executor: cliResumeExecute}
+}
@@ -0,0 +1,171 @@
+package balance
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type balanceStart struct {
+	path       string
+	data       *string
+	meta       *string
+	sys        *string
+	force      bool
+	background bool
+	run        balanceRun
+
+	executor func(c *balanceStart) (*btrfs.BalanceProgress, error)
+}
+
+func (c *balanceStart) Path(path string) btrfs.BalanceStart {
+	c.path = path
+	return c
+}
+
+func (c *balanceStart) Data(filters string) btrfs.BalanceStart {
+	c.data = &filters
+	return c
+}
+
+func (c *balanceStart) Metadata(filters string) btrfs.BalanceStart {
+	c.meta = &filters
+	return c
+}
+
+func (c *balanceStart) System(filters string) btrfs.BalanceStart {
+	c.sys = &filters
+	return c
+}
+
+func (c *balanceStart) Force() btrfs.BalanceStart {
+	c.force = true
+	return c
+}
+
+func (c *balanceStart) Background() btrfs.BalanceStart {
+	c.background = true
+	return c
+}
+
+func filtersContext(filters *string) string {
+	if filters == nil {
+		return "<none>"
+	}
+	return *filters
+}
+
+func (c *balanceStart) context() string {
+	return fmt.Sprintf("path='%s', data='%s', meta='%s', sys='%s', force=%v, background=%v",
+		c.path, filtersContext(c.data), filtersContext(c.meta), filtersContext(c.sys), c.force, c.background)
+}
+
+func (c *balanceStart) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdBalanceStart), Context: c.context(), Err: err}
+}
+
+func (c *balanceStart) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	if c.sys != nil && !c.force {
+		return errors.New("balancing system chunks requires force")
+	}
+
+	return nil
+}
+
+// args parses the filters of the selected chunk types into the balance flags and arguments
+func (c *balanceStart) args() (flags uint64, data, meta, sys *ioctl.BalanceArgs, err error) {
+	if c.data == nil && c.meta == nil && c.sys == nil {
+		flags = ioctl.BalanceData | ioctl.BalanceMetadata | ioctl.BalanceSystem
+		data, meta, sys = &ioctl.BalanceArgs{}, &ioctl.BalanceArgs{}, &ioctl.BalanceArgs{}
+	}
+
+	if c.data != nil {
+		if data, err = parseFilters(*c.data); err != nil {
+			return 0, nil, nil, nil, fmt.Errorf("data: %v", err)
+		}
+		flags |= ioctl.BalanceData
+	}
+
+	if c.meta != nil {
+		if meta, err = parseFilters(*c.meta); err != nil {
+			return 0, nil, nil, nil, fmt.Errorf("metadata: %v", err)
+		}
+		flags |= ioctl.BalanceMetadata
+	}
+
+	if c.sys != nil {
+		if sys, err = parseFilters(*c.sys); err != nil {
+			return 0, nil, nil, nil, fmt.Errorf("system: %v", err)
+		}
+		flags |= ioctl.BalanceSystem
+	} else if c.meta != nil {
+		// system chunks follow the metadata the same way as in btrfs-progs
+		copied := *meta
+		sys = &copied
+		flags |= ioctl.BalanceSystem
+	}
+
+	if c.force {
+		flags |= ioctl.BalanceForce
+	}
+
+	return flags, data, meta, sys, nil
+}
+
+func (c *balanceStart) Execute() (*btrfs.BalanceProgress, error) {
+	progress, err := c.executor(c)
+	if err != nil {
+		return progress, c.error(err)
+	}
+	return progress, nil
+}
+
+func (c *balanceStart) Wait() (*btrfs.BalanceProgress, error) {
+	progress, err := c.run.wait()
+	if err != nil {
+		return progress, c.error(err)
+	}
+	return progress, nil
+}
+
+// btrfs ioctl executor
+func ioctlStartExecute(c *balanceStart) (*btrfs.BalanceProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	flags, data, meta, sys, err := c.args()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.run.start(c.path, c.background, func() (*ioctl.BalanceStatus, error) {
+		return ioctl.Balance(c.path, flags, data, meta, sys)
+	})
+}
+
+// btrfs cli executor
+func cliStartExecute(c *balanceStart) (*btrfs.BalanceProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlStart() interface{} {
+	return &balanceStart{executor: ioctlStartExecute}
+}
+
+func cliStart() interface{} {
+	return &balanceStart{executor: cliStartExecute}
+}
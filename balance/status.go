@@ -0,0 +1,72 @@
+package balance
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type balanceStatus struct {
+	path string
+
+	executor func(c *balanceStatus) (*btrfs.BalanceProgress, error)
+}
+
+func (c *balanceStatus) Path(path string) btrfs.BalanceStatus {
+	c.path = path
+	return c
+}
+
+func (c *balanceStatus) context() string {
+	return fmt.Sprintf("path='%s'", c.path)
+}
+
+func (c *balanceStatus) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdBalanceStatus), Context: c.context(), Err: err}
+}
+
+func (c *balanceStatus) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *balanceStatus) Execute() (*btrfs.BalanceProgress, error) {
+	progress, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return progress, nil
+}
+
+// btrfs ioctl executor
+func ioctlStatusExecute(c *balanceStatus) (*btrfs.BalanceProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := ioctl.GetBalanceStatus(c.path)
+	if err != nil || status == nil {
+		return nil, err
+	}
+
+	return newProgress(status, !status.Running), nil
+}
+
+// btrfs cli executor
+func cliStatusExecute(c *balanceStatus) (*btrfs.BalanceProgress, error) {
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlStatus() interface{} {
+	return &balanceStatus{executor: ioctlStatusExecute}
+}
+
+func cliStatus() interface{} {
+	return &balanceStatus{executor: cliStatusExecute}
+}
@@ -1,7 +1,10 @@
 package btrfs
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/satori/go.uuid"
 )
@@ -21,6 +24,53 @@ const (
 	CmdSubvolFindNew  Command = "subvolume find-new"
 	CmdSubvolDelete   Command = "subvolume delete"
 	CmdSubvolList     Command = "subvolume list"
+	CmdSubvolDiff     Command = "subvolume diff"
+
+	CmdFilesystemDefrag   Command = "filesystem defragment"
+	CmdFilesystemResize   Command = "filesystem resize"
+	CmdFilesystemFeatures Command = "filesystem features"
+
+	CmdDeviceAdd    Command = "device add"
+	CmdDeviceRemove Command = "device remove"
+	CmdDeviceStats  Command = "device stats"
+	CmdDeviceScan   Command = "device scan"
+	CmdDeviceReady  Command = "device ready"
+
+	CmdReplaceStart  Command = "replace start"
+	CmdReplaceStatus Command = "replace status"
+	CmdReplaceCancel Command = "replace cancel"
+
+	CmdBalanceStart  Command = "balance start"
+	CmdBalancePause  Command = "balance pause"
+	CmdBalanceResume Command = "balance resume"
+	CmdBalanceCancel Command = "balance cancel"
+	CmdBalanceStatus Command = "balance status"
+
+	CmdScrubStart  Command = "scrub start"
+	CmdScrubStatus Command = "scrub status"
+	CmdScrubCancel Command = "scrub cancel"
+
+	CmdQuotaEnable       Command = "quota enable"
+	CmdQuotaDisable      Command = "quota disable"
+	CmdQuotaRescan       Command = "quota rescan"
+	CmdQuotaRescanStatus Command = "quota rescan status"
+
+	CmdQgroupCreate  Command = "qgroup create"
+	CmdQgroupDestroy Command = "qgroup destroy"
+	CmdQgroupAssign  Command = "qgroup assign"
+	CmdQgroupRemove  Command = "qgroup remove"
+	CmdQgroupLimit   Command = "qgroup limit"
+	CmdQgroupShow    Command = "qgroup show"
+
+	CmdSend    Command = "send"
+	CmdReceive Command = "receive"
+
+	CmdPropertyGet  Command = "property get"
+	CmdPropertySet  Command = "property set"
+	CmdPropertyList Command = "property list"
+
+	CmdInspectInodeResolve   Command = "inspect-internal inode-resolve"
+	CmdInspectLogicalResolve Command = "inspect-internal logical-resolve"
 )
 
 const (
@@ -53,9 +103,19 @@ type Executor interface {
 	Execute() error
 }
 
-//
 type API interface {
 	Subvolume() Subvolume
+	Filesystem() Filesystem
+	Device() Device
+	Replace() Replace
+	Balance() Balance
+	Scrub() Scrub
+	Quota() Quota
+	Qgroup() Qgroup
+	Send() Send
+	Receive() Receive
+	Property() Property
+	Inspect() Inspect
 }
 
 type Subvolume interface {
@@ -63,6 +123,7 @@ type Subvolume interface {
 	Snapshot() SubvolSnapshot
 	Delete() SubvolDelete
 	List() SubvolList
+	Diff() SubvolDiff
 }
 
 type SubvolCreate interface {
@@ -100,8 +161,10 @@ type SubvolInfo struct {
 	ID               uint64
 	OriginGeneration uint64
 	Generation       uint64
+	OriginTime       time.Time
 	ParentUUID       uuid.UUID
 	UUID             uuid.UUID
+	ReceivedUUID     uuid.UUID
 	IsSnapshot       bool
 	IsReadOnly       bool
 
@@ -118,6 +181,688 @@ type SubvolList interface {
 	Execute() ([]SubvolInfo, error)
 }
 
+// ChangeKind is the kind of change of a path between two snapshots
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeModified ChangeKind = "modified"
+	ChangeDeleted  ChangeKind = "deleted"
+	ChangeRenamed  ChangeKind = "renamed"
+)
+
+type SubvolChange struct {
+	Kind ChangeKind
+	// Path is relative to the snapshots, deleted paths are in the old snapshot
+	Path string
+	// OldPath is the path of a renamed file in the old snapshot
+	OldPath string
+	IsDir   bool
+}
+
+// SubvolDiff compares two snapshots of the same subvolume using the generations of the tree items,
+// without reading the files. A renamed file which was also changed is reported as renamed and modified,
+// the contents of a deleted directory are reported as deleted too.
+type SubvolDiff interface {
+	// From is the older snapshot, it must be read only
+	From(path string) SubvolDiff
+	// To is the newer snapshot, it is a snapshot of the same subvolume as From, of From itself
+	// or the subvolume From is a snapshot of
+	To(path string) SubvolDiff
+
+	// Execute returns the changes sorted by path
+	Execute() ([]SubvolChange, error)
+}
+
+type Filesystem interface {
+	Defrag() FsDefrag
+	Resize() FsResize
+	Features() FsFeatures
+}
+
+// FsDefragError describes a file which could not be defragmented
+type FsDefragError struct {
+	Path string
+	Err  error
+}
+
+func (e *FsDefragError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+type FsDefrag interface {
+	Path(path string) FsDefrag
+
+	// Range limits defragmentation to length bytes starting at start, length 0 means up to the end of file
+	Range(start, length uint64) FsDefrag
+	// ExtentThreshold sets the size in bytes of extents considered already defragmented
+	ExtentThreshold(threshold uint32) FsDefrag
+	// Compression compresses the file contents while defragmenting: zlib, lzo or zstd
+	Compression(algo string) FsDefrag
+	Flush() FsDefrag
+	// Recursive defragments all files under the directory, nested subvolumes are not entered
+	Recursive() FsDefrag
+
+	// Execute returns the files that failed to defragment, the error is reported only if the whole run failed
+	Execute() ([]FsDefragError, error)
+}
+
+type FsResize interface {
+	Executor
+
+	Path(path string) FsResize
+	// DeviceID selects the device to resize, the default is 1
+	DeviceID(devid uint64) FsResize
+	// Size is an absolute size (1G), a relative delta (+512M, -1G) or max
+	Size(size string) FsResize
+}
+
+type FsFeature struct {
+	Name string
+	// Kind is one of compat, compat_ro or incompat
+	Kind string
+
+	Enabled bool
+	// Supported is set if the running kernel supports the feature
+	Supported bool
+	// Settable is set if the feature can be enabled on a mounted filesystem
+	Settable bool
+}
+
+type FsFeatures interface {
+	Path(path string) FsFeatures
+	// Enable turns on the named features, the kernel has to support setting them online
+	Enable(names ...string) FsFeatures
+
+	Execute() ([]FsFeature, error)
+}
+
+type Device interface {
+	Add() DevAdd
+	Remove() DevRemove
+	Stats() DevStats
+	Scan() DevScan
+	Ready() DevReady
+}
+
+type DevAdd interface {
+	Executor
+
+	Path(path string) DevAdd
+	Devices(devices ...string) DevAdd
+	// Force adds devices which contain a filesystem
+	Force() DevAdd
+}
+
+type DevRemove interface {
+	Executor
+
+	Path(path string) DevRemove
+	// Devices are device paths, device ids or the "missing" keyword
+	Devices(devices ...string) DevRemove
+}
+
+type DevStatsInfo struct {
+	DevID uint64
+	Path  string
+
+	WriteErrs      uint64
+	ReadErrs       uint64
+	FlushErrs      uint64
+	CorruptionErrs uint64
+	GenerationErrs uint64
+}
+
+func (s *DevStatsInfo) HasErrors() bool {
+	return s.WriteErrs+s.ReadErrs+s.FlushErrs+s.CorruptionErrs+s.GenerationErrs > 0
+}
+
+type DevStats interface {
+	Path(path string) DevStats
+	// Devices limits the stats to the given device paths or device ids, all devices are reported by default
+	Devices(devices ...string) DevStats
+	// Reset zeroes the counters after reading them
+	Reset() DevStats
+
+	Execute() ([]DevStatsInfo, error)
+}
+
+type DevScan interface {
+	Devices(devices ...string) DevScan
+	// All probes every block device for the btrfs superblock and scans the found ones
+	All() DevScan
+	// Forget unregisters the devices, without devices all devices of unmounted filesystems are unregistered
+	Forget() DevScan
+
+	// Execute returns the scanned devices
+	Execute() ([]string, error)
+}
+
+type DevReady interface {
+	Device(device string) DevReady
+
+	// Execute reports whether all devices of the filesystem are registered and it can be mounted
+	Execute() (bool, error)
+}
+
+type Replace interface {
+	Start() ReplaceStart
+	Status() ReplaceStatus
+	Cancel() ReplaceCancel
+}
+
+type ReplaceStart interface {
+	Executor
+
+	Path(path string) ReplaceStart
+	// Source is the replaced device path or device id
+	Source(device string) ReplaceStart
+	Target(device string) ReplaceStart
+	// AvoidSource reads from the source device only if there is no other mirror
+	AvoidSource() ReplaceStart
+	// Force uses a target device which contains a filesystem
+	Force() ReplaceStart
+	// Background returns as soon as the replace is running instead of waiting for its end.
+	// The ioctl keeps running in a goroutine of the caller until the replace is over, the
+	// process must stay alive and call Wait to learn whether the replace succeeded.
+	Background() ReplaceStart
+
+	// Wait blocks until the replace started by Execute is over and returns its result
+	Wait() error
+}
+
+type ReplaceProgress struct {
+	// State is one of never started, started, finished, canceled or suspended
+	State string
+	// Progress in permille
+	Progress  uint64
+	StartTime time.Time
+	StopTime  time.Time
+
+	WriteErrs             uint64
+	UncorrectableReadErrs uint64
+
+	// Err is set by Watch on the last update if the status could not be read
+	Err error
+}
+
+func (p *ReplaceProgress) Running() bool {
+	return p.State == "started"
+}
+
+type ReplaceStatus interface {
+	Path(path string) ReplaceStatus
+
+	Execute() (*ReplaceProgress, error)
+	// Watch sends the progress every second until the replace is not running or ctx is done
+	Watch(ctx context.Context) <-chan ReplaceProgress
+}
+
+type ReplaceCancel interface {
+	Executor
+
+	Path(path string) ReplaceCancel
+}
+
+type Balance interface {
+	Start() BalanceStart
+	Pause() BalancePause
+	Resume() BalanceResume
+	Cancel() BalanceCancel
+	Status() BalanceStatus
+}
+
+type BalanceProgress struct {
+	Running bool
+	// Paused is set if the balance is paused and can be resumed
+	Paused          bool
+	PauseRequested  bool
+	CancelRequested bool
+
+	// Expected is the estimated number of chunks to relocate
+	Expected   uint64
+	Considered uint64
+	Completed  uint64
+}
+
+type BalanceStart interface {
+	Path(path string) BalanceStart
+
+	// Data, Metadata and System select the chunk types to balance. The filters use
+	// the btrfs balance syntax, e.g. "usage=0..50,limit=10" or "convert=raid1,soft",
+	// an empty string balances all chunks of the type. All types are balanced if none is set.
+	Data(filters string) BalanceStart
+	// Metadata filters apply to system chunks too unless System is set
+	Metadata(filters string) BalanceStart
+	// System requires Force
+	System(filters string) BalanceStart
+	Force() BalanceStart
+	// Background returns as soon as the balance is running instead of waiting for its end.
+	// The ioctl keeps running in a goroutine of the caller until the balance is over, the
+	// process must stay alive and call Wait to learn whether the balance failed or was canceled.
+	Background() BalanceStart
+
+	Execute() (*BalanceProgress, error)
+	// Wait blocks until the balance started by Execute is over and returns its result
+	Wait() (*BalanceProgress, error)
+}
+
+type BalancePause interface {
+	Executor
+
+	Path(path string) BalancePause
+}
+
+type BalanceResume interface {
+	Path(path string) BalanceResume
+	// Background returns as soon as the balance is running again, see BalanceStart.Background
+	Background() BalanceResume
+
+	Execute() (*BalanceProgress, error)
+	// Wait blocks until the balance resumed by Execute is over and returns its result
+	Wait() (*BalanceProgress, error)
+}
+
+type BalanceCancel interface {
+	Executor
+
+	Path(path string) BalanceCancel
+}
+
+type BalanceStatus interface {
+	Path(path string) BalanceStatus
+
+	// Execute returns nil if there is no running or paused balance
+	Execute() (*BalanceProgress, error)
+}
+
+type Scrub interface {
+	Start() ScrubStart
+	Status() ScrubStatus
+	Cancel() ScrubCancel
+}
+
+// ScrubCounters are the counters of struct btrfs_scrub_progress
+type ScrubCounters struct {
+	DataExtentsScrubbed uint64
+	TreeExtentsScrubbed uint64
+	DataBytesScrubbed   uint64
+	TreeBytesScrubbed   uint64
+
+	ReadErrs          uint64
+	CsumErrs          uint64
+	VerifyErrs        uint64
+	SuperErrs         uint64
+	MallocErrs        uint64
+	UncorrectableErrs uint64
+	CorrectedErrs     uint64
+	UnverifiedErrs    uint64
+
+	// NoCsum counts the data blocks without checksum, e.g. written with nodatasum
+	NoCsum       uint64
+	CsumDiscards uint64
+}
+
+// Add sums the counters
+func (c *ScrubCounters) Add(o ScrubCounters) {
+	c.DataExtentsScrubbed += o.DataExtentsScrubbed
+	c.TreeExtentsScrubbed += o.TreeExtentsScrubbed
+	c.DataBytesScrubbed += o.DataBytesScrubbed
+	c.TreeBytesScrubbed += o.TreeBytesScrubbed
+	c.ReadErrs += o.ReadErrs
+	c.CsumErrs += o.CsumErrs
+	c.VerifyErrs += o.VerifyErrs
+	c.SuperErrs += o.SuperErrs
+	c.MallocErrs += o.MallocErrs
+	c.UncorrectableErrs += o.UncorrectableErrs
+	c.CorrectedErrs += o.CorrectedErrs
+	c.UnverifiedErrs += o.UnverifiedErrs
+	c.NoCsum += o.NoCsum
+	c.CsumDiscards += o.CsumDiscards
+}
+
+func (c *ScrubCounters) HasErrors() bool {
+	return c.ReadErrs+c.CsumErrs+c.VerifyErrs+c.SuperErrs+c.MallocErrs+c.UncorrectableErrs > 0
+}
+
+type ScrubDevice struct {
+	DevID uint64
+	Path  string
+
+	Running  bool
+	Canceled bool
+	// LastPhysical is the last scrubbed physical address on the device
+	LastPhysical uint64
+	ScrubCounters
+
+	Err error
+}
+
+// ScrubProgress is the scrub state of a filesystem, Total sums the counters of all devices
+type ScrubProgress struct {
+	Devices []ScrubDevice
+	Total   ScrubCounters
+
+	Err error
+}
+
+// Running reports whether any device is being scrubbed
+func (p *ScrubProgress) Running() bool {
+	for _, device := range p.Devices {
+		if device.Running {
+			return true
+		}
+	}
+	return false
+}
+
+type ScrubStart interface {
+	Path(path string) ScrubStart
+	// Devices limits the scrub to the given device paths or device ids, all devices are scrubbed by default
+	Devices(devices ...string) ScrubStart
+	// ReadOnly only reports the errors without repairing them
+	ReadOnly() ScrubStart
+	// Background returns as soon as the devices are being scrubbed instead of waiting for the end.
+	// The ioctls keep running in goroutines of the caller until the scrub is over, the process
+	// must stay alive and call Wait to learn the device results.
+	Background() ScrubStart
+
+	// Execute scrubs the devices concurrently, the progress of every device is returned
+	// together with the first device error
+	Execute() (*ScrubProgress, error)
+	// Wait blocks until the scrub started by Execute is over and returns the final progress
+	// of every device together with the first device error
+	Wait() (*ScrubProgress, error)
+}
+
+type ScrubStatus interface {
+	Path(path string) ScrubStatus
+	Devices(devices ...string) ScrubStatus
+
+	// Execute returns the progress of the running scrub, devices without a scrub are not running
+	Execute() (*ScrubProgress, error)
+	// Watch sends the progress periodically until the scrub ends or the context is done,
+	// the channel is closed afterwards
+	Watch(ctx context.Context) <-chan ScrubProgress
+}
+
+type ScrubCancel interface {
+	Executor
+
+	Path(path string) ScrubCancel
+}
+
+type Quota interface {
+	Enable() QuotaEnable
+	Disable() QuotaDisable
+	Rescan() QuotaRescan
+	RescanStatus() QuotaRescanStatus
+}
+
+type QuotaEnable interface {
+	Executor
+
+	Path(path string) QuotaEnable
+	// Simple enables simple quotas which account the extents to the subvolume that
+	// created them, it requires kernel 6.7 or newer
+	Simple() QuotaEnable
+}
+
+type QuotaDisable interface {
+	Executor
+
+	Path(path string) QuotaDisable
+}
+
+type QuotaRescan interface {
+	Executor
+
+	Path(path string) QuotaRescan
+	// Wait makes Execute block until the rescan is finished or the context is done
+	Wait(ctx context.Context) QuotaRescan
+}
+
+type QuotaRescanProgress struct {
+	Running bool
+	// Progress is the objectid the rescan has reached
+	Progress uint64
+}
+
+type QuotaRescanStatus interface {
+	Path(path string) QuotaRescanStatus
+
+	Execute() (*QuotaRescanProgress, error)
+	// Wait blocks until the running rescan is finished or the context is done
+	Wait(ctx context.Context) error
+}
+
+// Qgroup ids use the level/id form, e.g. "1/100", a plain number is a level 0 qgroup
+type Qgroup interface {
+	Create() QgroupCreate
+	Destroy() QgroupDestroy
+	Assign() QgroupAssign
+	Remove() QgroupRemove
+	Limit() QgroupLimit
+	Show() QgroupShow
+}
+
+type QgroupCreate interface {
+	Executor
+
+	Path(path string) QgroupCreate
+	ID(qgroupid string) QgroupCreate
+}
+
+type QgroupDestroy interface {
+	Executor
+
+	Path(path string) QgroupDestroy
+	ID(qgroupid string) QgroupDestroy
+}
+
+type QgroupAssign interface {
+	Executor
+
+	Path(path string) QgroupAssign
+	Child(qgroupid string) QgroupAssign
+	// Parent must have a higher level than the child
+	Parent(qgroupid string) QgroupAssign
+	// Rescan starts a quota rescan when the kernel marks the accounting inconsistent
+	Rescan() QgroupAssign
+}
+
+type QgroupRemove interface {
+	Executor
+
+	Path(path string) QgroupRemove
+	Child(qgroupid string) QgroupRemove
+	Parent(qgroupid string) QgroupRemove
+	// Rescan starts a quota rescan when the kernel marks the accounting inconsistent
+	Rescan() QgroupRemove
+}
+
+type QgroupLimit interface {
+	Executor
+
+	Path(path string) QgroupLimit
+	// ID selects the qgroup, the qgroup of the subvolume at path is limited by default
+	ID(qgroupid string) QgroupLimit
+	// Referenced and Exclusive take a size, e.g. 10G, or "none" to remove the limit
+	Referenced(size string) QgroupLimit
+	Exclusive(size string) QgroupLimit
+}
+
+type QgroupInfo struct {
+	// ID is the qgroup id in the level/id form
+	ID    string
+	Level uint16
+	// Path is the subvolume path of a level 0 qgroup relative to the top level subvolume,
+	// "<FS_TREE>" for the top level subvolume and empty if the subvolume was deleted
+	Path string
+
+	Referenced           uint64
+	ReferencedCompressed uint64
+	Exclusive            uint64
+	ExclusiveCompressed  uint64
+
+	// MaxReferenced and MaxExclusive are zero if there is no limit
+	MaxReferenced uint64
+	MaxExclusive  uint64
+
+	Parents  []string
+	Children []string
+}
+
+type QgroupShow interface {
+	Path(path string) QgroupShow
+
+	// FilterLevel limits the qgroups to the given level
+	FilterLevel(level uint16) QgroupShow
+	// FilterPath limits the qgroups to the ones accounting the subvolume at path, including the parents
+	FilterPath() QgroupShow
+	// Sort orders by the comma separated keys qgroupid, rfer, excl, max_rfer, max_excl and path,
+	// a "-" prefix sorts in descending order, e.g. "-excl,qgroupid". The qgroups are sorted by id by default.
+	Sort(order string) QgroupShow
+
+	Execute() ([]QgroupInfo, error)
+}
+
+type Send interface {
+	Executor
+
+	// Subvolume is the read only snapshot to send
+	Subvolume(path string) Send
+	// Parent makes the stream incremental against the read only parent snapshot
+	Parent(path string) Send
+	// CloneSources are read only snapshots whose extents are cloned instead of sent
+	CloneSources(paths ...string) Send
+	// NoFileData sends only the metadata, the write commands carry no data
+	NoFileData() Send
+	// ProtocolVersion selects the stream version, the kernel default is used if not set
+	ProtocolVersion(version uint32) Send
+	// Compressed passes the compressed extents without decompressing them, it requires version 2
+	Compressed() Send
+	// Writer receives the stream, Execute stops the send if writing fails
+	Writer(w io.Writer) Send
+}
+
+type Receive interface {
+	// Destination is the directory the received subvolumes are created in
+	Destination(dir string) Receive
+	// Reader provides the send stream, concatenated streams are received one after another
+	Reader(r io.Reader) Receive
+
+	// Execute returns the paths of the received subvolumes, they are read only and carry
+	// the uuid of the sent subvolume as received uuid.
+	// The parent of an incremental stream must be read only and unchanged since it was sent.
+	// The paths of the stream are resolved without following symlinks, the commands can't change
+	// files outside of the received subvolume.
+	// Compressed data is written as is if the kernel allows it, otherwise only zlib data is
+	// decompressed and streams with zstd or lzo data fail.
+	Execute() ([]string, error)
+}
+
+// ObjectType is the kind of object a property belongs to
+type ObjectType string
+
+const (
+	ObjectSubvol     ObjectType = "subvol"
+	ObjectFilesystem ObjectType = "filesystem"
+	ObjectDevice     ObjectType = "device"
+	ObjectInode      ObjectType = "inode"
+)
+
+type PropertyValue struct {
+	Name  string
+	Value string
+	Type  ObjectType
+}
+
+type PropertyInfo struct {
+	Name        string
+	Description string
+	Type        ObjectType
+}
+
+// Property reads and changes the properties of subvolumes, filesystems, devices and inodes:
+// "ro" of subvolumes, "label" of filesystems and devices and "compression" of files and directories.
+type Property interface {
+	Get() PropertyGet
+	Set() PropertySet
+	List() PropertyList
+}
+
+type PropertyGet interface {
+	// Object is the path of a subvolume, a mount point, a device or any file or directory
+	Object(path string) PropertyGet
+	// Type selects the object type if the path is several objects, it is detected by default
+	Type(objectType ObjectType) PropertyGet
+	// Name selects the property, all properties of the object are returned by default
+	Name(name string) PropertyGet
+
+	Execute() ([]PropertyValue, error)
+}
+
+type PropertySet interface {
+	Executor
+
+	Object(path string) PropertySet
+	Type(objectType ObjectType) PropertySet
+	Name(name string) PropertySet
+	// Value is the new value, an empty compression value resets the compression
+	Value(value string) PropertySet
+	// Force allows to make a received subvolume writable, its received uuid is cleared so it
+	// isn't used as the parent of incremental receives anymore
+	Force() PropertySet
+}
+
+type PropertyList interface {
+	Object(path string) PropertyList
+	Type(objectType ObjectType) PropertyList
+
+	// Execute returns the properties applicable to the object
+	Execute() ([]PropertyInfo, error)
+}
+
+// Inspect maps the inode numbers and logical addresses reported by scrub or the kernel log to paths
+type Inspect interface {
+	InodeResolve() InspectInodeResolve
+	LogicalResolve() InspectLogicalResolve
+}
+
+type InspectInodeResolve interface {
+	// Path is a file or directory in the subvolume containing the inode
+	Path(path string) InspectInodeResolve
+	Inode(inode uint64) InspectInodeResolve
+
+	// Execute returns the absolute paths of all hard links of the inode
+	Execute() ([]string, error)
+}
+
+type LogicalResolveInfo struct {
+	Inode uint64
+	// Offset is the file offset of the logical address
+	Offset uint64
+	// Root is the id of the subvolume containing the inode
+	Root uint64
+	// Subvolume is the path of the subvolume relative to the top level subvolume,
+	// "<FS_TREE>" for the top level subvolume
+	Subvolume string
+	// Paths are the absolute paths of the inode, empty if the subvolume isn't reachable from a mount point
+	Paths []string
+}
+
+type InspectLogicalResolve interface {
+	// Path is any file or directory on the filesystem
+	Path(path string) InspectLogicalResolve
+	Logical(address uint64) InspectLogicalResolve
+	// IgnoreOffset returns all references to the extent instead of the ones containing the address,
+	// the address must be the start of the extent
+	IgnoreOffset() InspectLogicalResolve
+
+	Execute() ([]LogicalResolveInfo, error)
+}
+
 type api struct {
 	apiType ApiType
 }
@@ -126,6 +871,58 @@ func (a *api) Subvolume() Subvolume {
 	return &subvolume{apiType: a.apiType}
 }
 
+func (a *api) Filesystem() Filesystem {
+	return &filesystem{apiType: a.apiType}
+}
+
+func (a *api) Device() Device {
+	return &device{apiType: a.apiType}
+}
+
+func (a *api) Replace() Replace {
+	return &replace{apiType: a.apiType}
+}
+
+func (a *api) Balance() Balance {
+	return &balance{apiType: a.apiType}
+}
+
+func (a *api) Scrub() Scrub {
+	return &scrub{apiType: a.apiType}
+}
+
+func (a *api) Quota() Quota {
+	return &quota{apiType: a.apiType}
+}
+
+func (a *api) Qgroup() Qgroup {
+	return &qgroup{apiType: a.apiType}
+}
+
+func (a *api) Property() Property {
+	return &property{apiType: a.apiType}
+}
+
+func (a *api) Inspect() Inspect {
+	return &inspect{apiType: a.apiType}
+}
+
+func (a *api) Send() Send {
+	cmd, ok := factory(a.apiType, CmdSend).(Send)
+	if !ok {
+		panic("Expected btrfs.Send interface")
+	}
+	return cmd
+}
+
+func (a *api) Receive() Receive {
+	cmd, ok := factory(a.apiType, CmdReceive).(Receive)
+	if !ok {
+		panic("Expected btrfs.Receive interface")
+	}
+	return cmd
+}
+
 type subvolume struct {
 	apiType ApiType
 }
@@ -162,6 +959,322 @@ func (s *subvolume) List() SubvolList {
 	return cmd
 }
 
+func (s *subvolume) Diff() SubvolDiff {
+	cmd, ok := factory(s.apiType, CmdSubvolDiff).(SubvolDiff)
+	if !ok {
+		panic("Expected btrfs.SubvolDiff interface")
+	}
+	return cmd
+}
+
+type filesystem struct {
+	apiType ApiType
+}
+
+func (f *filesystem) Defrag() FsDefrag {
+	cmd, ok := factory(f.apiType, CmdFilesystemDefrag).(FsDefrag)
+	if !ok {
+		panic("Expected btrfs.FsDefrag interface")
+	}
+	return cmd
+}
+
+func (f *filesystem) Resize() FsResize {
+	cmd, ok := factory(f.apiType, CmdFilesystemResize).(FsResize)
+	if !ok {
+		panic("Expected btrfs.FsResize interface")
+	}
+	return cmd
+}
+
+func (f *filesystem) Features() FsFeatures {
+	cmd, ok := factory(f.apiType, CmdFilesystemFeatures).(FsFeatures)
+	if !ok {
+		panic("Expected btrfs.FsFeatures interface")
+	}
+	return cmd
+}
+
+type device struct {
+	apiType ApiType
+}
+
+func (d *device) Add() DevAdd {
+	cmd, ok := factory(d.apiType, CmdDeviceAdd).(DevAdd)
+	if !ok {
+		panic("Expected btrfs.DevAdd interface")
+	}
+	return cmd
+}
+
+func (d *device) Remove() DevRemove {
+	cmd, ok := factory(d.apiType, CmdDeviceRemove).(DevRemove)
+	if !ok {
+		panic("Expected btrfs.DevRemove interface")
+	}
+	return cmd
+}
+
+func (d *device) Stats() DevStats {
+	cmd, ok := factory(d.apiType, CmdDeviceStats).(DevStats)
+	if !ok {
+		panic("Expected btrfs.DevStats interface")
+	}
+	return cmd
+}
+
+func (d *device) Scan() DevScan {
+	cmd, ok := factory(d.apiType, CmdDeviceScan).(DevScan)
+	if !ok {
+		panic("Expected btrfs.DevScan interface")
+	}
+	return cmd
+}
+
+func (d *device) Ready() DevReady {
+	cmd, ok := factory(d.apiType, CmdDeviceReady).(DevReady)
+	if !ok {
+		panic("Expected btrfs.DevReady interface")
+	}
+	return cmd
+}
+
+type replace struct {
+	apiType ApiType
+}
+
+func (r *replace) Start() ReplaceStart {
+	cmd, ok := factory(r.apiType, CmdReplaceStart).(ReplaceStart)
+	if !ok {
+		panic("Expected btrfs.ReplaceStart interface")
+	}
+	return cmd
+}
+
+func (r *replace) Status() ReplaceStatus {
+	cmd, ok := factory(r.apiType, CmdReplaceStatus).(ReplaceStatus)
+	if !ok {
+		panic("Expected btrfs.ReplaceStatus interface")
+	}
+	return cmd
+}
+
+func (r *replace) Cancel() ReplaceCancel {
+	cmd, ok := factory(r.apiType, CmdReplaceCancel).(ReplaceCancel)
+	if !ok {
+		panic("Expected btrfs.ReplaceCancel interface")
+	}
+	return cmd
+}
+
+type balance struct {
+	apiType ApiType
+}
+
+func (b *balance) Start() BalanceStart {
+	cmd, ok := factory(b.apiType, CmdBalanceStart).(BalanceStart)
+	if !ok {
+		panic("Expected btrfs.BalanceStart interface")
+	}
+	return cmd
+}
+
+func (b *balance) Pause() BalancePause {
+	cmd, ok := factory(b.apiType, CmdBalancePause).(BalancePause)
+	if !ok {
+		panic("Expected btrfs.BalancePause interface")
+	}
+	return cmd
+}
+
+func (b *balance) Resume() BalanceResume {
+	cmd, ok := factory(b.apiType, CmdBalanceResume).(BalanceResume)
+	if !ok {
+		panic("Expected btrfs.BalanceResume interface")
+	}
+	return cmd
+}
+
+func (b *balance) Cancel() BalanceCancel {
+	cmd, ok := factory(b.apiType, CmdBalanceCancel).(BalanceCancel)
+	if !ok {
+		panic("Expected btrfs.BalanceCancel interface")
+	}
+	return cmd
+}
+
+func (b *balance) Status() BalanceStatus {
+	cmd, ok := factory(b.apiType, CmdBalanceStatus).(BalanceStatus)
+	if !ok {
+		panic("Expected btrfs.BalanceStatus interface")
+	}
+	return cmd
+}
+
+type scrub struct {
+	apiType ApiType
+}
+
+func (s *scrub) Start() ScrubStart {
+	cmd, ok := factory(s.apiType, CmdScrubStart).(ScrubStart)
+	if !ok {
+		panic("Expected btrfs.ScrubStart interface")
+	}
+	return cmd
+}
+
+func (s *scrub) Status() ScrubStatus {
+	cmd, ok := factory(s.apiType, CmdScrubStatus).(ScrubStatus)
+	if !ok {
+		panic("Expected btrfs.ScrubStatus interface")
+	}
+	return cmd
+}
+
+func (s *scrub) Cancel() ScrubCancel {
+	cmd, ok := factory(s.apiType, CmdScrubCancel).(ScrubCancel)
+	if !ok {
+		panic("Expected btrfs.ScrubCancel interface")
+	}
+	return cmd
+}
+
+type quota struct {
+	apiType ApiType
+}
+
+func (q *quota) Enable() QuotaEnable {
+	cmd, ok := factory(q.apiType, CmdQuotaEnable).(QuotaEnable)
+	if !ok {
+		panic("Expected btrfs.QuotaEnable interface")
+	}
+	return cmd
+}
+
+func (q *quota) Disable() QuotaDisable {
+	cmd, ok := factory(q.apiType, CmdQuotaDisable).(QuotaDisable)
+	if !ok {
+		panic("Expected btrfs.QuotaDisable interface")
+	}
+	return cmd
+}
+
+func (q *quota) Rescan() QuotaRescan {
+	cmd, ok := factory(q.apiType, CmdQuotaRescan).(QuotaRescan)
+	if !ok {
+		panic("Expected btrfs.QuotaRescan interface")
+	}
+	return cmd
+}
+
+func (q *quota) RescanStatus() QuotaRescanStatus {
+	cmd, ok := factory(q.apiType, CmdQuotaRescanStatus).(QuotaRescanStatus)
+	if !ok {
+		panic("Expected btrfs.QuotaRescanStatus interface")
+	}
+	return cmd
+}
+
+type qgroup struct {
+	apiType ApiType
+}
+
+func (q *qgroup) Create() QgroupCreate {
+	cmd, ok := factory(q.apiType, CmdQgroupCreate).(QgroupCreate)
+	if !ok {
+		panic("Expected btrfs.QgroupCreate interface")
+	}
+	return cmd
+}
+
+func (q *qgroup) Destroy() QgroupDestroy {
+	cmd, ok := factory(q.apiType, CmdQgroupDestroy).(QgroupDestroy)
+	if !ok {
+		panic("Expected btrfs.QgroupDestroy interface")
+	}
+	return cmd
+}
+
+func (q *qgroup) Assign() QgroupAssign {
+	cmd, ok := factory(q.apiType, CmdQgroupAssign).(QgroupAssign)
+	if !ok {
+		panic("Expected btrfs.QgroupAssign interface")
+	}
+	return cmd
+}
+
+func (q *qgroup) Remove() QgroupRemove {
+	cmd, ok := factory(q.apiType, CmdQgroupRemove).(QgroupRemove)
+	if !ok {
+		panic("Expected btrfs.QgroupRemove interface")
+	}
+	return cmd
+}
+
+func (q *qgroup) Limit() QgroupLimit {
+	cmd, ok := factory(q.apiType, CmdQgroupLimit).(QgroupLimit)
+	if !ok {
+		panic("Expected btrfs.QgroupLimit interface")
+	}
+	return cmd
+}
+
+func (q *qgroup) Show() QgroupShow {
+	cmd, ok := factory(q.apiType, CmdQgroupShow).(QgroupShow)
+	if !ok {
+		panic("Expected btrfs.QgroupShow interface")
+	}
+	return cmd
+}
+
+type property struct {
+	apiType ApiType
+}
+
+func (p *property) Get() PropertyGet {
+	cmd, ok := factory(p.apiType, CmdPropertyGet).(PropertyGet)
+	if !ok {
+		panic("Expected btrfs.PropertyGet interface")
+	}
+	return cmd
+}
+
+func (p *property) Set() PropertySet {
+	cmd, ok := factory(p.apiType, CmdPropertySet).(PropertySet)
+	if !ok {
+		panic("Expected btrfs.PropertySet interface")
+	}
+	return cmd
+}
+
+func (p *property) List() PropertyList {
+	cmd, ok := factory(p.apiType, CmdPropertyList).(PropertyList)
+	if !ok {
+		panic("Expected btrfs.PropertyList interface")
+	}
+	return cmd
+}
+
+type inspect struct {
+	apiType ApiType
+}
+
+func (i *inspect) InodeResolve() InspectInodeResolve {
+	cmd, ok := factory(i.apiType, CmdInspectInodeResolve).(InspectInodeResolve)
+	if !ok {
+		panic("Expected btrfs.InspectInodeResolve interface")
+	}
+	return cmd
+}
+
+func (i *inspect) LogicalResolve() InspectLogicalResolve {
+	cmd, ok := factory(i.apiType, CmdInspectLogicalResolve).(InspectLogicalResolve)
+	if !ok {
+		panic("Expected btrfs.InspectLogicalResolve interface")
+	}
+	return cmd
+}
+
 func NewIoctl() API {
 	return &api{apiType: IOCTL}
 }
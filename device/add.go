@@ -0,0 +1,105 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/blkdev"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type devAdd struct {
+	path    string
+	devices []string
+	force   bool
+
+	executor func(c *devAdd) error
+}
+
+func (c *devAdd) Path(path string) btrfs.DevAdd {
+	c.path = path
+	return c
+}
+
+func (c *devAdd) Devices(devices ...string) btrfs.DevAdd {
+	for _, device := range devices {
+		c.devices = append(c.devices, device)
+	}
+	return c
+}
+
+func (c *devAdd) Force() btrfs.DevAdd {
+	c.force = true
+	return c
+}
+
+func (c *devAdd) context() string {
+	return fmt.Sprintf("path='%s', devices=%v, force=%v", c.path, c.devices, c.force)
+}
+
+func (c *devAdd) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdDeviceAdd), Context: c.context(), Err: err}
+}
+
+func (c *devAdd) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	if len(c.devices) == 0 {
+		return errors.New("no devices")
+	}
+
+	for _, device := range c.devices {
+		if err := blkdev.CheckUnused(device, c.force); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *devAdd) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlAddExecute(c *devAdd) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	for _, device := range c.devices {
+		err = ioctl.DevAdd(c.path, device)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// btrfs cli executor
+func cliAddExecute(c *devAdd) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlAdd() interface{} {
+	return &devAdd{executor: ioctlAddExecute}
+}
+
+func cliAdd() interface{} {
+	return &devAdd{executor: cliAddExecute}
+}
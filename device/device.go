@@ -0,0 +1,17 @@
+package device
+
+import "github.com/plar/btrfs"
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdDeviceAdd, ioctlAdd)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdDeviceRemove, ioctlRemove)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdDeviceStats, ioctlStats)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdDeviceScan, ioctlScan)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdDeviceReady, ioctlReady)
+
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdDeviceAdd, cliAdd)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdDeviceRemove, cliRemove)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdDeviceStats, cliStats)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdDeviceScan, cliScan)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdDeviceReady, cliReady)
+}
@@ -0,0 +1,215 @@
+package device
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/blkdev"
+	"github.com/plar/btrfs/internal/btrfstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func totalBytes(t *testing.T) uint64 {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(mount, &st)
+	assert.NoError(t, err)
+	return st.Blocks * uint64(st.Bsize)
+}
+
+func TestDevAddValidation(t *testing.T) {
+	dev := btrfs.NewIoctl().Device()
+
+	err := dev.Add().Devices("/dev/null").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = dev.Add().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no devices")
+
+	err = dev.Add().Path(mount).Devices("/dev/null").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "'/dev/null' is not a block device")
+
+	err = dev.Add().Path(mount).Devices(loop.Image).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a block device")
+}
+
+func TestDevRemoveValidation(t *testing.T) {
+	dev := btrfs.NewIoctl().Device()
+
+	err := dev.Remove().Devices("missing").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = dev.Remove().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no devices")
+
+	err = dev.Remove().Path(mount).Devices("0").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "device id must be greater than zero")
+
+	err = dev.Remove().Path(mount).Devices("/dev/does-not-exist").Execute()
+	assert.Error(t, err)
+}
+
+func TestDevAddRemove(t *testing.T) {
+	dev := btrfs.NewIoctl().Device()
+	before := totalBytes(t)
+
+	// devid 2
+	loop1 := loop.NewLoopDevice("dev1.img")
+	err := dev.Add().Path(mount).Devices(loop1).Execute()
+	assert.NoError(t, err)
+	assert.True(t, totalBytes(t) > before)
+
+	ok, err := blkdev.HasBtrfsMagic(loop1)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// the device is a part of the mounted filesystem now
+	err = dev.Add().Path(mount).Devices(loop1).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "contains a btrfs filesystem")
+
+	err = dev.Remove().Path(mount).Devices(loop1).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, before, totalBytes(t))
+
+	// devid 3
+	loop2 := loop.NewLoopDevice("dev2.img")
+	err = dev.Add().Path(mount).Devices(loop2).Execute()
+	assert.NoError(t, err)
+
+	err = dev.Remove().Path(mount).Devices("3").Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, before, totalBytes(t))
+}
+
+func TestDevAddForce(t *testing.T) {
+	dev := btrfs.NewIoctl().Device()
+
+	device := loop.NewLoopDevice("foreign.img")
+	err := btrfstest.Run("mkfs.btrfs", device)
+	assert.NoError(t, err)
+
+	err = dev.Add().Path(mount).Devices(device).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "contains a btrfs filesystem, use force to overwrite")
+
+	err = dev.Add().Path(mount).Devices(device).Force().Execute()
+	assert.NoError(t, err)
+
+	err = dev.Remove().Path(mount).Devices(device).Execute()
+	assert.NoError(t, err)
+}
+
+func TestDevStats(t *testing.T) {
+	dev := btrfs.NewIoctl().Device()
+
+	_, err := dev.Stats().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	stats, err := dev.Stats().Path(mount).Execute()
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, uint64(1), stats[0].DevID)
+	assert.NotEmpty(t, stats[0].Path)
+	assert.False(t, stats[0].HasErrors())
+
+	stats, err = dev.Stats().Path(mount).Devices("1").Reset().Execute()
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+
+	stats, err = dev.Stats().Path(mount).Devices(stats[0].Path).Execute()
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+
+	_, err = dev.Stats().Path(mount).Devices("42").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "device '42' is not part of")
+
+	// no partial stats
+	_, err = dev.Stats().Path(mount).Devices("1", "/dev/missing").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "device '/dev/missing' is not part of")
+}
+
+func TestDevScanValidation(t *testing.T) {
+	dev := btrfs.NewIoctl().Device()
+
+	_, err := dev.Scan().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no devices")
+
+	_, err = dev.Scan().All().Devices("/dev/loop0").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "devices cannot be combined with all")
+
+	_, err = dev.Scan().All().Forget().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "forget cannot be combined with all")
+
+	_, err = dev.Ready().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "device is empty")
+
+	_, err = dev.Ready().Device("/dev/null").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a block device")
+}
+
+func TestDevScanReady(t *testing.T) {
+	dev := btrfs.NewIoctl().Device()
+
+	loop1 := loop.NewLoopDevice("raid1.img")
+	loop2 := loop.NewLoopDevice("raid2.img")
+	err := btrfstest.Run("mkfs.btrfs", "-d", "single", "-m", "single", loop1, loop2)
+	assert.NoError(t, err)
+
+	// mkfs.btrfs registered both devices, forget them without touching other devices of the host
+	_, err = dev.Scan().Devices(loop1, loop2).Forget().Execute()
+	assert.NoError(t, err)
+
+	// the second device is not registered yet
+	ready, err := dev.Ready().Device(loop1).Execute()
+	assert.NoError(t, err)
+	assert.False(t, ready)
+
+	scanned, err := dev.Scan().Devices(loop2).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{loop2}, scanned)
+
+	ready, err = dev.Ready().Device(loop1).Execute()
+	assert.NoError(t, err)
+	assert.True(t, ready)
+
+	_, err = dev.Scan().Devices(loop1, loop2).Forget().Execute()
+	assert.NoError(t, err)
+
+	scanned, err = dev.Scan().All().Execute()
+	assert.NoError(t, err)
+	assert.Contains(t, scanned, loop1)
+	assert.Contains(t, scanned, loop2)
+
+	ready, err = dev.Ready().Device(loop2).Execute()
+	assert.NoError(t, err)
+	assert.True(t, ready)
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
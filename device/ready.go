@@ -0,0 +1,75 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/blkdev"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type devReady struct {
+	device string
+
+	executor func(c *devReady) (bool, error)
+}
+
+func (c *devReady) Device(device string) btrfs.DevReady {
+	c.device = device
+	return c
+}
+
+func (c *devReady) context() string {
+	return fmt.Sprintf("device='%s'", c.device)
+}
+
+func (c *devReady) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdDeviceReady), Context: c.context(), Err: err}
+}
+
+func (c *devReady) validate() error {
+	if len(c.device) == 0 {
+		return errors.New("device is empty")
+	}
+
+	if ok, err := blkdev.IsBlockDevice(c.device); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("'%s' is not a block device", c.device)
+	}
+
+	return nil
+}
+
+func (c *devReady) Execute() (bool, error) {
+	ready, err := c.executor(c)
+	if err != nil {
+		return false, c.error(err)
+	}
+	return ready, nil
+}
+
+// btrfs ioctl executor
+func ioctlReadyExecute(c *devReady) (bool, error) {
+	err := c.validate()
+	if err != nil {
+		return false, err
+	}
+
+	return ioctl.DevReady(c.device)
+}
+
+// btrfs cli executor
+func cliReadyExecute(c *devReady) (bool, error) {
+	return false, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlReady() interface{} {
+	return &devReady{executor: ioctlReadyExecute}
+}
+
+func cliReady() interface{} {
+	return &devReady{executor: cliReadyExecute}
+}
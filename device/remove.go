@@ -0,0 +1,123 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+const missing = "missing"
+
+type devRemove struct {
+	path    string
+	devices []string
+
+	executor func(c *devRemove) error
+}
+
+func (c *devRemove) Path(path string) btrfs.DevRemove {
+	c.path = path
+	return c
+}
+
+func (c *devRemove) Devices(devices ...string) btrfs.DevRemove {
+	for _, device := range devices {
+		c.devices = append(c.devices, device)
+	}
+	return c
+}
+
+func (c *devRemove) context() string {
+	return fmt.Sprintf("path='%s', devices=%v", c.path, c.devices)
+}
+
+func (c *devRemove) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdDeviceRemove), Context: c.context(), Err: err}
+}
+
+// devid returns the device id if the device is given by id
+func devid(device string) (uint64, bool) {
+	id, err := strconv.ParseUint(device, 10, 64)
+	return id, err == nil
+}
+
+func (c *devRemove) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	if len(c.devices) == 0 {
+		return errors.New("no devices")
+	}
+
+	for _, device := range c.devices {
+		if device == missing {
+			continue
+		}
+
+		if id, ok := devid(device); ok {
+			if id == 0 {
+				return errors.New("device id must be greater than zero")
+			}
+			continue
+		}
+
+		if _, err := os.Stat(device); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *devRemove) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlRemoveExecute(c *devRemove) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	for _, device := range c.devices {
+		if id, ok := devid(device); ok {
+			err = ioctl.DevRemoveById(c.path, id)
+		} else {
+			err = ioctl.DevRemove(c.path, device)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// btrfs cli executor
+func cliRemoveExecute(c *devRemove) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlRemove() interface{} {
+	return &devRemove{executor: ioctlRemoveExecute}
+}
+
+func cliRemove() interface{} {
+	return &devRemove{executor: cliRemoveExecute}
+}
@@ -0,0 +1,128 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/blkdev"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type devScan struct {
+	devices []string
+	all     bool
+	forget  bool
+
+	executor func(c *devScan) ([]string, error)
+}
+
+func (c *devScan) Devices(devices ...string) btrfs.DevScan {
+	for _, device := range devices {
+		c.devices = append(c.devices, device)
+	}
+	return c
+}
+
+func (c *devScan) All() btrfs.DevScan {
+	c.all = true
+	return c
+}
+
+func (c *devScan) Forget() btrfs.DevScan {
+	c.forget = true
+	return c
+}
+
+func (c *devScan) context() string {
+	return fmt.Sprintf("devices=%v, all=%v, forget=%v", c.devices, c.all, c.forget)
+}
+
+func (c *devScan) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdDeviceScan), Context: c.context(), Err: err}
+}
+
+func (c *devScan) validate() error {
+	if c.all && len(c.devices) > 0 {
+		return errors.New("devices cannot be combined with all")
+	}
+
+	if c.all && c.forget {
+		return errors.New("forget cannot be combined with all")
+	}
+
+	if !c.all && !c.forget && len(c.devices) == 0 {
+		return errors.New("no devices")
+	}
+
+	return nil
+}
+
+func (c *devScan) Execute() ([]string, error) {
+	devices, err := c.executor(c)
+	if err != nil {
+		return devices, c.error(err)
+	}
+	return devices, nil
+}
+
+// btrfs ioctl executor
+func ioctlScanExecute(c *devScan) ([]string, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.forget {
+		if len(c.devices) == 0 {
+			return nil, ioctl.DevForget("")
+		}
+
+		for _, device := range c.devices {
+			if err := ioctl.DevForget(device); err != nil {
+				return nil, err
+			}
+		}
+		return c.devices, nil
+	}
+
+	devices := c.devices
+	if c.all {
+		candidates, err := blkdev.BlockDevices()
+		if err != nil {
+			return nil, err
+		}
+
+		devices = nil
+		for _, device := range candidates {
+			// unreadable devices such as empty cd-rom drives are skipped
+			if ok, err := blkdev.HasBtrfsMagic(device); err == nil && ok {
+				devices = append(devices, device)
+			}
+		}
+	}
+
+	var scanned []string
+	for _, device := range devices {
+		if err := ioctl.DevScan(device); err != nil {
+			return scanned, err
+		}
+		scanned = append(scanned, device)
+	}
+
+	return scanned, nil
+}
+
+// btrfs cli executor
+func cliScanExecute(c *devScan) ([]string, error) {
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlScan() interface{} {
+	return &devScan{executor: ioctlScanExecute}
+}
+
+func cliScan() interface{} {
+	return &devScan{executor: cliScanExecute}
+}
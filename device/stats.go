@@ -0,0 +1,131 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type devStats struct {
+	path    string
+	devices []string
+	reset   bool
+
+	executor func(c *devStats) ([]btrfs.DevStatsInfo, error)
+}
+
+func (c *devStats) Path(path string) btrfs.DevStats {
+	c.path = path
+	return c
+}
+
+func (c *devStats) Devices(devices ...string) btrfs.DevStats {
+	for _, device := range devices {
+		c.devices = append(c.devices, device)
+	}
+	return c
+}
+
+func (c *devStats) Reset() btrfs.DevStats {
+	c.reset = true
+	return c
+}
+
+func (c *devStats) context() string {
+	return fmt.Sprintf("path='%s', devices=%v, reset=%v", c.path, c.devices, c.reset)
+}
+
+func (c *devStats) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdDeviceStats), Context: c.context(), Err: err}
+}
+
+func (c *devStats) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+// selectDevices returns the requested devices by path or id, all devices by default
+func (c *devStats) selectDevices(infos []ioctl.DevInfo) ([]ioctl.DevInfo, error) {
+	if len(c.devices) == 0 {
+		return infos, nil
+	}
+
+	var selected []ioctl.DevInfo
+	for _, device := range c.devices {
+		info, ok := ioctl.FindDevInfo(infos, device)
+		if !ok {
+			return nil, fmt.Errorf("device '%s' is not part of '%s'", device, c.path)
+		}
+		selected = append(selected, info)
+	}
+	return selected, nil
+}
+
+func (c *devStats) Execute() ([]btrfs.DevStatsInfo, error) {
+	stats, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return stats, nil
+}
+
+// btrfs ioctl executor
+func ioctlStatsExecute(c *devStats) ([]btrfs.DevStatsInfo, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := ioctl.GetDevInfos(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := c.selectDevices(infos)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []btrfs.DevStatsInfo
+	for _, info := range devices {
+		ds, err := ioctl.GetDevStats(c.path, info.DevId, c.reset)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, btrfs.DevStatsInfo{
+			DevID:          info.DevId,
+			Path:           info.Path,
+			WriteErrs:      ds.WriteErrs,
+			ReadErrs:       ds.ReadErrs,
+			FlushErrs:      ds.FlushErrs,
+			CorruptionErrs: ds.CorruptionErrs,
+			GenerationErrs: ds.GenerationErrs,
+		})
+	}
+
+	return stats, nil
+}
+
+// btrfs cli executor
+func cliStatsExecute(c *devStats) ([]btrfs.DevStatsInfo, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlStats() interface{} {
+	return &devStats{executor: ioctlStatsExecute}
+}
+
+func cliStats() interface{} {
+	return &devStats{executor: cliStatsExecute}
+}
@@ -0,0 +1,181 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+var compressionTypes = map[string]uint32{
+	"":     ioctl.CompressNone,
+	"zlib": ioctl.CompressZlib,
+	"lzo":  ioctl.CompressLzo,
+	"zstd": ioctl.CompressZstd,
+}
+
+type fsDefrag struct {
+	path         string
+	start        uint64
+	length       uint64
+	extentThresh uint32
+	compression  string
+	flush        bool
+	recursive    bool
+
+	executor func(c *fsDefrag) ([]btrfs.FsDefragError, error)
+}
+
+func (c *fsDefrag) Path(path string) btrfs.FsDefrag {
+	c.path = path
+	return c
+}
+
+func (c *fsDefrag) Range(start, length uint64) btrfs.FsDefrag {
+	c.start = start
+	c.length = length
+	return c
+}
+
+func (c *fsDefrag) ExtentThreshold(threshold uint32) btrfs.FsDefrag {
+	c.extentThresh = threshold
+	return c
+}
+
+func (c *fsDefrag) Compression(algo string) btrfs.FsDefrag {
+	c.compression = algo
+	return c
+}
+
+func (c *fsDefrag) Flush() btrfs.FsDefrag {
+	c.flush = true
+	return c
+}
+
+func (c *fsDefrag) Recursive() btrfs.FsDefrag {
+	c.recursive = true
+	return c
+}
+
+func (c *fsDefrag) context() string {
+	return fmt.Sprintf("path='%s', start=%d, len=%d, thresh=%d, compress='%s', flush=%v, recursive=%v",
+		c.path, c.start, c.length, c.extentThresh, c.compression, c.flush, c.recursive)
+}
+
+func (c *fsDefrag) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdFilesystemDefrag), Context: c.context(), Err: err}
+}
+
+func (c *fsDefrag) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	if len(c.compression) > 0 {
+		algorithm, level, err := validators.ParseCompression(c.compression)
+		if err != nil {
+			return err
+		}
+		// the defragment ioctl takes the algorithm only
+		if _, ok := compressionTypes[algorithm]; !ok || level > 0 {
+			return fmt.Errorf("invalid defragment compression '%s', expected zlib, lzo or zstd", c.compression)
+		}
+	}
+
+	return nil
+}
+
+func (c *fsDefrag) Execute() ([]btrfs.FsDefragError, error) {
+	failed, err := c.executor(c)
+	if err != nil {
+		return failed, c.error(err)
+	}
+	return failed, nil
+}
+
+// btrfs ioctl executor
+func ioctlDefragExecute(c *fsDefrag) ([]btrfs.FsDefragError, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	compress := compressionTypes[c.compression]
+
+	defrag := func(path string) error {
+		return ioctl.Defrag(path, c.start, c.length, c.extentThresh, compress, c.flush)
+	}
+
+	if !c.recursive || !fi.IsDir() {
+		if err := defrag(c.path); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	var failed []btrfs.FsDefragError
+	err = filepath.Walk(c.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			failed = append(failed, btrfs.FsDefragError{Path: path, Err: err})
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			// do not descend into nested subvolumes
+			if path != c.path {
+				if subvol, err := ioctl.TestIsSubvolume(path); err != nil {
+					failed = append(failed, btrfs.FsDefragError{Path: path, Err: err})
+					return filepath.SkipDir
+				} else if subvol {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if err := defrag(path); err != nil {
+			failed = append(failed, btrfs.FsDefragError{Path: path, Err: err})
+		}
+		return nil
+	})
+	if err != nil {
+		return failed, err
+	}
+
+	return failed, nil
+}
+
+// btrfs cli executor
+func cliDefragExecute(c *fsDefrag) ([]btrfs.FsDefragError, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlDefrag() interface{} {
+	return &fsDefrag{executor: ioctlDefragExecute}
+}
+
+func cliDefrag() interface{} {
+	return &fsDefrag{executor: cliDefragExecute}
+}
@@ -0,0 +1,133 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type fsFeatures struct {
+	path   string
+	enable []string
+
+	executor func(c *fsFeatures) ([]btrfs.FsFeature, error)
+}
+
+func (c *fsFeatures) Path(path string) btrfs.FsFeatures {
+	c.path = path
+	return c
+}
+
+func (c *fsFeatures) Enable(names ...string) btrfs.FsFeatures {
+	for _, name := range names {
+		c.enable = append(c.enable, name)
+	}
+	return c
+}
+
+func (c *fsFeatures) context() string {
+	return fmt.Sprintf("path='%s', enable=%v", c.path, c.enable)
+}
+
+func (c *fsFeatures) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdFilesystemFeatures), Context: c.context(), Err: err}
+}
+
+func (c *fsFeatures) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	for _, name := range c.enable {
+		if _, ok := findFeature(name); !ok {
+			return fmt.Errorf("unknown feature '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+func (c *fsFeatures) Execute() ([]btrfs.FsFeature, error) {
+	features, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return features, nil
+}
+
+func findFeature(name string) (ioctl.Feature, bool) {
+	for _, feature := range ioctl.Features {
+		if feature.Name == name {
+			return feature, true
+		}
+	}
+	return ioctl.Feature{}, false
+}
+
+// btrfs ioctl executor
+func ioctlFeaturesExecute(c *fsFeatures) ([]btrfs.FsFeature, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	supported, safeSet, _, err := ioctl.GetSupportedFeatures(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.enable) > 0 {
+		var flags ioctl.FeatureFlags
+		for _, name := range c.enable {
+			feature, _ := findFeature(name)
+			if !safeSet.Has(feature) {
+				return nil, fmt.Errorf("feature '%s' cannot be enabled on a mounted filesystem", name)
+			}
+			flags.Set(feature)
+		}
+
+		err = ioctl.SetFeatures(c.path, flags, flags)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	enabled, err := ioctl.GetFeatures(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var features []btrfs.FsFeature
+	for _, feature := range ioctl.Features {
+		features = append(features, btrfs.FsFeature{
+			Name:      feature.Name,
+			Kind:      feature.Kind.String(),
+			Enabled:   enabled.Has(feature),
+			Supported: supported.Has(feature),
+			Settable:  safeSet.Has(feature),
+		})
+	}
+
+	return features, nil
+}
+
+// btrfs cli executor
+func cliFeaturesExecute(c *fsFeatures) ([]btrfs.FsFeature, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlFeatures() interface{} {
+	return &fsFeatures{executor: ioctlFeaturesExecute}
+}
+
+func cliFeatures() interface{} {
+	return &fsFeatures{executor: cliFeaturesExecute}
+}
@@ -0,0 +1,13 @@
+package filesystem
+
+import "github.com/plar/btrfs"
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdFilesystemDefrag, ioctlDefrag)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdFilesystemResize, ioctlResize)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdFilesystemFeatures, ioctlFeatures)
+
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdFilesystemDefrag, cliDefrag)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdFilesystemResize, cliResize)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdFilesystemFeatures, cliFeatures)
+}
@@ -0,0 +1,204 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	"github.com/plar/btrfs/ioctl"
+	_ "github.com/plar/btrfs/subvolume"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func TestFsDefragValidation(t *testing.T) {
+	fs := btrfs.NewIoctl().Filesystem()
+
+	_, err := fs.Defrag().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = fs.Defrag().Path(mount).Compression("gzip").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown compression algorithm 'gzip'")
+
+	for _, compression := range []string{"zstd:3", "none"} {
+		_, err = fs.Defrag().Path(mount).Compression(compression).Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid defragment compression")
+	}
+}
+
+func TestFsDefrag(t *testing.T) {
+	file := filepath.Join(mount, "defrag.img")
+	err := ioutil.WriteFile(file, make([]byte, 1024*1024), 0600)
+	assert.NoError(t, err)
+
+	fs := btrfs.NewIoctl().Filesystem()
+	failed, err := fs.Defrag().Path(file).Compression("zstd").Flush().Execute()
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+
+	failed, err = fs.Defrag().Path(file).Range(4096, 65536).ExtentThreshold(1).Execute()
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+}
+
+func TestFsDefragRecursive(t *testing.T) {
+	repo := filepath.Join(mount, "repo_TestFsDefragRecursive")
+
+	subvol := btrfs.NewIoctl().Subvolume()
+	err := subvol.Create().Destination(repo).Execute()
+	assert.NoError(t, err)
+
+	err = os.MkdirAll(filepath.Join(repo, "a/b"), 0700)
+	assert.NoError(t, err)
+	for _, name := range []string{"1.img", "a/2.img", "a/b/3.img"} {
+		err = ioutil.WriteFile(filepath.Join(repo, name), make([]byte, 64*1024), 0600)
+		assert.NoError(t, err)
+	}
+
+	err = subvol.Create().Destination(filepath.Join(repo, "nested")).Execute()
+	assert.NoError(t, err)
+
+	failed, err := btrfs.NewIoctl().Filesystem().Defrag().Path(repo).Recursive().Compression("lzo").Execute()
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+}
+
+func TestFsResizeValidation(t *testing.T) {
+	fs := btrfs.NewIoctl().Filesystem()
+
+	err := fs.Resize().Size("1G").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = fs.Resize().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "size is empty")
+
+	err = fs.Resize().Path(mount).DeviceID(0).Size("1G").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "device id must be greater than zero")
+
+	for _, size := range []string{"1X", "+", "--1G", "maximum"} {
+		err = fs.Resize().Path(mount).Size(size).Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid size", size)
+	}
+
+	err = fs.Resize().Path(mount).Size("+0").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must be greater than zero")
+}
+
+func TestFsResize(t *testing.T) {
+	fs := btrfs.NewIoctl().Filesystem()
+
+	total := func() uint64 {
+		var st syscall.Statfs_t
+		err := syscall.Statfs(mount, &st)
+		assert.NoError(t, err)
+		return st.Blocks * uint64(st.Bsize)
+	}
+
+	before := total()
+
+	err := fs.Resize().Path(mount).Size("-256M").Execute()
+	assert.NoError(t, err)
+	assert.True(t, total() < before)
+
+	err = fs.Resize().Path(mount).DeviceID(1).Size("max").Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, before, total())
+
+	err = fs.Resize().Path(mount).Size("900M").Execute()
+	assert.NoError(t, err)
+
+	err = fs.Resize().Path(mount).Size("+100M").Execute()
+	assert.NoError(t, err)
+}
+
+func TestFsFeaturesValidation(t *testing.T) {
+	fs := btrfs.NewIoctl().Filesystem()
+
+	_, err := fs.Features().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = fs.Features().Path(mount).Enable("no_holes", "dedup").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown feature 'dedup'")
+}
+
+func TestFsFeatures(t *testing.T) {
+	fs := btrfs.NewIoctl().Filesystem()
+
+	features, err := fs.Features().Path(mount).Execute()
+	assert.NoError(t, err)
+
+	byName := make(map[string]btrfs.FsFeature)
+	for _, feature := range features {
+		byName[feature.Name] = feature
+	}
+
+	assert.True(t, byName["mixed_backref"].Enabled)
+	assert.True(t, byName["mixed_backref"].Supported)
+	assert.Equal(t, "incompat", byName["no_holes"].Kind)
+	assert.Equal(t, "compat_ro", byName["free_space_tree"].Kind)
+
+	if byName["no_holes"].Settable {
+		features, err = fs.Features().Path(mount).Enable("no_holes").Execute()
+		assert.NoError(t, err)
+		for _, feature := range features {
+			if feature.Name == "no_holes" {
+				assert.True(t, feature.Enabled)
+			}
+		}
+	}
+}
+
+func TestFsFeaturesClear(t *testing.T) {
+	enabled, err := ioctl.GetFeatures(mount)
+	assert.NoError(t, err)
+	_, _, safeClear, err := ioctl.GetSupportedFeatures(mount)
+	assert.NoError(t, err)
+
+	for _, feature := range ioctl.Features {
+		if !enabled.Has(feature) {
+			continue
+		}
+
+		// the flags are zero, only the mask selects the feature
+		var mask ioctl.FeatureFlags
+		mask.Set(feature)
+		err = ioctl.SetFeatures(mount, ioctl.FeatureFlags{}, mask)
+
+		features, getErr := ioctl.GetFeatures(mount)
+		assert.NoError(t, getErr)
+		if safeClear.Has(feature) {
+			assert.NoError(t, err, feature.Name)
+			assert.False(t, features.Has(feature), feature.Name)
+			assert.NoError(t, ioctl.SetFeatures(mount, mask, mask), feature.Name)
+		} else {
+			// the kernel refuses to clear it and keeps it enabled
+			assert.Error(t, err, feature.Name)
+			assert.True(t, features.Has(feature), feature.Name)
+		}
+	}
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,126 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+type fsResize struct {
+	path  string
+	devid uint64
+	size  string
+
+	executor func(c *fsResize) error
+}
+
+func (c *fsResize) Path(path string) btrfs.FsResize {
+	c.path = path
+	return c
+}
+
+func (c *fsResize) DeviceID(devid uint64) btrfs.FsResize {
+	c.devid = devid
+	return c
+}
+
+func (c *fsResize) Size(size string) btrfs.FsResize {
+	c.size = size
+	return c
+}
+
+func (c *fsResize) context() string {
+	return fmt.Sprintf("path='%s', devid=%d, size='%s'", c.path, c.devid, c.size)
+}
+
+func (c *fsResize) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdFilesystemResize), Context: c.context(), Err: err}
+}
+
+// amount converts the size to the kernel resize string
+func (c *fsResize) amount() (string, error) {
+	if len(c.size) == 0 {
+		return "", errors.New("size is empty")
+	}
+
+	if c.size == "max" {
+		return c.size, nil
+	}
+
+	var sign string
+	size := c.size
+	if size[0] == '+' || size[0] == '-' {
+		sign = size[:1]
+		size = size[1:]
+	}
+
+	if len(size) == 0 {
+		return "", fmt.Errorf("invalid size '%s'", c.size)
+	}
+
+	n, err := validators.ParseSize(size)
+	if err != nil {
+		return "", err
+	}
+
+	if n == 0 {
+		return "", fmt.Errorf("invalid size '%s', must be greater than zero", c.size)
+	}
+
+	return sign + strconv.FormatUint(n, 10), nil
+}
+
+func (c *fsResize) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	if c.devid == 0 {
+		return errors.New("device id must be greater than zero")
+	}
+
+	_, err := c.amount()
+	return err
+}
+
+func (c *fsResize) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlResizeExecute(c *fsResize) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	amount, _ := c.amount()
+	return ioctl.Resize(c.path, c.devid, amount)
+}
+
+// btrfs cli executor
+func cliResizeExecute(c *fsResize) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlResize() interface{} {
+	return &fsResize{devid: 1, executor: ioctlResizeExecute}
+}
+
+func cliResize() interface{} {
+	return &fsResize{devid: 1, executor: cliResizeExecute}
+}
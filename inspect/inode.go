@@ -0,0 +1,95 @@
+package inspect
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type inodeResolve struct {
+	path  string
+	inode uint64
+
+	executor func(c *inodeResolve) ([]string, error)
+}
+
+func (c *inodeResolve) Path(path string) btrfs.InspectInodeResolve {
+	c.path = path
+	return c
+}
+
+func (c *inodeResolve) Inode(inode uint64) btrfs.InspectInodeResolve {
+	c.inode = inode
+	return c
+}
+
+func (c *inodeResolve) context() string {
+	return fmt.Sprintf("path='%s', inode=%d", c.path, c.inode)
+}
+
+func (c *inodeResolve) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdInspectInodeResolve), Context: c.context(), Err: err}
+}
+
+func (c *inodeResolve) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	if c.inode == 0 {
+		return errors.New("inode is not set")
+	}
+	return nil
+}
+
+func (c *inodeResolve) Execute() ([]string, error) {
+	paths, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return paths, nil
+}
+
+// btrfs ioctl executor
+func ioctlInodeResolveExecute(c *inodeResolve) ([]string, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	subvols, err := newSubvolumes(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := ioctl.GetRootId(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	subvol, ok := subvols.mounted(root)
+	if !ok {
+		return nil, fmt.Errorf("subvolume %d of '%s' is not below the mount point '%s'", root, c.path, subvols.mount.Point)
+	}
+	return inodePaths(subvol, c.inode)
+}
+
+// btrfs cli executor
+func cliInodeResolveExecute(c *inodeResolve) ([]string, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlInodeResolve() interface{} {
+	return &inodeResolve{executor: ioctlInodeResolveExecute}
+}
+
+func cliInodeResolve() interface{} {
+	return &inodeResolve{executor: cliInodeResolveExecute}
+}
@@ -0,0 +1,77 @@
+package inspect
+
+import (
+	"path/filepath"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/mountinfo"
+	"github.com/plar/btrfs/ioctl"
+)
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdInspectInodeResolve, ioctlInodeResolve)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdInspectInodeResolve, cliInodeResolve)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdInspectLogicalResolve, ioctlLogicalResolve)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdInspectLogicalResolve, cliLogicalResolve)
+}
+
+// the top level subvolume has no path in the subvolume listing
+const (
+	fsTreeObjectId = 5
+	fsTreePath     = "<FS_TREE>"
+)
+
+// subvolumes maps the subvolumes of a mounted filesystem to paths
+type subvolumes struct {
+	mount *mountinfo.Mount
+	// paths are the subvolume paths relative to the top level subvolume
+	paths map[uint64]string
+}
+
+// newSubvolumes lists the subvolumes of the btrfs filesystem containing path
+func newSubvolumes(path string) (*subvolumes, error) {
+	m, err := mountinfo.FindBtrfs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ioctl.SubvolList(m.Point)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &subvolumes{mount: m, paths: map[uint64]string{fsTreeObjectId: ""}}
+	for _, r := range list {
+		s.paths[r.Id] = r.Path
+	}
+	return s, nil
+}
+
+// name returns the path of the subvolume relative to the top level subvolume
+func (s *subvolumes) name(id uint64) string {
+	if id == fsTreeObjectId {
+		return fsTreePath
+	}
+	return s.paths[id]
+}
+
+// mounted returns the absolute path of the subvolume, false if it isn't below the mount point
+func (s *subvolumes) mounted(id uint64) (string, bool) {
+	p, ok := s.paths[id]
+	if !ok {
+		return "", false
+	}
+	return s.mount.SubvolPath(p)
+}
+
+// inodePaths returns the absolute paths of the inode of the mounted subvolume
+func inodePaths(subvol string, inode uint64) ([]string, error) {
+	paths, err := ioctl.InoPaths(subvol, inode)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range paths {
+		paths[i] = filepath.Join(subvol, p)
+	}
+	return paths, nil
+}
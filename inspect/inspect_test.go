@@ -0,0 +1,167 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	"github.com/plar/btrfs/internal/mountinfo"
+	_ "github.com/plar/btrfs/subvolume"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+const (
+	fsIocFiemap   = 0xc020660b
+	fiemapSync    = 0x1
+	fiemapHdrSize = 32
+	fiemapExtSize = 56
+)
+
+// physical returns the logical btrfs address of the first extent of the file
+func physical(t *testing.T, path string) uint64 {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	buf := make([]byte, fiemapHdrSize+fiemapExtSize)
+	binary.LittleEndian.PutUint64(buf[8:], ^uint64(0))
+	binary.LittleEndian.PutUint32(buf[16:], fiemapSync)
+	binary.LittleEndian.PutUint32(buf[24:], 1)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		t.Fatalf("fiemap '%s': %v", path, errno)
+	}
+	if binary.LittleEndian.Uint32(buf[20:]) == 0 {
+		t.Fatalf("'%s' has no extents", path)
+	}
+	return binary.LittleEndian.Uint64(buf[fiemapHdrSize+8:])
+}
+
+func inode(t *testing.T, path string) uint64 {
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	return fi.Sys().(*syscall.Stat_t).Ino
+}
+
+func TestSubvolumes(t *testing.T) {
+	s := &subvolumes{mount: &mountinfo.Mount{Root: "/", Point: "/mnt"}, paths: map[uint64]string{5: "", 256: "a", 257: "a/b", 258: "c"}}
+	assert.Equal(t, fsTreePath, s.name(5))
+	assert.Equal(t, "a/b", s.name(257))
+
+	p, ok := s.mounted(5)
+	assert.True(t, ok)
+	assert.Equal(t, "/mnt", p)
+	p, ok = s.mounted(257)
+	assert.True(t, ok)
+	assert.Equal(t, "/mnt/a/b", p)
+	_, ok = s.mounted(300)
+	assert.False(t, ok)
+
+	s.mount.Root = "/a"
+	p, ok = s.mounted(256)
+	assert.True(t, ok)
+	assert.Equal(t, "/mnt", p)
+	p, ok = s.mounted(257)
+	assert.True(t, ok)
+	assert.Equal(t, "/mnt/b", p)
+	_, ok = s.mounted(5)
+	assert.False(t, ok)
+	_, ok = s.mounted(258)
+	assert.False(t, ok)
+}
+
+func TestValidation(t *testing.T) {
+	_, err := btrfs.NewIoctl().Inspect().InodeResolve().Inode(256).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = btrfs.NewIoctl().Inspect().InodeResolve().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "inode is not set")
+
+	_, err = btrfs.NewIoctl().Inspect().LogicalResolve().Logical(4096).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+}
+
+func TestInodeResolve(t *testing.T) {
+	subvol := filepath.Join(mount, "inode-subvol")
+	err := btrfs.NewIoctl().Subvolume().Create().Destination(subvol).Execute()
+	assert.NoError(t, err)
+
+	file := filepath.Join(subvol, "file")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("inode"), 0600))
+	assert.NoError(t, os.Mkdir(filepath.Join(subvol, "dir"), 0700))
+	assert.NoError(t, os.Link(file, filepath.Join(subvol, "dir", "link")))
+
+	paths, err := btrfs.NewIoctl().Inspect().InodeResolve().Path(filepath.Join(subvol, "dir")).Inode(inode(t, file)).Execute()
+	assert.NoError(t, err)
+	sort.Strings(paths)
+	assert.Equal(t, []string{filepath.Join(subvol, "dir", "link"), file}, paths)
+
+	// the inode numbers are per subvolume
+	paths, err = btrfs.NewIoctl().Inspect().InodeResolve().Path(mount).Inode(256).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{mount}, paths)
+
+	_, err = btrfs.NewIoctl().Inspect().InodeResolve().Path(subvol).Inode(1 << 40).Execute()
+	assert.Error(t, err)
+}
+
+func TestLogicalResolve(t *testing.T) {
+	subvol := filepath.Join(mount, "logical-subvol")
+	err := btrfs.NewIoctl().Subvolume().Create().Destination(subvol).Execute()
+	assert.NoError(t, err)
+
+	file := filepath.Join(subvol, "file")
+	assert.NoError(t, ioutil.WriteFile(file, bytes.Repeat([]byte("logical"), 64*1024), 0600))
+	logical := physical(t, file)
+
+	snap := filepath.Join(mount, "logical-snap")
+	err = btrfs.NewIoctl().Subvolume().Snapshot().Source(subvol).Destination(snap).Execute()
+	assert.NoError(t, err)
+
+	infos, err := btrfs.NewIoctl().Inspect().LogicalResolve().Path(mount).Logical(logical + 4096).Execute()
+	assert.NoError(t, err)
+	byPath := map[string]btrfs.LogicalResolveInfo{}
+	for _, info := range infos {
+		assert.Equal(t, inode(t, file), info.Inode)
+		for _, p := range info.Paths {
+			byPath[p] = info
+		}
+	}
+	if assert.Len(t, byPath, 2) {
+		assert.Equal(t, "logical-subvol", byPath[file].Subvolume)
+		assert.Equal(t, uint64(4096), byPath[file].Offset)
+		assert.Equal(t, "logical-snap", byPath[filepath.Join(snap, "file")].Subvolume)
+		assert.NotEqual(t, byPath[file].Root, byPath[filepath.Join(snap, "file")].Root)
+	}
+
+	infos, err = btrfs.NewIoctl().Inspect().LogicalResolve().Path(subvol).Logical(logical).IgnoreOffset().Execute()
+	assert.NoError(t, err)
+	assert.Len(t, infos, 2)
+	for _, info := range infos {
+		assert.Equal(t, uint64(0), info.Offset)
+	}
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,105 @@
+package inspect
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type logicalResolve struct {
+	path         string
+	logical      uint64
+	ignoreOffset bool
+
+	executor func(c *logicalResolve) ([]btrfs.LogicalResolveInfo, error)
+}
+
+func (c *logicalResolve) Path(path string) btrfs.InspectLogicalResolve {
+	c.path = path
+	return c
+}
+
+func (c *logicalResolve) Logical(address uint64) btrfs.InspectLogicalResolve {
+	c.logical = address
+	return c
+}
+
+func (c *logicalResolve) IgnoreOffset() btrfs.InspectLogicalResolve {
+	c.ignoreOffset = true
+	return c
+}
+
+func (c *logicalResolve) context() string {
+	return fmt.Sprintf("path='%s', logical=%d, ignoreOffset=%t", c.path, c.logical, c.ignoreOffset)
+}
+
+func (c *logicalResolve) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdInspectLogicalResolve), Context: c.context(), Err: err}
+}
+
+func (c *logicalResolve) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *logicalResolve) Execute() ([]btrfs.LogicalResolveInfo, error) {
+	infos, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return infos, nil
+}
+
+// btrfs ioctl executor
+func ioctlLogicalResolveExecute(c *logicalResolve) ([]btrfs.LogicalResolveInfo, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	subvols, err := newSubvolumes(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := ioctl.LogicalIno(c.path, c.logical, c.ignoreOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []btrfs.LogicalResolveInfo
+	for _, r := range results {
+		info := btrfs.LogicalResolveInfo{Inode: r.Inode, Offset: r.Offset, Root: r.Root, Subvolume: subvols.name(r.Root)}
+		if subvol, ok := subvols.mounted(r.Root); ok {
+			info.Paths, err = inodePaths(subvol, r.Inode)
+			if err != nil {
+				return nil, err
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// btrfs cli executor
+func cliLogicalResolveExecute(c *logicalResolve) ([]btrfs.LogicalResolveInfo, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlLogicalResolve() interface{} {
+	return &logicalResolve{executor: ioctlLogicalResolveExecute}
+}
+
+func cliLogicalResolve() interface{} {
+	return &logicalResolve{executor: cliLogicalResolveExecute}
+}
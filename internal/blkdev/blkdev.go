@@ -0,0 +1,192 @@
+// Package blkdev inspects block devices before they are handed over to btrfs.
+package blkdev
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/plar/btrfs/internal/mountinfo"
+)
+
+// btrfs superblock location and signature, see struct btrfs_super_block
+const (
+	superInfoOffset  = 0x10000
+	superMagicOffset = 0x40
+	superMagic       = "_BHRfS_M"
+	superLabelOffset = 0x12b
+	superLabelSize   = 256
+)
+
+// filesystem signatures checked before a device is added
+var signatures = []struct {
+	name   string
+	offset int64
+	magic  []byte
+}{
+	{"btrfs", superInfoOffset + superMagicOffset, []byte(superMagic)},
+	{"ext", 0x438, []byte{0x53, 0xEF}},
+	{"xfs", 0, []byte("XFSB")},
+	{"swap", 4096 - 10, []byte("SWAPSPACE2")},
+}
+
+// Probe returns the name of the filesystem found on the device or an empty string
+func Probe(device string) (string, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, sig := range signatures {
+		buf := make([]byte, len(sig.magic))
+		if _, err := f.ReadAt(buf, sig.offset); err != nil {
+			continue
+		}
+		if bytes.Equal(buf, sig.magic) {
+			return sig.name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// HasBtrfsMagic reports whether the device contains the btrfs superblock
+func HasBtrfsMagic(device string) (bool, error) {
+	fs, err := Probe(device)
+	if err != nil {
+		return false, err
+	}
+	return fs == "btrfs", nil
+}
+
+func IsBlockDevice(device string) (bool, error) {
+	fi, err := os.Stat(device)
+	if err != nil {
+		return false, err
+	}
+	return fi.Mode()&os.ModeDevice != 0 && fi.Mode()&os.ModeCharDevice == 0, nil
+}
+
+// BlockDevices returns all block devices and partitions listed in /proc/partitions
+func BlockDevices() ([]string, error) {
+	f, err := os.Open("/proc/partitions")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var devices []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// major minor #blocks name
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || fields[0] == "major" {
+			continue
+		}
+		devices = append(devices, filepath.Join("/dev", fields[3]))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read partitions: %v", err)
+	}
+
+	return devices, nil
+}
+
+// MountPoint returns the first mount point of the device or an empty string if it isn't mounted
+func MountPoint(device string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(device, &st); err != nil {
+		return "", err
+	}
+
+	realPath, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return "", err
+	}
+
+	mounts, err := mountinfo.Mounts()
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range mounts {
+		if !strings.HasPrefix(m.Source, "/") {
+			continue
+		}
+
+		if p, err := filepath.EvalSymlinks(m.Source); err == nil && p == realPath {
+			return m.Point, nil
+		}
+
+		var sst syscall.Stat_t
+		if err := syscall.Stat(m.Source, &sst); err == nil &&
+			st.Mode&syscall.S_IFMT == syscall.S_IFBLK && sst.Mode&syscall.S_IFMT == syscall.S_IFBLK && sst.Rdev == st.Rdev {
+			return m.Point, nil
+		}
+	}
+
+	return "", nil
+}
+
+// IsMounted reports whether the device is a mount source
+func IsMounted(device string) (bool, error) {
+	point, err := MountPoint(device)
+	return len(point) > 0, err
+}
+
+// Label returns the label stored in the btrfs superblock of the device
+func Label(device string) (string, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(superMagic))
+	if _, err := f.ReadAt(magic, superInfoOffset+superMagicOffset); err != nil || string(magic) != superMagic {
+		return "", fmt.Errorf("'%s' has no btrfs superblock", device)
+	}
+
+	label := make([]byte, superLabelSize)
+	if _, err := f.ReadAt(label, superInfoOffset+superLabelOffset); err != nil {
+		return "", fmt.Errorf("cannot read the superblock of '%s': %v", device, err)
+	}
+	if i := bytes.IndexByte(label, 0); i >= 0 {
+		label = label[:i]
+	}
+	return string(label), nil
+}
+
+// CheckUnused verifies that the device is an unmounted block device without a filesystem,
+// the filesystem signature check is skipped if force is set
+func CheckUnused(device string, force bool) error {
+	if ok, err := IsBlockDevice(device); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("'%s' is not a block device", device)
+	}
+
+	if mounted, err := IsMounted(device); err != nil {
+		return err
+	} else if mounted {
+		return fmt.Errorf("'%s' is mounted", device)
+	}
+
+	if force {
+		return nil
+	}
+
+	if fs, err := Probe(device); err != nil {
+		return err
+	} else if len(fs) > 0 {
+		return fmt.Errorf("'%s' contains a %s filesystem, use force to overwrite", device, fs)
+	}
+
+	return nil
+}
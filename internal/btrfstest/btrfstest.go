@@ -0,0 +1,118 @@
+// Package btrfstest sets up loopback btrfs filesystems for the integration tests.
+package btrfstest
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/plar/btrfs/mount"
+)
+
+const tmpPrefix = "/var/tmp/btrfs-test-"
+
+// Loopback is a btrfs filesystem created in an image file and mounted
+// in a temporary directory
+type Loopback struct {
+	RootDir string
+	Image   string
+	// Device is the loop device the image is attached to
+	Device string
+	Mount  string
+
+	devices []string
+}
+
+func Run(cmd string, args ...string) error {
+	log.Printf("Run %s %s", cmd, args)
+	_, err := exec.Command(cmd, args...).CombinedOutput()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Setup creates a 1GB btrfs image and mounts it, it stops the test binary on failure
+func Setup() *Loopback {
+	rootDir, err := ioutil.TempDir("/var/tmp", "btrfs-test-")
+	if err != nil {
+		log.Fatalf("Cannot create tmp directory, err=%s", err)
+	}
+
+	l := &Loopback{RootDir: rootDir}
+
+	l.Mount = path.Join(rootDir, "btrfs")
+	if err := os.MkdirAll(l.Mount, 0700); err != nil {
+		l.fatalf("ERROR: MkdirAll %s, err=%s", l.Mount, err)
+	}
+
+	l.Image = l.NewImage("btrfs.img")
+
+	l.Device = l.attach(l.Image)
+
+	if err := Run("mkfs.btrfs", l.Device); err != nil {
+		l.fatalf("ERROR: mkfs.btrfs %s, err=%s", l.Device, err)
+	}
+
+	if err := mount.Mount(l.Device, l.Mount, mount.Options{}); err != nil {
+		l.fatalf("ERROR: mount %s %s, err=%s", l.Device, l.Mount, err)
+	}
+
+	return l
+}
+
+// NewImage creates an empty 1GB image file in the root directory
+func (l *Loopback) NewImage(name string) string {
+	imageFileName := filepath.Join(l.RootDir, name)
+	ioutil.WriteFile(imageFileName, []byte("datadatadata"), 0700)
+	os.Truncate(imageFileName, 1024*1024*1024) // 1GB
+	return imageFileName
+}
+
+// NewLoopDevice creates an empty image file and attaches it to a free loop device
+func (l *Loopback) NewLoopDevice(name string) string {
+	return l.attach(l.NewImage(name))
+}
+
+// attach attaches the image to a free loop device, Teardown detaches it
+func (l *Loopback) attach(image string) string {
+	out, err := exec.Command("losetup", "--find", "--show", image).Output()
+	if err != nil {
+		l.fatalf("ERROR: losetup %s, err=%s", image, err)
+	}
+
+	device := strings.TrimSpace(string(out))
+	l.devices = append(l.devices, device)
+	return device
+}
+
+// fatalf detaches the loop devices and removes the root directory before it stops the test binary
+func (l *Loopback) fatalf(format string, args ...interface{}) {
+	l.cleanup()
+	log.Fatalf(format, args...)
+}
+
+func (l *Loopback) Teardown() {
+	if err := mount.Unmount(l.Mount); err != nil {
+		log.Fatalf("ERROR: umount, err=%s", err)
+	}
+	l.cleanup()
+}
+
+// cleanup detaches the loop devices and removes the root directory of the unmounted filesystem
+func (l *Loopback) cleanup() {
+	for _, device := range l.devices {
+		if err := Run("losetup", "--detach", device); err != nil {
+			log.Printf("ERROR: losetup --detach %s, err=%s", device, err)
+		}
+	}
+
+	// just to make sure that we're going to delete our temp directory
+	if strings.HasPrefix(l.RootDir, tmpPrefix) {
+		os.RemoveAll(l.RootDir)
+	}
+}
@@ -0,0 +1,173 @@
+// Package mountinfo reads the mount table of the process from /proc/self/mountinfo.
+package mountinfo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type Mount struct {
+	// Root is the path inside of the filesystem mounted at the mount point, for btrfs the subvolume
+	Root string
+	// Point is the mount point
+	Point  string
+	FsType string
+	Source string
+	// Options are the per mount options, e.g. ro and noatime
+	Options string
+	// SuperOptions are the filesystem options, e.g. subvol and compress for btrfs
+	SuperOptions string
+}
+
+// unescape decodes the octal escapes of spaces, tabs, newlines and backslashes
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func parse(r io.Reader) ([]Mount, error) {
+	var mounts []Mount
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// id parent major:minor root mount-point options [optional fields] - fstype source super-options
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+3 > len(fields) {
+			return nil, fmt.Errorf("invalid mountinfo line '%s'", scanner.Text())
+		}
+
+		m := Mount{
+			Root:    unescape(fields[3]),
+			Point:   unescape(fields[4]),
+			Options: fields[5],
+			FsType:  fields[sep+1],
+			Source:  unescape(fields[sep+2]),
+		}
+		if sep+3 < len(fields) {
+			m.SuperOptions = fields[sep+3]
+		}
+		mounts = append(mounts, m)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read mount table: %v", err)
+	}
+	return mounts, nil
+}
+
+// Mounts returns the mounts of the process in mount order
+func Mounts() ([]Mount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parse(f)
+}
+
+// contains reports whether path is the mount point or below it
+func contains(point, path string) bool {
+	return path == point || point == "/" || strings.HasPrefix(path, point+"/")
+}
+
+// Find returns the mount containing path, the last one if mounts are stacked
+func Find(path string) (*Mount, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return nil, err
+	}
+
+	mounts, err := Mounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Mount
+	for i := range mounts {
+		m := &mounts[i]
+		if !contains(m.Point, path) {
+			continue
+		}
+		if found == nil || len(m.Point) >= len(found.Point) {
+			found = m
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no mount contains '%s'", path)
+	}
+	return found, nil
+}
+
+// FindBtrfs returns the btrfs mount containing path
+func FindBtrfs(path string) (*Mount, error) {
+	m, err := Find(path)
+	if err != nil {
+		return nil, err
+	}
+	if m.FsType != "btrfs" {
+		return nil, fmt.Errorf("'%s' is not on a btrfs filesystem", path)
+	}
+	return m, nil
+}
+
+// SubvolPath returns the absolute path of the btrfs subvolume with the path relative to the top level
+// subvolume, false if the subvolume isn't the mounted one or below it
+func (m *Mount) SubvolPath(subvol string) (string, bool) {
+	root := strings.Trim(m.Root, "/")
+	switch {
+	case len(root) == 0:
+		return filepath.Join(m.Point, subvol), true
+	case subvol == root:
+		return m.Point, true
+	case strings.HasPrefix(subvol, root+"/"):
+		return filepath.Join(m.Point, strings.TrimPrefix(subvol, root+"/")), true
+	}
+	return "", false
+}
+
+// IsMountPoint reports whether path is a mount point
+func IsMountPoint(path string) (bool, error) {
+	m, err := Find(path)
+	if err != nil {
+		return false, err
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return false, err
+	}
+	return m.Point == path, nil
+}
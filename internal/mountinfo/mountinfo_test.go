@@ -0,0 +1,78 @@
+package mountinfo
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sample = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw,errors=remount-ro
+35 22 0:31 /@home /home rw,noatime shared:20 - btrfs /dev/sdb1 rw,compress=zstd:3,subvol=/@home
+36 35 0:31 /backup /mnt/with\040space rw - btrfs /dev/sdb1 rw,subvol=/backup
+37 22 0:5 / /dev rw,nosuid master:2 - devtmpfs udev rw
+`
+
+func TestParse(t *testing.T) {
+	mounts, err := parse(strings.NewReader(sample))
+	assert.NoError(t, err)
+	assert.Len(t, mounts, 4)
+
+	assert.Equal(t, Mount{Root: "/@home", Point: "/home", FsType: "btrfs", Source: "/dev/sdb1",
+		Options: "rw,noatime", SuperOptions: "rw,compress=zstd:3,subvol=/@home"}, mounts[1])
+	assert.Equal(t, "/mnt/with space", mounts[2].Point)
+	assert.Equal(t, "devtmpfs", mounts[3].FsType)
+
+	_, err = parse(strings.NewReader("1 2 3\n"))
+	assert.Error(t, err)
+}
+
+func TestUnescape(t *testing.T) {
+	assert.Equal(t, "/mnt/with space", unescape(`/mnt/with\040space`))
+	assert.Equal(t, `/mnt/a\b`, unescape(`/mnt/a\134b`))
+	assert.Equal(t, `/mnt/a\x`, unescape(`/mnt/a\x`))
+}
+
+func TestContains(t *testing.T) {
+	assert.True(t, contains("/", "/home"))
+	assert.True(t, contains("/home", "/home"))
+	assert.True(t, contains("/home", "/home/user"))
+	assert.False(t, contains("/home", "/homes"))
+}
+
+func TestSubvolPath(t *testing.T) {
+	m := &Mount{Root: "/", Point: "/mnt"}
+	p, ok := m.SubvolPath("")
+	assert.True(t, ok)
+	assert.Equal(t, "/mnt", p)
+	p, ok = m.SubvolPath("a/b")
+	assert.True(t, ok)
+	assert.Equal(t, "/mnt/a/b", p)
+
+	m.Root = "/a"
+	p, ok = m.SubvolPath("a")
+	assert.True(t, ok)
+	assert.Equal(t, "/mnt", p)
+	p, ok = m.SubvolPath("a/b")
+	assert.True(t, ok)
+	assert.Equal(t, "/mnt/b", p)
+	_, ok = m.SubvolPath("")
+	assert.False(t, ok)
+	_, ok = m.SubvolPath("ab")
+	assert.False(t, ok)
+}
+
+func TestFind(t *testing.T) {
+	if _, err := os.Stat("/proc/self/mountinfo"); err != nil {
+		t.Skip("no /proc/self/mountinfo")
+	}
+
+	m, err := Find("/")
+	assert.NoError(t, err)
+	assert.Equal(t, "/", m.Point)
+
+	ok, err := IsMountPoint("/")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,62 @@
+// Package poll runs the blocking ioctls of long running operations aside and polls their status.
+package poll
+
+import (
+	"context"
+	"time"
+)
+
+// Task is an operation running in its own goroutine, e.g. a replace ioctl which returns only
+// when the replace is over
+type Task struct {
+	done chan struct{}
+	err  error
+}
+
+// Go runs op in a new goroutine
+func Go(op func() error) *Task {
+	t := &Task{done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		t.err = op()
+	}()
+	return t
+}
+
+// Done is closed when the operation returned
+func (t *Task) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait blocks until the operation returned and returns its error,
+// the values the operation stored are visible to the caller afterwards
+func (t *Task) Wait() error {
+	<-t.done
+	return t.err
+}
+
+// WaitStarted checks started every interval until it reports the operation as running or
+// the operation returned, it reports whether the operation is still running
+func (t *Task) WaitStarted(interval time.Duration, started func() bool) bool {
+	for {
+		select {
+		case <-t.done:
+			return false
+		case <-time.After(interval):
+			if started() {
+				return true
+			}
+		}
+	}
+}
+
+// Watch calls read at once and then every interval until read returns false or ctx is done
+func Watch(ctx context.Context, interval time.Duration, read func() bool) {
+	for read() {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
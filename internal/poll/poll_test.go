@@ -0,0 +1,68 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskStarted(t *testing.T) {
+	release := make(chan struct{})
+	task := Go(func() error {
+		<-release
+		return errors.New("failed late")
+	})
+
+	calls := 0
+	running := task.WaitStarted(time.Millisecond, func() bool {
+		calls++
+		return calls == 3
+	})
+	assert.True(t, running)
+	assert.Equal(t, 3, calls)
+
+	select {
+	case <-task.Done():
+		t.Fatal("task is done before it was released")
+	default:
+	}
+
+	// the error of an operation failing after its start is not lost
+	close(release)
+	assert.EqualError(t, task.Wait(), "failed late")
+	assert.EqualError(t, task.Wait(), "failed late")
+}
+
+func TestTaskDoneBeforeStart(t *testing.T) {
+	var result int
+	task := Go(func() error {
+		result = 42
+		return nil
+	})
+
+	running := task.WaitStarted(time.Millisecond, func() bool { return false })
+	assert.False(t, running)
+	assert.NoError(t, task.Wait())
+	assert.Equal(t, 42, result)
+}
+
+func TestWatch(t *testing.T) {
+	calls := 0
+	Watch(context.Background(), time.Millisecond, func() bool {
+		calls++
+		return calls < 3
+	})
+	assert.Equal(t, 3, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	Watch(ctx, time.Hour, func() bool {
+		calls++
+		cancel()
+		return true
+	})
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,206 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+
+// usage and limit are unions in struct btrfs_balance_args
+static void balance_args_set_usage(struct btrfs_balance_args *args, __u64 usage, __u32 min, __u32 max) {
+	if (args->flags & BTRFS_BALANCE_ARGS_USAGE_RANGE) {
+		args->usage_min = min;
+		args->usage_max = max;
+	} else {
+		args->usage = usage;
+	}
+}
+
+static void balance_args_set_limit(struct btrfs_balance_args *args, __u64 limit, __u32 min, __u32 max) {
+	if (args->flags & BTRFS_BALANCE_ARGS_LIMIT_RANGE) {
+		args->limit_min = min;
+		args->limit_max = max;
+	} else {
+		args->limit = limit;
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// balance types, see struct btrfs_ioctl_balance_args.flags
+const (
+	BalanceData     = uint64(C.BTRFS_BALANCE_DATA)
+	BalanceSystem   = uint64(C.BTRFS_BALANCE_SYSTEM)
+	BalanceMetadata = uint64(C.BTRFS_BALANCE_METADATA)
+	BalanceForce    = uint64(C.BTRFS_BALANCE_FORCE)
+	BalanceResume   = uint64(C.BTRFS_BALANCE_RESUME)
+)
+
+// balance filters, see struct btrfs_balance_args.flags
+const (
+	BalanceArgsProfiles     = uint64(C.BTRFS_BALANCE_ARGS_PROFILES)
+	BalanceArgsUsage        = uint64(C.BTRFS_BALANCE_ARGS_USAGE)
+	BalanceArgsUsageRange   = uint64(C.BTRFS_BALANCE_ARGS_USAGE_RANGE)
+	BalanceArgsDevid        = uint64(C.BTRFS_BALANCE_ARGS_DEVID)
+	BalanceArgsDrange       = uint64(C.BTRFS_BALANCE_ARGS_DRANGE)
+	BalanceArgsVrange       = uint64(C.BTRFS_BALANCE_ARGS_VRANGE)
+	BalanceArgsLimit        = uint64(C.BTRFS_BALANCE_ARGS_LIMIT)
+	BalanceArgsLimitRange   = uint64(C.BTRFS_BALANCE_ARGS_LIMIT_RANGE)
+	BalanceArgsStripesRange = uint64(C.BTRFS_BALANCE_ARGS_STRIPES_RANGE)
+	BalanceArgsConvert      = uint64(C.BTRFS_BALANCE_ARGS_CONVERT)
+	BalanceArgsSoft         = uint64(C.BTRFS_BALANCE_ARGS_SOFT)
+)
+
+// BlockGroupProfiles maps the profile names to the block group flags
+var BlockGroupProfiles = map[string]uint64{
+	"single":  uint64(C.BTRFS_AVAIL_ALLOC_BIT_SINGLE),
+	"dup":     uint64(C.BTRFS_BLOCK_GROUP_DUP),
+	"raid0":   uint64(C.BTRFS_BLOCK_GROUP_RAID0),
+	"raid1":   uint64(C.BTRFS_BLOCK_GROUP_RAID1),
+	"raid1c3": uint64(C.BTRFS_BLOCK_GROUP_RAID1C3),
+	"raid1c4": uint64(C.BTRFS_BLOCK_GROUP_RAID1C4),
+	"raid10":  uint64(C.BTRFS_BLOCK_GROUP_RAID10),
+	"raid5":   uint64(C.BTRFS_BLOCK_GROUP_RAID5),
+	"raid6":   uint64(C.BTRFS_BLOCK_GROUP_RAID6),
+}
+
+// BalanceArgs mirrors struct btrfs_balance_args, the Flags select the used filters
+type BalanceArgs struct {
+	Flags      uint64
+	Profiles   uint64
+	Usage      uint64
+	UsageMin   uint32
+	UsageMax   uint32
+	Devid      uint64
+	PStart     uint64
+	PEnd       uint64
+	VStart     uint64
+	VEnd       uint64
+	Target     uint64
+	Limit      uint64
+	LimitMin   uint32
+	LimitMax   uint32
+	StripesMin uint32
+	StripesMax uint32
+}
+
+func (a *BalanceArgs) toC(args *C.struct_btrfs_balance_args) {
+	args.flags = C.__u64(a.Flags)
+	args.profiles = C.__u64(a.Profiles)
+	args.devid = C.__u64(a.Devid)
+	args.pstart = C.__u64(a.PStart)
+	args.pend = C.__u64(a.PEnd)
+	args.vstart = C.__u64(a.VStart)
+	args.vend = C.__u64(a.VEnd)
+	args.target = C.__u64(a.Target)
+	args.stripes_min = C.__u32(a.StripesMin)
+	args.stripes_max = C.__u32(a.StripesMax)
+	C.balance_args_set_usage(args, C.__u64(a.Usage), C.__u32(a.UsageMin), C.__u32(a.UsageMax))
+	C.balance_args_set_limit(args, C.__u64(a.Limit), C.__u32(a.LimitMin), C.__u32(a.LimitMax))
+}
+
+type BalanceStatus struct {
+	Flags uint64
+	// BTRFS_BALANCE_STATE_* bits
+	Running         bool
+	PauseRequested  bool
+	CancelRequested bool
+
+	Expected   uint64
+	Considered uint64
+	Completed  uint64
+}
+
+func newBalanceStatus(args *C.struct_btrfs_ioctl_balance_args) *BalanceStatus {
+	return &BalanceStatus{
+		Flags:           uint64(args.flags),
+		Running:         args.state&C.BTRFS_BALANCE_STATE_RUNNING != 0,
+		PauseRequested:  args.state&C.BTRFS_BALANCE_STATE_PAUSE_REQ != 0,
+		CancelRequested: args.state&C.BTRFS_BALANCE_STATE_CANCEL_REQ != 0,
+		Expected:        uint64(args.stat.expected),
+		Considered:      uint64(args.stat.considered),
+		Completed:       uint64(args.stat.completed),
+	}
+}
+
+// Balance relocates the chunks selected by the filters of the types given in flags,
+// nil filters are not passed to the kernel. The call blocks until the balance is
+// finished, paused or canceled.
+func Balance(path string, flags uint64, data, meta, sys *BalanceArgs) (*BalanceStatus, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_balance_args
+	args.flags = C.__u64(flags)
+	if data != nil {
+		data.toC(&args.data)
+	}
+	if meta != nil {
+		meta.toC(&args.meta)
+	}
+	if sys != nil {
+		sys.toC(&args.sys)
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_BALANCE_V2,
+		uintptr(unsafe.Pointer(&args)))
+	if errno == syscall.ECANCELED {
+		return newBalanceStatus(&args), fmt.Errorf("Balance of '%s' was paused or canceled", path)
+	} else if errno != 0 {
+		return nil, fmt.Errorf("Failed to balance '%s': %v", path, errno.Error())
+	}
+	return newBalanceStatus(&args), nil
+}
+
+func balanceCtl(path string, cmd uintptr, op string) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_BALANCE_CTL, cmd)
+	if errno == syscall.ENOTCONN {
+		return fmt.Errorf("No balance is running on '%s'", path)
+	} else if errno != 0 {
+		return fmt.Errorf("Failed to %s balance of '%s': %v", op, path, errno.Error())
+	}
+	return nil
+}
+
+// BalancePause pauses the running balance, it can be resumed with BalanceResume flag
+func BalancePause(path string) error {
+	return balanceCtl(path, C.BTRFS_BALANCE_CTL_PAUSE, "pause")
+}
+
+// BalanceCancel cancels the running or paused balance
+func BalanceCancel(path string) error {
+	return balanceCtl(path, C.BTRFS_BALANCE_CTL_CANCEL, "cancel")
+}
+
+// GetBalanceStatus returns the progress of the running or paused balance,
+// the status is nil if there is no balance
+func GetBalanceStatus(path string) (*BalanceStatus, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_balance_args
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_BALANCE_PROGRESS,
+		uintptr(unsafe.Pointer(&args)))
+	if errno == syscall.ENOTCONN {
+		return nil, nil
+	} else if errno != 0 {
+		return nil, fmt.Errorf("Failed to get balance status of '%s': %v", path, errno.Error())
+	}
+	return newBalanceStatus(&args), nil
+}
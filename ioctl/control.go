@@ -0,0 +1,73 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+
+#ifndef BTRFS_IOC_FORGET_DEV
+#define BTRFS_IOC_FORGET_DEV _IOW(BTRFS_IOCTL_MAGIC, 5, struct btrfs_ioctl_vol_args)
+#endif
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ControlDevice is used for the ioctls which are not bound to a mounted filesystem
+const ControlDevice = "/dev/btrfs-control"
+
+func controlIoctl(cmd uintptr, device string) (uintptr, syscall.Errno, error) {
+	f, err := os.OpenFile(ControlDevice, os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var args C.struct_btrfs_ioctl_vol_args
+	if err := setVolArgsName(&args, device); err != nil {
+		return 0, 0, err
+	}
+
+	ret, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), cmd, uintptr(unsafe.Pointer(&args)))
+	return ret, errno, nil
+}
+
+// DevScan registers the device of a multi-device filesystem in the kernel
+func DevScan(device string) error {
+	_, errno, err := controlIoctl(C.BTRFS_IOC_SCAN_DEV, device)
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return fmt.Errorf("Failed to scan device '%s': %v", device, errno.Error())
+	}
+	return nil
+}
+
+// DevForget unregisters the device, an empty device unregisters all devices of unmounted filesystems
+func DevForget(device string) error {
+	_, errno, err := controlIoctl(C.BTRFS_IOC_FORGET_DEV, device)
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return fmt.Errorf("Failed to forget device '%s': %v", device, errno.Error())
+	}
+	return nil
+}
+
+// DevReady registers the device and reports whether all devices of its filesystem are known to the kernel
+func DevReady(device string) (bool, error) {
+	ret, errno, err := controlIoctl(C.BTRFS_IOC_DEVICES_READY, device)
+	if err != nil {
+		return false, err
+	}
+	if errno != 0 {
+		return false, fmt.Errorf("Failed to check device '%s': %v", device, errno.Error())
+	}
+	return ret == 0, nil
+}
@@ -0,0 +1,55 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	CompressNone = uint32(C.BTRFS_COMPRESS_NONE)
+	CompressZlib = uint32(C.BTRFS_COMPRESS_ZLIB)
+	CompressLzo  = uint32(C.BTRFS_COMPRESS_LZO)
+	CompressZstd = uint32(C.BTRFS_COMPRESS_ZSTD)
+)
+
+// Defrag defragments length bytes of the file starting at start, length 0 means up to the end of file.
+// The file contents are recompressed unless compress is CompressNone. For a directory
+// the kernel defragments the subvolume metadata instead.
+func Defrag(path string, start, length uint64, extentThresh uint32, compress uint32, flush bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var args C.struct_btrfs_ioctl_defrag_range_args
+	args.start = C.__u64(start)
+	args.len = C.__u64(length)
+	if length == 0 {
+		args.len = math.MaxUint64
+	}
+	args.extent_thresh = C.__u32(extentThresh)
+	if compress != CompressNone {
+		args.flags |= C.BTRFS_DEFRAG_RANGE_COMPRESS
+		args.compress_type = C.__u32(compress)
+	}
+	if flush {
+		args.flags |= C.BTRFS_DEFRAG_RANGE_START_IO
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), C.BTRFS_IOC_DEFRAG_RANGE,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to defragment '%s': %v", path, errno.Error())
+	}
+	return nil
+}
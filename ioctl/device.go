@@ -0,0 +1,274 @@
+package ioctl
+
+/*
+#include <string.h>
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+
+#ifndef BTRFS_DEVICE_SPEC_BY_ID
+#define BTRFS_DEVICE_SPEC_BY_ID (1ULL << 3)
+#endif
+
+// name and devid share the same union in struct btrfs_ioctl_vol_args_v2
+static void vol_args_v2_set_name(struct btrfs_ioctl_vol_args_v2 *args, const char *name) {
+	strncpy(args->name, name, BTRFS_SUBVOL_NAME_MAX);
+}
+
+static void vol_args_v2_set_devid(struct btrfs_ioctl_vol_args_v2 *args, __u64 devid) {
+	args->flags |= BTRFS_DEVICE_SPEC_BY_ID;
+	memcpy(args->name, &devid, sizeof(devid));
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/pborman/uuid"
+)
+
+func setVolArgsName(args *C.struct_btrfs_ioctl_vol_args, name string) error {
+	if len(name) >= len(args.name) {
+		return fmt.Errorf("name is too long '%s'", name)
+	}
+	for i, c := range []byte(name) {
+		args.name[i] = C.char(c)
+	}
+	return nil
+}
+
+// DevAdd adds the block device to the filesystem mounted at path
+func DevAdd(path, device string) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_vol_args
+	if err := setVolArgsName(&args, device); err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_ADD_DEV,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to add device '%s': %v", device, errno.Error())
+	}
+	return nil
+}
+
+// DevRemove removes the device from the filesystem mounted at path, the device is
+// a path to the block device or the "missing" keyword
+func DevRemove(path, device string) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	if len(device) > C.BTRFS_SUBVOL_NAME_MAX {
+		return fmt.Errorf("name is too long '%s'", device)
+	}
+
+	Cdevice := C.CString(device)
+	defer free(Cdevice)
+
+	var args C.struct_btrfs_ioctl_vol_args_v2
+	C.vol_args_v2_set_name(&args, Cdevice)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_RM_DEV_V2,
+		uintptr(unsafe.Pointer(&args)))
+	if errno == syscall.ENOTTY || errno == syscall.EOPNOTSUPP {
+		// kernels older than 4.7 support only removal by name
+		var v1 C.struct_btrfs_ioctl_vol_args
+		if err := setVolArgsName(&v1, device); err != nil {
+			return err
+		}
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_RM_DEV,
+			uintptr(unsafe.Pointer(&v1)))
+	}
+	if errno != 0 {
+		return fmt.Errorf("Failed to remove device '%s': %v", device, errno.Error())
+	}
+	return nil
+}
+
+// DevRemoveById removes the device devid from the filesystem mounted at path
+func DevRemoveById(path string, devid uint64) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_vol_args_v2
+	C.vol_args_v2_set_devid(&args, C.__u64(devid))
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_RM_DEV_V2,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to remove device id %d: %v", devid, errno.Error())
+	}
+	return nil
+}
+
+type FsInfo struct {
+	MaxId      uint64
+	NumDevices uint64
+	FSID       uuid.UUID
+}
+
+type DevInfo struct {
+	DevId      uint64
+	UUID       uuid.UUID
+	BytesUsed  uint64
+	TotalBytes uint64
+	Path       string
+}
+
+type DevStats struct {
+	WriteErrs      uint64
+	ReadErrs       uint64
+	FlushErrs      uint64
+	CorruptionErrs uint64
+	GenerationErrs uint64
+}
+
+// GetFsInfo returns the number of devices and the highest device id of the filesystem mounted at path
+func GetFsInfo(path string) (*FsInfo, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_fs_info_args
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_FS_INFO,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return nil, fmt.Errorf("Failed to get filesystem info of '%s': %v", path, errno.Error())
+	}
+
+	return &FsInfo{
+		MaxId:      uint64(args.max_id),
+		NumDevices: uint64(args.num_devices),
+		FSID:       uuid.UUID(C.GoBytes(unsafe.Pointer(&args.fsid[0]), C.BTRFS_FSID_SIZE)),
+	}, nil
+}
+
+// GetDevInfo returns the device devid of the filesystem mounted at path,
+// syscall.ENODEV is returned if there is no such device
+func GetDevInfo(path string, devid uint64) (*DevInfo, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	return getDevInfo(getDirFd(dir), devid)
+}
+
+func getDevInfo(fd uintptr, devid uint64) (*DevInfo, error) {
+	var args C.struct_btrfs_ioctl_dev_info_args
+	args.devid = C.__u64(devid)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, C.BTRFS_IOC_DEV_INFO,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return &DevInfo{
+		DevId:      uint64(args.devid),
+		UUID:       uuid.UUID(C.GoBytes(unsafe.Pointer(&args.uuid[0]), C.BTRFS_UUID_SIZE)),
+		BytesUsed:  uint64(args.bytes_used),
+		TotalBytes: uint64(args.total_bytes),
+		Path:       C.GoString((*C.char)(unsafe.Pointer(&args.path[0]))),
+	}, nil
+}
+
+// GetDevInfos returns all devices of the filesystem mounted at path
+func GetDevInfos(path string) ([]DevInfo, error) {
+	fsInfo, err := GetFsInfo(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	var devices []DevInfo
+	for devid := uint64(1); devid <= fsInfo.MaxId; devid++ {
+		info, err := getDevInfo(getDirFd(dir), devid)
+		if err == syscall.ENODEV {
+			// removed devices leave gaps in device ids
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to get device info %d of '%s': %v", devid, path, err)
+		}
+		devices = append(devices, *info)
+	}
+
+	return devices, nil
+}
+
+// FindDevInfo looks up the device by id or by path, symlinks like /dev/disk/by-id/... are resolved
+func FindDevInfo(infos []DevInfo, device string) (DevInfo, bool) {
+	id, err := strconv.ParseUint(device, 10, 64)
+	byID := err == nil
+	resolved, _ := filepath.EvalSymlinks(device)
+
+	for _, info := range infos {
+		if byID && id == info.DevId {
+			return info, true
+		}
+		if !byID && (device == info.Path || resolved == info.Path) {
+			return info, true
+		}
+	}
+	return DevInfo{}, false
+}
+
+// GetDevStats returns the error counters of the device devid, the counters are zeroed if reset is set
+func GetDevStats(path string, devid uint64, reset bool) (*DevStats, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_get_dev_stats
+	args.devid = C.__u64(devid)
+	args.nr_items = C.BTRFS_DEV_STAT_VALUES_MAX
+	if reset {
+		args.flags = C.BTRFS_DEV_STATS_RESET
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_GET_DEV_STATS,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return nil, fmt.Errorf("Failed to get device stats %d of '%s': %v", devid, path, errno.Error())
+	}
+
+	// older kernels may return fewer counters
+	var values [C.BTRFS_DEV_STAT_VALUES_MAX]uint64
+	for i := 0; i < int(args.nr_items) && i < len(values); i++ {
+		values[i] = uint64(args.values[i])
+	}
+
+	return &DevStats{
+		WriteErrs:      values[C.BTRFS_DEV_STAT_WRITE_ERRS],
+		ReadErrs:       values[C.BTRFS_DEV_STAT_READ_ERRS],
+		FlushErrs:      values[C.BTRFS_DEV_STAT_FLUSH_ERRS],
+		CorruptionErrs: values[C.BTRFS_DEV_STAT_CORRUPTION_ERRS],
+		GenerationErrs: values[C.BTRFS_DEV_STAT_GENERATION_ERRS],
+	}, nil
+}
@@ -0,0 +1,447 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"syscall"
+
+	"github.com/pborman/uuid"
+)
+
+// DiffKind is the kind of a change between two snapshots
+type DiffKind int
+
+const (
+	DiffAdded DiffKind = iota
+	DiffModified
+	DiffDeleted
+	DiffRenamed
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffModified:
+		return "modified"
+	case DiffDeleted:
+		return "deleted"
+	case DiffRenamed:
+		return "renamed"
+	}
+	return fmt.Sprintf("%d", int(k))
+}
+
+// DiffEntry is a changed path, relative to the snapshot root
+type DiffEntry struct {
+	Kind DiffKind
+	// Path is the path in the new snapshot, the path in the old one for deleted files
+	Path string
+	// OldPath is the path of a renamed file in the old snapshot
+	OldPath string
+	IsDir   bool
+}
+
+// diffTree reads the inodes and their paths from the tree of a subvolume
+type diffTree struct {
+	fd     uintptr
+	rootId uint64
+	inodes map[uint64]*BtrfsInodeItem
+	paths  map[uint64][]string
+}
+
+func newDiffTree(fd uintptr, rootId uint64) *diffTree {
+	return &diffTree{
+		fd:     fd,
+		rootId: rootId,
+		inodes: map[uint64]*BtrfsInodeItem{},
+		paths:  map[uint64][]string{},
+	}
+}
+
+// inode returns the inode item, nil if the tree has no such inode
+func (t *diffTree) inode(ino uint64) (*BtrfsInodeItem, error) {
+	if item, ok := t.inodes[ino]; ok {
+		return item, nil
+	}
+
+	key := Key{ObjectID: ino, Type: C.BTRFS_INODE_ITEM_KEY}
+	it := newTreeSearch(t.fd, TreeSearch{TreeID: t.rootId, Min: key, Max: key})
+
+	var item *BtrfsInodeItem
+	if it.Next() {
+		var err error
+		if item, err = NewBtrfsInodeItem(it.Item()); err != nil {
+			return nil, err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	t.inodes[ino] = item
+	return item, nil
+}
+
+// pathsOf returns the sorted paths of the inode built from the inode refs up to the root directory,
+// an inode without refs is an orphan waiting for its deletion
+func (t *diffTree) pathsOf(ino uint64) ([]string, error) {
+	if ino == C.BTRFS_FIRST_FREE_OBJECTID {
+		return []string{""}, nil
+	}
+	if paths, ok := t.paths[ino]; ok {
+		return paths, nil
+	}
+
+	type ref struct {
+		parent uint64
+		name   string
+	}
+
+	var refs []ref
+	it := newTreeSearch(t.fd, TreeSearch{
+		TreeID: t.rootId,
+		Min:    Key{ObjectID: ino, Type: C.BTRFS_INODE_REF_KEY},
+		Max:    Key{ObjectID: ino, Type: C.BTRFS_INODE_EXTREF_KEY, Offset: math.MaxUint64},
+	})
+	for it.Next() {
+		sh := it.Header()
+
+		switch sh.Key.Type {
+		case C.BTRFS_INODE_REF_KEY:
+			// the offset of the key is the parent directory
+			items, err := NewBtrfsInodeRefs(it.Item())
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range items {
+				refs = append(refs, ref{parent: sh.Key.Offset, name: r.Name})
+			}
+
+		case C.BTRFS_INODE_EXTREF_KEY:
+			items, err := NewBtrfsInodeExtrefs(it.Item())
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range items {
+				refs = append(refs, ref{parent: r.ParentObjectId, name: r.Name})
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, r := range refs {
+		parents, err := t.pathsOf(r.parent)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			paths = append(paths, path.Join(p, r.name))
+		}
+	}
+	sort.Strings(paths)
+
+	t.paths[ino] = paths
+	return paths, nil
+}
+
+// path returns the first path of the inode, "" for orphans
+func (t *diffTree) path(ino uint64) (string, error) {
+	paths, err := t.pathsOf(ino)
+	if err != nil || len(paths) == 0 {
+		return "", err
+	}
+	return paths[0], nil
+}
+
+// entries returns the entries of the directory in index order
+func (t *diffTree) entries(ino uint64) ([]BtrfsDirItem, error) {
+	it := newTreeSearch(t.fd, TreeSearch{
+		TreeID: t.rootId,
+		Min:    Key{ObjectID: ino, Type: C.BTRFS_DIR_INDEX_KEY},
+		Max:    Key{ObjectID: ino, Type: C.BTRFS_DIR_INDEX_KEY, Offset: math.MaxUint64},
+	})
+
+	var entries []BtrfsDirItem
+	for it.Next() {
+		items, err := NewBtrfsDirItems(it.Item())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, items...)
+	}
+	return entries, it.Err()
+}
+
+func isDir(item *BtrfsInodeItem) bool {
+	return item.Mode&syscall.S_IFMT == syscall.S_IFDIR
+}
+
+// findUpdatedInodes returns the inodes of the subvolume tree rootId whose inode item or file extents
+// were written since oldestGen, the value is true for the inodes with new file extents
+func findUpdatedInodes(fd uintptr, rootId, oldestGen uint64) (map[uint64]bool, error) {
+	// the search skips the leaves which weren't written since oldestGen
+	it := newTreeSearch(fd, TreeSearch{
+		TreeID:     rootId,
+		Min:        Key{ObjectID: C.BTRFS_FIRST_FREE_OBJECTID},
+		Max:        Key{ObjectID: C.BTRFS_LAST_FREE_OBJECTID & (1<<64 - 1), Type: C.BTRFS_EXTENT_DATA_KEY, Offset: math.MaxUint64},
+		MinTransID: oldestGen,
+	})
+
+	inodes := map[uint64]bool{}
+	for it.Next() {
+		sh := it.Header()
+
+		switch sh.Key.Type {
+		case C.BTRFS_INODE_ITEM_KEY:
+			item, err := NewBtrfsInodeItem(it.Item())
+			if err != nil {
+				return nil, err
+			}
+			if item.TransId >= oldestGen {
+				inodes[sh.Key.ObjectID] = inodes[sh.Key.ObjectID]
+			}
+
+		case C.BTRFS_EXTENT_DATA_KEY:
+			item, err := NewBtrfsFileExtentItem((*C.struct_btrfs_file_extent_item)(it.raw()))
+			if err != nil {
+				return nil, err
+			}
+			if item.Generation >= oldestGen {
+				inodes[sh.Key.ObjectID] = true
+			}
+		}
+	}
+
+	return inodes, it.Err()
+}
+
+func isZeroUUID(u uuid.UUID) bool {
+	return len(u) == 0 || bytes.Equal(u, make([]byte, len(u)))
+}
+
+// snapshotsOfSameSubvol reports whether both are snapshots of the same subvolume or one is the source of the other
+func snapshotsOfSameSubvol(a, b *SubvolSearchResult) bool {
+	return !isZeroUUID(a.ParentUUID) && uuid.Equal(a.ParentUUID, b.ParentUUID) ||
+		uuid.Equal(a.ParentUUID, b.UUID) || uuid.Equal(b.ParentUUID, a.UUID)
+}
+
+// SubvolDiff returns the changes between the read only snapshot from and the newer snapshot to.
+// Only the items of to written after the creation of from are searched, from must not change since then.
+func SubvolDiff(from, to string) ([]DiffEntry, error) {
+	for _, p := range []string{from, to} {
+		ok, err := TestIsSubvolume(p)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not a subvolume", p)
+		}
+	}
+
+	fromDir, err := openDir(from)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(fromDir)
+
+	toDir, err := openDir(to)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(toDir)
+
+	fromId, err := findPathRootId(fromDir)
+	if err != nil {
+		return nil, err
+	}
+	toId, err := findPathRootId(toDir)
+	if err != nil {
+		return nil, err
+	}
+
+	subvols, err := subvolSearch(toDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldSubvol, newSubvol *SubvolSearchResult
+	for i := range subvols {
+		switch subvols[i].Id {
+		case fromId:
+			oldSubvol = &subvols[i]
+		case toId:
+			newSubvol = &subvols[i]
+		}
+	}
+	if oldSubvol == nil || newSubvol == nil {
+		return nil, fmt.Errorf("Failed to find the subvolumes '%s' and '%s'", from, to)
+	}
+
+	if !oldSubvol.IsReadOnly() {
+		return nil, fmt.Errorf("'%s' is not a read only snapshot", from)
+	}
+	if !snapshotsOfSameSubvol(oldSubvol, newSubvol) {
+		return nil, fmt.Errorf("'%s' and '%s' are not snapshots of the same subvolume", from, to)
+	}
+	// the source of from is always newer
+	if !uuid.Equal(oldSubvol.ParentUUID, newSubvol.UUID) && oldSubvol.CGen > newSubvol.CGen {
+		return nil, fmt.Errorf("'%s' is newer than '%s'", from, to)
+	}
+
+	fd := getDirFd(toDir)
+	// the snapshot from contains everything written up to the transaction which created it
+	updated, err := findUpdatedInodes(fd, toId, oldSubvol.CGen+1)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &subvolDiff{
+		old:     newDiffTree(fd, fromId),
+		new:     newDiffTree(fd, toId),
+		deleted: map[string]bool{},
+	}
+
+	inodes := make([]uint64, 0, len(updated))
+	for ino := range updated {
+		inodes = append(inodes, ino)
+	}
+	sort.Slice(inodes, func(i, j int) bool { return inodes[i] < inodes[j] })
+
+	for _, ino := range inodes {
+		if err := d.compare(ino, updated[ino]); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(d.entries, func(i, j int) bool {
+		if d.entries[i].Path != d.entries[j].Path {
+			return d.entries[i].Path < d.entries[j].Path
+		}
+		return d.entries[i].Kind < d.entries[j].Kind
+	})
+	return d.entries, nil
+}
+
+type subvolDiff struct {
+	old, new *diffTree
+	deleted  map[string]bool
+	entries  []DiffEntry
+}
+
+func (d *subvolDiff) add(kind DiffKind, path, oldPath string, dir bool) {
+	d.entries = append(d.entries, DiffEntry{Kind: kind, Path: path, OldPath: oldPath, IsDir: dir})
+}
+
+// compare classifies the inode updated in the new snapshot, dataChanged is set if it has new file extents
+func (d *subvolDiff) compare(ino uint64, dataChanged bool) error {
+	cur, err := d.new.inode(ino)
+	if err != nil || cur == nil {
+		return err
+	}
+	curPath, err := d.new.path(ino)
+	if err != nil {
+		return err
+	}
+
+	old, err := d.old.inode(ino)
+	if err != nil {
+		return err
+	}
+
+	// a different generation is a new inode reusing the number, the deleted one is found in its directory
+	if old == nil || old.Generation != cur.Generation {
+		if len(curPath) > 0 {
+			d.add(DiffAdded, curPath, "", isDir(cur))
+		}
+		return nil
+	}
+
+	if isDir(cur) && isDir(old) {
+		if err := d.findDeleted(ino); err != nil {
+			return err
+		}
+	}
+
+	// skip the root directory and orphans
+	if len(curPath) == 0 {
+		return nil
+	}
+
+	oldPath, err := d.old.path(ino)
+	if err != nil {
+		return err
+	}
+	if len(oldPath) > 0 && oldPath != curPath {
+		d.add(DiffRenamed, curPath, oldPath, isDir(cur))
+	}
+
+	modified := cur.Mode != old.Mode || cur.Uid != old.Uid || cur.Gid != old.Gid
+	if !isDir(cur) {
+		// added and deleted entries are reported for themselves, not as a change of the directory
+		modified = modified || dataChanged || cur.Size != old.Size || cur.MTime != old.MTime
+	}
+	if modified {
+		d.add(DiffModified, curPath, "", isDir(cur))
+	}
+	return nil
+}
+
+// findDeleted reports the entries of the directory in the old snapshot whose inodes are gone
+func (d *subvolDiff) findDeleted(dir uint64) error {
+	entries, err := d.old.entries(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		// nested subvolumes are not part of the snapshot
+		if e.Location.Type != C.BTRFS_INODE_ITEM_KEY {
+			continue
+		}
+		ino := e.Location.ObjectId
+
+		old, err := d.old.inode(ino)
+		if err != nil || old == nil {
+			return err
+		}
+		cur, err := d.new.inode(ino)
+		if err != nil {
+			return err
+		}
+		// still there, maybe moved to another directory
+		if cur != nil && cur.Generation == old.Generation {
+			continue
+		}
+
+		oldDir, err := d.old.path(dir)
+		if err != nil {
+			return err
+		}
+		p := path.Join(oldDir, e.Name)
+		if d.deleted[p] {
+			continue
+		}
+		d.deleted[p] = true
+		d.add(DiffDeleted, p, "", isDir(old))
+
+		if isDir(old) {
+			if err := d.findDeleted(ino); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package ioctl
+
+// SetTreeSearchBufSize changes the initial size of the tree search buffer, it returns the previous one
+func SetTreeSearchBufSize(size uint64) uint64 {
+	prev := treeSearchBufSize
+	treeSearchBufSize = size
+	return prev
+}
@@ -0,0 +1,180 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+
+#ifndef BTRFS_FEATURE_INCOMPAT_RAID_STRIPE_TREE
+#define BTRFS_FEATURE_INCOMPAT_RAID_STRIPE_TREE (1ULL << 14)
+#endif
+
+#ifndef BTRFS_FEATURE_INCOMPAT_SIMPLE_QUOTA
+#define BTRFS_FEATURE_INCOMPAT_SIMPLE_QUOTA (1ULL << 16)
+#endif
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+type FeatureKind int
+
+const (
+	FeatureCompat FeatureKind = iota
+	FeatureCompatRO
+	FeatureIncompat
+)
+
+func (k FeatureKind) String() string {
+	switch k {
+	case FeatureCompat:
+		return "compat"
+	case FeatureCompatRO:
+		return "compat_ro"
+	case FeatureIncompat:
+		return "incompat"
+	default:
+		return fmt.Sprintf("%d", int(k))
+	}
+}
+
+type Feature struct {
+	Name string
+	Kind FeatureKind
+	Flag uint64
+}
+
+// Features lists the known feature bits, the names match /sys/fs/btrfs/features
+var Features = []Feature{
+	{"free_space_tree", FeatureCompatRO, C.BTRFS_FEATURE_COMPAT_RO_FREE_SPACE_TREE},
+	{"free_space_tree_valid", FeatureCompatRO, C.BTRFS_FEATURE_COMPAT_RO_FREE_SPACE_TREE_VALID},
+	{"verity", FeatureCompatRO, C.BTRFS_FEATURE_COMPAT_RO_VERITY},
+	{"block_group_tree", FeatureCompatRO, C.BTRFS_FEATURE_COMPAT_RO_BLOCK_GROUP_TREE},
+
+	{"mixed_backref", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_MIXED_BACKREF},
+	{"default_subvol", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_DEFAULT_SUBVOL},
+	{"mixed_groups", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_MIXED_GROUPS},
+	{"compress_lzo", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_COMPRESS_LZO},
+	{"compress_zstd", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_COMPRESS_ZSTD},
+	{"big_metadata", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_BIG_METADATA},
+	{"extended_iref", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_EXTENDED_IREF},
+	{"raid56", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_RAID56},
+	{"skinny_metadata", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_SKINNY_METADATA},
+	{"no_holes", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_NO_HOLES},
+	{"metadata_uuid", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_METADATA_UUID},
+	{"raid1c34", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_RAID1C34},
+	{"zoned", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_ZONED},
+	{"extent_tree_v2", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_EXTENT_TREE_V2},
+	{"raid_stripe_tree", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_RAID_STRIPE_TREE},
+	{"simple_quota", FeatureIncompat, C.BTRFS_FEATURE_INCOMPAT_SIMPLE_QUOTA},
+}
+
+// FeatureFlags mirrors struct btrfs_ioctl_feature_flags
+type FeatureFlags struct {
+	Compat   uint64
+	CompatRO uint64
+	Incompat uint64
+}
+
+// Has reports whether the feature bit is set
+func (f FeatureFlags) Has(feature Feature) bool {
+	return f.flags(feature.Kind)&feature.Flag != 0
+}
+
+// Set sets the feature bit
+func (f *FeatureFlags) Set(feature Feature) {
+	switch feature.Kind {
+	case FeatureCompat:
+		f.Compat |= feature.Flag
+	case FeatureCompatRO:
+		f.CompatRO |= feature.Flag
+	case FeatureIncompat:
+		f.Incompat |= feature.Flag
+	}
+}
+
+func (f FeatureFlags) flags(kind FeatureKind) uint64 {
+	switch kind {
+	case FeatureCompat:
+		return f.Compat
+	case FeatureCompatRO:
+		return f.CompatRO
+	case FeatureIncompat:
+		return f.Incompat
+	}
+	return 0
+}
+
+func newFeatureFlags(flags *C.struct_btrfs_ioctl_feature_flags) FeatureFlags {
+	return FeatureFlags{
+		Compat:   uint64(flags.compat_flags),
+		CompatRO: uint64(flags.compat_ro_flags),
+		Incompat: uint64(flags.incompat_flags),
+	}
+}
+
+func (f FeatureFlags) toC(flags *C.struct_btrfs_ioctl_feature_flags) {
+	flags.compat_flags = C.__u64(f.Compat)
+	flags.compat_ro_flags = C.__u64(f.CompatRO)
+	flags.incompat_flags = C.__u64(f.Incompat)
+}
+
+// GetFeatures returns the features enabled on the filesystem mounted at path
+func GetFeatures(path string) (FeatureFlags, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return FeatureFlags{}, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_feature_flags
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_GET_FEATURES,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return FeatureFlags{}, fmt.Errorf("Failed to get features of '%s': %v", path, errno.Error())
+	}
+	return newFeatureFlags(&args), nil
+}
+
+// GetSupportedFeatures returns the features supported by the running kernel and
+// the features which can be safely set and cleared on a mounted filesystem
+func GetSupportedFeatures(path string) (supported, safeSet, safeClear FeatureFlags, err error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return
+	}
+	defer closeDir(dir)
+
+	var args [3]C.struct_btrfs_ioctl_feature_flags
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_GET_SUPPORTED_FEATURES,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		err = fmt.Errorf("Failed to get supported features of '%s': %v", path, errno.Error())
+		return
+	}
+	return newFeatureFlags(&args[0]), newFeatureFlags(&args[1]), newFeatureFlags(&args[2]), nil
+}
+
+// SetFeatures changes the feature bits selected by mask to the values in flags
+func SetFeatures(path string, flags, mask FeatureFlags) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	// the kernel reads the mask of the changed bits first, then their new values
+	var args [2]C.struct_btrfs_ioctl_feature_flags
+	mask.toC(&args[0])
+	flags.toC(&args[1])
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SET_FEATURES,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to set features of '%s': %v", path, errno.Error())
+	}
+	return nil
+}
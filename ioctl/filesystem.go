@@ -0,0 +1,39 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Resize changes the size of the device devid of the filesystem mounted at path,
+// amount is the kernel resize string: "max", "<bytes>", "+<bytes>" or "-<bytes>"
+func Resize(path string, devid uint64, amount string) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_vol_args
+	name := fmt.Sprintf("%d:%s", devid, amount)
+	if len(name) >= len(args.name) {
+		return fmt.Errorf("resize argument is too long '%s'", name)
+	}
+	for i, c := range []byte(name) {
+		args.name[i] = C.char(c)
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_RESIZE,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to resize '%s' to '%s': %v", path, name, errno.Error())
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// the kernel fills at most 4KiB of paths
+	inoPathsSize = 4096
+	// the logical resolve starts with 64KiB and grows up to the kernel limit of 16MiB
+	logicalInoSize    = 64 * 1024
+	logicalInoMaxSize = 16 * 1024 * 1024
+)
+
+// dataContainer is the header of struct btrfs_data_container followed by the values
+type dataContainer struct {
+	bytesLeft    uint32
+	bytesMissing uint32
+	elemCnt      uint32
+	elemMissed   uint32
+	val          []byte
+}
+
+func newDataContainer(buf []byte) dataContainer {
+	return dataContainer{
+		bytesLeft:    binary.LittleEndian.Uint32(buf[0:]),
+		bytesMissing: binary.LittleEndian.Uint32(buf[4:]),
+		elemCnt:      binary.LittleEndian.Uint32(buf[8:]),
+		elemMissed:   binary.LittleEndian.Uint32(buf[12:]),
+		val:          buf[C.sizeof_struct_btrfs_data_container:],
+	}
+}
+
+func (c dataContainer) u64(i uint32) uint64 {
+	return binary.LittleEndian.Uint64(c.val[i*8:])
+}
+
+// InoPaths returns all paths of the inode, relative to the root of the subvolume containing path
+func InoPaths(path string, inum uint64) ([]string, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	buf := make([]byte, inoPathsSize)
+
+	var args C.struct_btrfs_ioctl_ino_path_args
+	args.inum = C.__u64(inum)
+	args.size = C.__u64(len(buf))
+	args.fspath = C.__u64(uintptr(unsafe.Pointer(&buf[0])))
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_INO_PATHS, uintptr(unsafe.Pointer(&args)))
+	runtime.KeepAlive(buf)
+	if errno != 0 {
+		return nil, fmt.Errorf("Failed to resolve the paths of inode %d in '%s': %v", inum, path, errno.Error())
+	}
+
+	// the values are offsets of the zero terminated paths relative to the values
+	c := newDataContainer(buf)
+	var paths []string
+	for i := uint32(0); i < c.elemCnt; i++ {
+		p := c.val[c.u64(i):]
+		if n := bytes.IndexByte(p, 0); n >= 0 {
+			p = p[:n]
+		}
+		paths = append(paths, string(p))
+	}
+	return paths, nil
+}
+
+// LogicalInoResult is an inode referencing a logical address
+type LogicalInoResult struct {
+	Inode uint64
+	// Offset is the file offset of the logical address
+	Offset uint64
+	// Root is the id of the subvolume containing the inode
+	Root uint64
+}
+
+// LogicalIno returns the inodes referencing the logical address on the filesystem containing path,
+// ignoreOffset returns all references to the extent, the address must be the start of the extent then.
+func LogicalIno(path string, logical uint64, ignoreOffset bool) ([]LogicalInoResult, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	size := logicalInoSize
+	for {
+		buf := make([]byte, size)
+
+		var args C.struct_btrfs_ioctl_logical_ino_args
+		args.logical = C.__u64(logical)
+		args.size = C.__u64(len(buf))
+		args.inodes = C.__u64(uintptr(unsafe.Pointer(&buf[0])))
+		if ignoreOffset {
+			args.flags = C.BTRFS_LOGICAL_INO_ARGS_IGNORE_OFFSET
+		}
+
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_LOGICAL_INO_V2,
+			uintptr(unsafe.Pointer(&args)))
+		runtime.KeepAlive(buf)
+		if errno != 0 {
+			return nil, fmt.Errorf("Failed to resolve the logical address %d in '%s': %v", logical, path, errno.Error())
+		}
+
+		c := newDataContainer(buf)
+		if c.bytesMissing > 0 && size < logicalInoMaxSize {
+			size += int(c.bytesMissing)
+			if size > logicalInoMaxSize {
+				size = logicalInoMaxSize
+			}
+			continue
+		}
+
+		// the values are (inode, offset, root) triples
+		var results []LogicalInoResult
+		for i := uint32(0); i+2 < c.elemCnt; i += 3 {
+			results = append(results, LogicalInoResult{Inode: c.u64(i), Offset: c.u64(i + 1), Root: c.u64(i + 2)})
+		}
+		return results, nil
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"sort"
 	"syscall"
 	"unsafe"
 
@@ -118,16 +119,55 @@ func SubvolDelete(path, name string) error {
 	return nil
 }
 
-func SubvolFindNew(name string, lastGen uint64) (uint64, error) {
-	if ok, err := TestIsSubvolume(name); err != nil {
+// SubvolFlagReadOnly is the read only flag of BTRFS_IOC_SUBVOL_GETFLAGS
+const SubvolFlagReadOnly = uint64(C.BTRFS_SUBVOL_RDONLY)
+
+// SubvolGetFlags returns the flags of the subvolume at path
+func SubvolGetFlags(path string) (uint64, error) {
+	dir, err := openDir(path)
+	if err != nil {
 		return 0, err
+	}
+	defer closeDir(dir)
+
+	var flags C.__u64
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SUBVOL_GETFLAGS,
+		uintptr(unsafe.Pointer(&flags)))
+	if errno != 0 {
+		return 0, fmt.Errorf("Failed to get flags of btrfs subvolume '%s': %v", path, errno.Error())
+	}
+	return uint64(flags), nil
+}
+
+// SubvolSetFlags replaces the flags of the subvolume at path
+func SubvolSetFlags(path string, flags uint64) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	cflags := C.__u64(flags)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SUBVOL_SETFLAGS,
+		uintptr(unsafe.Pointer(&cflags)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to set flags of btrfs subvolume '%s': %v", path, errno.Error())
+	}
+	return nil
+}
+
+// SubvolFindNew returns the current generation of the subvolume and the sorted inodes
+// written since lastGen
+func SubvolFindNew(name string, lastGen uint64) (uint64, []uint64, error) {
+	if ok, err := TestIsSubvolume(name); err != nil {
+		return 0, nil, err
 	} else if !ok {
-		return 0, fmt.Errorf("'%s' is not a subvolume", name)
+		return 0, nil, fmt.Errorf("'%s' is not a subvolume", name)
 	}
 
 	subvolDir, err := openDir(name)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 	defer closeDir(subvolDir)
 
@@ -137,7 +177,7 @@ func SubvolFindNew(name string, lastGen uint64) (uint64, error) {
 	}
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(subvolDir), C.BTRFS_IOC_SYNC, uintptr(unsafe.Pointer(&args)))
 	if errno != 0 {
-		return 0, fmt.Errorf("Failed to fs-sync btrfs subvolume '%s': %v", name, errno.Error())
+		return 0, nil, fmt.Errorf("Failed to fs-sync btrfs subvolume '%s': %v", name, errno.Error())
 	}
 
 	return findUpdatedFiles(subvolDir, 0, lastGen)
@@ -156,83 +196,27 @@ func TestIsSubvolume(name string) (bool, error) {
 }
 
 func findRootGen(dir *C.DIR) (uint64, error) {
-	fd := getDirFd(dir)
-
-	var maxFound uint64 = 0
-	var inoArgs C.struct_btrfs_ioctl_ino_lookup_args
-	var args C.struct_btrfs_ioctl_search_args
-	var sk *C.struct_btrfs_ioctl_search_key = &args.key
-	var sh C.struct_btrfs_ioctl_search_header
-
-	inoArgs.objectid = C.BTRFS_FIRST_FREE_OBJECTID
-
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, C.BTRFS_IOC_INO_LOOKUP, uintptr(unsafe.Pointer(&inoArgs)))
-	if errno != 0 {
-		return 0, fmt.Errorf("Failed to perform the inode lookup %v", errno.Error())
+	rootId, err := findPathRootId(dir)
+	if err != nil {
+		return 0, err
 	}
 
-	sk.tree_id = 1
-	sk.min_objectid = inoArgs.treeid
-	sk.max_objectid = inoArgs.treeid
-	sk.max_type = C.BTRFS_ROOT_ITEM_KEY
-	sk.min_type = C.BTRFS_ROOT_ITEM_KEY
-	sk.max_offset = math.MaxUint64
-	sk.max_transid = math.MaxUint64
-	sk.nr_items = 4096
-
-	for {
-		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, C.BTRFS_IOC_TREE_SEARCH, uintptr(unsafe.Pointer(&args)))
-		if errno != 0 {
-			return 0, fmt.Errorf("Failed to perform the search %v", errno.Error())
-		}
-
-		if sk.nr_items == 0 {
-			break
-		}
-
-		var off uintptr = 0
-
-		for i := C.__u32(0); i < sk.nr_items; i++ {
-			var item *C.struct_btrfs_root_item
-
-			C.memcpy(unsafe.Pointer(&sh), addptr(unsafe.Pointer(&args.buf), off), C.sizeof_struct_btrfs_ioctl_search_header)
-			off += C.sizeof_struct_btrfs_ioctl_search_header
-
-			item = (*C.struct_btrfs_root_item)(unsafe.Pointer(&args.buf[off]))
-			off += uintptr(sh.len)
-
-			sk.min_objectid = sh.objectid
-			sk.min_type = sh._type
-			sk.min_offset = sh.offset
-
-			if sh.objectid > inoArgs.treeid {
-				break
-			}
-
-			if sh.objectid == inoArgs.treeid && sh._type == C.BTRFS_ROOT_ITEM_KEY {
-				rootGeneration := item.generation
-				if maxFound < uint64(rootGeneration) {
-					maxFound = uint64(rootGeneration)
-				}
-			}
-		}
+	it := newTreeSearch(getDirFd(dir), TreeSearch{
+		TreeID: C.BTRFS_ROOT_TREE_OBJECTID,
+		Min:    Key{ObjectID: rootId, Type: C.BTRFS_ROOT_ITEM_KEY},
+		Max:    Key{ObjectID: rootId, Type: C.BTRFS_ROOT_ITEM_KEY, Offset: math.MaxUint64},
+	})
 
-		if sk.min_offset < math.MaxUint64 {
-			sk.min_offset++
-		} else {
-			break
-		}
-
-		if sk.min_type != C.BTRFS_ROOT_ITEM_KEY {
-			break
-		}
-		if sk.min_objectid != inoArgs.treeid {
-			break
+	var maxFound uint64 = 0
+	for it.Next() {
+		item := (*C.struct_btrfs_root_item)(it.raw())
+		rootGeneration := uint64(item.generation)
+		if maxFound < rootGeneration {
+			maxFound = rootGeneration
 		}
-
 	}
 
-	return maxFound, nil
+	return maxFound, it.Err()
 }
 
 func findPathRootId(dir *C.DIR) (uint64, error) {
@@ -249,84 +233,23 @@ func findPathRootId(dir *C.DIR) (uint64, error) {
 	return uint64(args.treeid), nil
 }
 
-func findUpdatedFiles(dir *C.DIR, rootId, oldestGen uint64) (uint64, error) {
-	var maxFound uint64 = 0
-
-	var args C.struct_btrfs_ioctl_search_args
-	var sk *C.struct_btrfs_ioctl_search_key = &args.key
-	var sh C.struct_btrfs_ioctl_search_header
-	var item *BtrfsFileExtentItem
-	var backup BtrfsFileExtentItem
-
-	var foundGen uint64 = 0
-
-	sk.tree_id = C.__u64(rootId)
-	sk.max_objectid = math.MaxUint64
-	sk.max_offset = math.MaxUint64
-	sk.max_transid = math.MaxUint64
-	sk.max_type = C.BTRFS_EXTENT_DATA_KEY
-	sk.min_transid = C.__u64(oldestGen)
-	sk.nr_items = 4096
-
-	fd := getDirFd(dir)
-
+func findUpdatedFiles(dir *C.DIR, rootId, oldestGen uint64) (uint64, []uint64, error) {
 	maxFound, err := findRootGen(dir)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
-	for {
-		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, C.BTRFS_IOC_TREE_SEARCH, uintptr(unsafe.Pointer(&args)))
-		if errno != 0 {
-			return 0, fmt.Errorf("Failed to perform the search %v", errno.Error())
-		}
-
-		if sk.nr_items == 0 {
-			break
-		}
-
-		var off uintptr = 0
-
-		for i := uint32(0); i < uint32(sk.nr_items); i++ {
-			C.memcpy(unsafe.Pointer(&sh), addptr(unsafe.Pointer(&args.buf), off), C.sizeof_struct_btrfs_ioctl_search_header)
-			off += C.sizeof_struct_btrfs_ioctl_search_header
-
-			if sh.len == 0 {
-				item = &backup
-			} else {
-				rawItem := (*C.struct_btrfs_file_extent_item)(addptr(unsafe.Pointer(&args.buf), off))
-				item, err = NewBtrfsFileExtentItem(rawItem)
-				if err != nil {
-					return 0, err
-				}
-			}
-
-			foundGen = item.Generation
-			if sh._type == C.BTRFS_EXTENT_DATA_KEY && foundGen >= uint64(oldestGen) {
-				// print...
-			}
-
-			off += uintptr(sh.len)
-
-			sk.min_objectid = sh.objectid
-			sk.min_offset = sh.offset
-			sk.min_type = sh._type
-		}
-
-		sk.nr_items = 4096
-		if sk.min_offset < math.MaxUint64 {
-			sk.min_offset++
-		} else if sk.min_objectid < math.MaxUint64 {
-			sk.min_objectid++
-			sk.min_offset = 0
-			sk.min_type = 0
-
-		} else {
-			break
-		}
+	updated, err := findUpdatedInodes(getDirFd(dir), rootId, oldestGen)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	return maxFound, nil
+	inodes := make([]uint64, 0, len(updated))
+	for ino := range updated {
+		inodes = append(inodes, ino)
+	}
+	sort.Slice(inodes, func(i, j int) bool { return inodes[i] < inodes[j] })
+	return maxFound, inodes, nil
 }
 
 type SubvolSearchResult struct {
@@ -335,193 +258,175 @@ type SubvolSearchResult struct {
 	CGen         uint64
 	Parent       uint64
 	TopLevel     uint64
+	Flags        uint64
+	DirId        uint64
+	Name         string
 	OTime        BtrfsTimespec
 	ParentUUID   uuid.UUID
 	ReceivedUUID uuid.UUID
 	UUID         uuid.UUID
-	Path         string
+	// CTransid is the transid of the last change, STransid the one of the sent subvolume
+	// if the subvolume was received
+	CTransid uint64
+	STransid uint64
+	Path     string
 }
 
-func subvolSearch(dir *C.DIR) /**C.struct_root_lookup,*/ error {
-	fd := getDirFd(dir)
-
-	//fmt.Printf("Run list...: %v", fd)
-
-	//var root_lookup *C.struct_root_lookup
-
-	var args C.struct_btrfs_ioctl_search_args
-	var sk *C.struct_btrfs_ioctl_search_key = &args.key
-	var sh C.struct_btrfs_ioctl_search_header
-
-	var ref *C.struct_btrfs_root_ref
-	var ri *C.struct_btrfs_root_item
-
-	var dirId uint64
-	var ogen uint64
-	var gen uint64
-	var flags uint64
-	var t uint64
-
-	var ouuid, puuid, ruuid uuid.UUID
-	emptyUUID := uuid.UUID{}
-
-	/* search in the tree of tree roots */
-	sk.tree_id = 1
+// IsReadOnly reports whether the subvolume has the read only flag
+func (r *SubvolSearchResult) IsReadOnly() bool {
+	return r.Flags&C.BTRFS_ROOT_SUBVOL_RDONLY != 0
+}
 
-	/*
-	 * set the min and max to backref keys.  The search will
-	 * only send back this type of key now.
-	 */
-	sk.max_type = C.BTRFS_ROOT_BACKREF_KEY
-	sk.min_type = C.BTRFS_ROOT_ITEM_KEY
+func subvolSearch(dir *C.DIR) ([]SubvolSearchResult, error) {
+	fd := getDirFd(dir)
 
-	sk.min_objectid = C.BTRFS_FIRST_FREE_OBJECTID
+	roots := map[uint64]*SubvolSearchResult{}
+	root := func(id uint64) *SubvolSearchResult {
+		r, ok := roots[id]
+		if !ok {
+			r = &SubvolSearchResult{Id: id}
+			roots[id] = r
+		}
+		return r
+	}
 
-	/*
-	 * set all the other params to the max, we'll take any objectid
-	 * and any trans
-	 */
-	sk.max_objectid = C.BTRFS_LAST_FREE_OBJECTID & (1<<64 - 1)
-	sk.max_offset = math.MaxUint64
-	sk.max_transid = math.MaxUint64
+	// the root items and backrefs of the subvolumes in the tree of tree roots
+	it := newTreeSearch(fd, TreeSearch{
+		TreeID: C.BTRFS_ROOT_TREE_OBJECTID,
+		Min:    Key{ObjectID: C.BTRFS_FIRST_FREE_OBJECTID, Type: C.BTRFS_ROOT_ITEM_KEY},
+		Max:    Key{ObjectID: C.BTRFS_LAST_FREE_OBJECTID & (1<<64 - 1), Type: C.BTRFS_ROOT_BACKREF_KEY, Offset: math.MaxUint64},
+	})
+
+	for it.Next() {
+		sh := it.Header()
+
+		switch sh.Key.Type {
+		case C.BTRFS_ROOT_BACKREF_KEY:
+			goref, err := NewBtrfsRootRef(it.Item())
+			if err != nil {
+				return nil, err
+			}
 
-	fmt.Printf("SK: %#v\n", sk)
+			r := root(sh.Key.ObjectID)
+			r.Parent = sh.Key.Offset
+			r.TopLevel = sh.Key.Offset
+			r.DirId = goref.DirId
+			r.Name = goref.Name
+
+		case C.BTRFS_ROOT_ITEM_KEY:
+			ri := (*C.struct_btrfs_root_item)(it.raw())
+			gori, err := NewBtrfsRootItem(ri)
+			if err != nil {
+				return nil, err
+			}
 
-	sk.nr_items = 4096
+			r := root(sh.Key.ObjectID)
+			r.Gen = gori.Generation
+			r.Flags = gori.Flags
+
+			// the old root items have no uuids and times
+			if sh.Len > C.sizeof_struct_btrfs_root_item_v0 {
+				r.CGen = gori.OTransId
+				r.OTime = gori.OTime
+				r.UUID = gori.UUID
+				r.ParentUUID = gori.ParentUUID
+				r.ReceivedUUID = gori.ReceivedUUID
+				r.CTransid = gori.CTransId
+				r.STransid = gori.STransId
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
 
-	for {
-		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, C.BTRFS_IOC_TREE_SEARCH, uintptr(unsafe.Pointer(&args)))
-		if errno != 0 {
-			return fmt.Errorf("Failed to perform the search %v", errno.Error())
+	var results []SubvolSearchResult
+	for _, r := range roots {
+		// deleted subvolumes keep the root item until cleaned up, but have no backref
+		if r.Parent == 0 {
+			continue
 		}
 
-		if sk.nr_items == 0 {
-			break
+		path, err := subvolPath(fd, roots, r)
+		if err != nil {
+			return nil, err
 		}
+		r.Path = path
+		results = append(results, *r)
+	}
 
-		var off uintptr = 0
-		for i := uint32(0); i < uint32(sk.nr_items); i++ {
-
-			C.memcpy(unsafe.Pointer(&sh), addptr(unsafe.Pointer(&args.buf), off), C.sizeof_struct_btrfs_ioctl_search_header)
-			off += C.sizeof_struct_btrfs_ioctl_search_header
-
-			if sh._type == C.BTRFS_ROOT_BACKREF_KEY {
-				ref = (*C.struct_btrfs_root_ref)(addptr(unsafe.Pointer(&args.buf), off))
-				goref, err := NewBtrfsRootRef(ref)
-				if err != nil {
-					return err
-				}
-
-				dirId = goref.DirId
-				name := C.GoStringN((*C.char)(addptr(unsafe.Pointer(ref), C.sizeof_struct_btrfs_root_ref)), C.int(goref.NameLen))
-
-				ssr := SubvolSearchResult{
-					Id:       sh.objectid,
-					Gen:      0,
-					CGen:     0,
-					Parent:   sh.offset,
-					TopLevel: sh.offset, /* use ref_id? */
-
-					/* empty */
-					/*
-						OTime
-						UUID
-						ParentUUID
-						ReceivedUUID
-					*/
-
-					/*
-						Path: TBD
-					*/
-				}
-
-				fmt.Printf("objId: %v, offs: %v, dirId: %v, name: %v, nameLen: %v\n", sh.objectid, sh.offset, dirId, name, goref.NameLen)
-
-			} else if sh._type == C.BTRFS_ROOT_ITEM_KEY {
-				ri = (*C.struct_btrfs_root_item)(addptr(unsafe.Pointer(&args.buf), off))
-				gori, err := NewBtrfsRootItem(ri)
-				if err != nil {
-					return err
-				}
-
-				//fmt.Printf("RI: %#v\n", gori)
-				gen = gori.Generation
-				flags = gori.Flags
-
-				if sh.len > C.sizeof_struct_btrfs_root_item_v0 {
-
-					t = gori.OTime.Sec
-					ogen = gori.OTransId
-					ouuid = gori.UUID
-					puuid = gori.ParentUUID
-					ruuid = gori.ReceivedUUID
-				} else {
-					ouuid = emptyUUID
-					puuid = emptyUUID
-					ruuid = emptyUUID
-				}
-
-				fmt.Printf("objId: %v, offs: %v, flags: %X, ogen: %v, gen: %v, time: %v, uuid: %s, puuid: %s, ruuid: %s\n",
-					sh.objectid, sh.offset, flags, ogen, gen, t, ouuid, puuid, ruuid)
-			}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Id < results[j].Id
+	})
 
-			off += uintptr(sh.len)
-			/*
-			 * record the mins in sk so we can make sure the
-			 * next search doesn't repeat this root
-			 */
-			sk.min_objectid = sh.objectid
-			sk.min_type = sh._type
-			sk.min_offset = sh.offset
+	return results, nil
+}
 
-		}
+// subvolPath resolves the path of the subvolume relative to the top level subvolume
+func subvolPath(fd uintptr, roots map[uint64]*SubvolSearchResult, r *SubvolSearchResult) (string, error) {
+	if len(r.Path) > 0 {
+		return r.Path, nil
+	}
 
-		sk.nr_items = 4096
-		sk.min_offset++
-		if sk.min_offset == 0 {
-			sk.min_type++
-		} else {
-			continue
+	var prefix string
+	if r.Parent != C.BTRFS_FS_TREE_OBJECTID {
+		parent, ok := roots[r.Parent]
+		if !ok || parent.Parent == 0 {
+			return "", fmt.Errorf("Failed to resolve the path of subvolume %d, parent %d not found", r.Id, r.Parent)
 		}
 
-		if sk.min_type > C.BTRFS_ROOT_BACKREF_KEY {
-			sk.min_type = C.BTRFS_ROOT_ITEM_KEY
-			sk.min_objectid++
-		} else {
-			continue
+		var err error
+		prefix, err = subvolPath(fd, roots, parent)
+		if err != nil {
+			return "", err
 		}
+		prefix += "/"
+	}
 
-		if sk.min_objectid > sk.max_objectid {
-			break
-		}
+	// the directory of the subvolume inside of its parent
+	var args C.struct_btrfs_ioctl_ino_lookup_args
+	args.treeid = C.__u64(r.Parent)
+	args.objectid = C.__u64(r.DirId)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, C.BTRFS_IOC_INO_LOOKUP, uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return "", fmt.Errorf("Failed to perform the inode lookup %v", errno.Error())
 	}
 
-	return nil
+	r.Path = prefix + C.GoString(&args.name[0]) + r.Name
+	return r.Path, nil
 }
 
-func SubvolList(name string, lastGen uint64) error {
+// SubvolList returns all subvolumes of the filesystem, the paths are relative to the top level subvolume
+func SubvolList(name string) ([]SubvolSearchResult, error) {
 	if ok, err := TestIsSubvolume(name); err != nil {
-		return err
+		return nil, err
 	} else if !ok {
-		return fmt.Errorf("'%s' is not a subvolume", name)
+		return nil, fmt.Errorf("'%s' is not a subvolume", name)
 	}
 
-	subvolDir, err := openDir(name)
+	return SubvolListAll(name)
+}
+
+// SubvolListAll returns all subvolumes of the filesystem containing path, which can be any file
+// or directory of the filesystem
+func SubvolListAll(path string) ([]SubvolSearchResult, error) {
+	dir, err := openDir(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer closeDir(subvolDir)
+	defer closeDir(dir)
 
-	// var args C.struct_btrfs_ioctl_vol_args
-	// for i, c := range []byte(name) {
-	// 	args.name[i] = C.char(c)
-	// }
-	// _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(subvolDir), C.BTRFS_IOC_SYNC, uintptr(unsafe.Pointer(&args)))
-	// if errno != 0 {
-	// 	return 0, fmt.Errorf("Failed to fs-sync btrfs subvolume '%s': %v", name, errno.Error())
-	// }
+	return subvolSearch(dir)
+}
 
-	// return findUpdatedFiles(subvolDir, 0, lastGen)
+// GetRootId returns the id of the subvolume containing path
+func GetRootId(path string) (uint64, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDir(dir)
 
-	return subvolSearch(subvolDir)
+	return findPathRootId(dir)
 }
@@ -0,0 +1,102 @@
+package ioctl_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/plar/btrfs/internal/btrfstest"
+	"github.com/plar/btrfs/ioctl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+const (
+	inodeItemKey = 1  // BTRFS_INODE_ITEM_KEY
+	xattrItemKey = 24 // BTRFS_XATTR_ITEM_KEY
+)
+
+func TestTreeSearch(t *testing.T) {
+	assert.NoError(t, ioctl.SubvolCreate(mount, "search"))
+	subvol := filepath.Join(mount, "search")
+
+	// the items of the files don't fit in one buffer, the xattr item alone is larger than it
+	const bufSize = 4096
+	defer ioctl.SetTreeSearchBufSize(ioctl.SetTreeSearchBufSize(bufSize))
+
+	const files = 200
+	for i := 0; i < files; i++ {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(subvol, fmt.Sprintf("file%03d", i)), nil, 0600))
+	}
+	xattr := bytes.Repeat([]byte("x"), 3*bufSize)
+	assert.NoError(t, syscall.Setxattr(filepath.Join(subvol, "file000"), "user.large", xattr, 0))
+	syscall.Sync()
+
+	it, err := ioctl.NewTreeSearch(subvol, ioctl.TreeSearch{Min: ioctl.Key{ObjectID: 256}, Max: ioctl.MaxKey})
+	assert.NoError(t, err)
+	defer it.Close()
+
+	var keys []ioctl.Key
+	inodes, size := 0, 0
+	var large *ioctl.SearchHeader
+	for it.Next() {
+		sh := it.Header()
+		assert.Len(t, it.Item(), int(sh.Len))
+		if len(keys) > 0 {
+			assert.Equal(t, 1, sh.Key.Compare(keys[len(keys)-1]), "keys out of order at %v", sh.Key)
+		}
+		keys = append(keys, sh.Key)
+		size += int(sh.Len)
+
+		switch {
+		case sh.Key.Type == inodeItemKey:
+			inodes++
+		case sh.Key.Type == xattrItemKey && sh.Len > bufSize:
+			large = &sh
+		}
+	}
+	assert.NoError(t, it.Err())
+
+	// the subvolume directory and the files
+	assert.Equal(t, files+1, inodes)
+	assert.True(t, size > bufSize)
+	if assert.NotNil(t, large) {
+		assert.True(t, int(large.Len) > len(xattr))
+	}
+}
+
+func TestTreeSearchEmptyRange(t *testing.T) {
+	// the search ends before the ioctl which would fail for the missing tree
+	it, err := ioctl.NewTreeSearch(mount, ioctl.TreeSearch{
+		TreeID: 1 << 40,
+		Min:    ioctl.Key{ObjectID: 257},
+		Max:    ioctl.Key{ObjectID: 256},
+	})
+	assert.NoError(t, err)
+	defer it.Close()
+
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+
+	it2, err := ioctl.NewTreeSearch(mount, ioctl.TreeSearch{TreeID: 1 << 40, Max: ioctl.MaxKey})
+	assert.NoError(t, err)
+	defer it2.Close()
+
+	assert.False(t, it2.Next())
+	assert.Error(t, it2.Err())
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
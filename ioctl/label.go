@@ -0,0 +1,59 @@
+package ioctl
+
+/*
+#include <linux/fs.h>
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// MaxLabelLength is the longest filesystem label
+const MaxLabelLength = C.BTRFS_LABEL_SIZE - 1
+
+// GetLabel returns the label of the filesystem mounted at path
+func GetLabel(path string) (string, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return "", err
+	}
+	defer closeDir(dir)
+
+	var label [C.BTRFS_LABEL_SIZE]C.char
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_GET_FSLABEL,
+		uintptr(unsafe.Pointer(&label[0])))
+	if errno != 0 {
+		return "", fmt.Errorf("Failed to get the label of '%s': %v", path, errno.Error())
+	}
+	return C.GoString(&label[0]), nil
+}
+
+// SetLabel changes the label of the filesystem mounted at path
+func SetLabel(path, label string) error {
+	if len(label) > MaxLabelLength {
+		return fmt.Errorf("label is too long, max length is %d", MaxLabelLength)
+	}
+
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var clabel [C.BTRFS_LABEL_SIZE]C.char
+	for i, c := range []byte(label) {
+		clabel[i] = C.char(c)
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SET_FSLABEL,
+		uintptr(unsafe.Pointer(&clabel[0])))
+	if errno != 0 {
+		return fmt.Errorf("Failed to set the label of '%s': %v", path, errno.Error())
+	}
+	return nil
+}
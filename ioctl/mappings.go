@@ -20,7 +20,9 @@ import "C"
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"reflect"
 	"strconv"
@@ -87,12 +89,14 @@ type BtrfsRootItem struct {
 	OTime        BtrfsTimespec
 	STime        BtrfsTimespec
 	RTime        BtrfsTimespec
+	Reserved     [8]uint64
 }
 
 type BtrfsRootRef struct {
 	DirId    uint64
 	Sequence uint64
 	NameLen  uint16
+	Name     string `len:"NameLen"`
 }
 
 // 874 struct btrfs_file_extent_item {
@@ -160,6 +164,290 @@ type BtrfsFileExtentItem struct {
 	NumBytes      uint64
 }
 
+// struct btrfs_qgroup_info_item {
+//     __le64 generation;
+//     __le64 rfer;
+//     __le64 rfer_cmpr;
+//     __le64 excl;
+//     __le64 excl_cmpr;
+// } __attribute__ ((__packed__));
+
+type BtrfsQgroupInfoItem struct {
+	Generation uint64
+	Rfer       uint64
+	RferCmpr   uint64
+	Excl       uint64
+	ExclCmpr   uint64
+}
+
+// struct btrfs_qgroup_limit_item {
+//     __le64 flags;
+//     __le64 max_rfer;
+//     __le64 max_excl;
+//     __le64 rsv_rfer;
+//     __le64 rsv_excl;
+// } __attribute__ ((__packed__));
+
+type BtrfsQgroupLimitItem struct {
+	Flags   uint64
+	MaxRfer uint64
+	MaxExcl uint64
+	RsvRfer uint64
+	RsvExcl uint64
+}
+
+// struct btrfs_disk_key {
+//     __le64 objectid;
+//     u8 type;
+//     __le64 offset;
+// } __attribute__ ((__packed__));
+
+type BtrfsDiskKey struct {
+	ObjectId uint64
+	Type     uint8
+	Offset   uint64
+}
+
+// struct btrfs_inode_item {                                                    /*offs*/
+//     __le64 generation;                                                       0x00
+//     __le64 transid;                                                          0x08
+//     __le64 size;                                                             0x10
+//     __le64 nbytes;                                                           0x18
+//     __le64 block_group;                                                      0x20
+//     __le32 nlink;                                                            0x28
+//     __le32 uid;                                                              0x2c
+//     __le32 gid;                                                              0x30
+//     __le32 mode;                                                             0x34
+//     __le64 rdev;                                                             0x38
+//     __le64 flags;                                                            0x40
+//     __le64 sequence;                                                         0x48
+//     __le64 reserved[4];                                                      0x50
+//     struct btrfs_timespec atime;                                             0x70
+//     struct btrfs_timespec ctime;                                             0x7c
+//     struct btrfs_timespec mtime;                                             0x88
+//     struct btrfs_timespec otime;                                             0x94
+// } __attribute__ ((__packed__));
+
+type BtrfsInodeItem struct {
+	Generation uint64
+	TransId    uint64
+	Size       uint64
+	NBytes     uint64
+	BlockGroup uint64
+	NLink      uint32
+	Uid        uint32
+	Gid        uint32
+	Mode       uint32
+	RDev       uint64
+	Flags      uint64
+	Sequence   uint64
+	Reserved   [4]uint64
+	ATime      BtrfsTimespec
+	CTime      BtrfsTimespec
+	MTime      BtrfsTimespec
+	OTime      BtrfsTimespec
+}
+
+// struct btrfs_inode_ref {
+//     __le64 index;
+//     __le16 name_len;
+//     /* name goes here */
+// } __attribute__ ((__packed__));
+
+type BtrfsInodeRef struct {
+	Index   uint64
+	NameLen uint16
+	Name    string `len:"NameLen"`
+}
+
+// struct btrfs_inode_extref {
+//     __le64 parent_objectid;
+//     __le64 index;
+//     __le16 name_len;
+//     __u8   name[];
+//     /* name goes here */
+// } __attribute__ ((__packed__));
+
+type BtrfsInodeExtref struct {
+	ParentObjectId uint64
+	Index          uint64
+	NameLen        uint16
+	Name           string `len:"NameLen"`
+}
+
+// struct btrfs_dir_item {
+//     struct btrfs_disk_key location;
+//     __le64 transid;
+//     __le16 data_len;
+//     __le16 name_len;
+//     u8 type;
+//     /* name and data of xattrs go here */
+// } __attribute__ ((__packed__));
+
+type BtrfsDirItem struct {
+	Location BtrfsDiskKey
+	TransId  uint64
+	DataLen  uint16
+	NameLen  uint16
+	Type     uint8
+	Name     string `len:"NameLen"`
+	Data     []byte `len:"DataLen"`
+}
+
+// struct btrfs_extent_item {
+//     __le64 refs;
+//     __le64 generation;
+//     __le64 flags;
+// } __attribute__ ((__packed__));
+//
+// struct btrfs_tree_block_info {
+//     struct btrfs_disk_key key;
+//     u8 level;
+// } __attribute__ ((__packed__));
+//
+// struct btrfs_extent_inline_ref {
+//     u8 type;
+//     __le64 offset;
+// } __attribute__ ((__packed__));
+
+type BtrfsExtentItem struct {
+	Refs       uint64
+	Generation uint64
+	Flags      uint64
+
+	// TreeBlockKey and TreeBlockLevel are set for the tree blocks of an EXTENT_ITEM,
+	// a METADATA_ITEM stores the level in the key offset
+	TreeBlockKey   BtrfsDiskKey `btrfs:"-"`
+	TreeBlockLevel uint8        `btrfs:"-"`
+
+	InlineRefs []BtrfsExtentInlineRef `btrfs:"-"`
+}
+
+type BtrfsExtentInlineRef struct {
+	Type uint8
+	// Offset is the root of a tree block ref or the parent of a shared block ref and a shared data ref
+	Offset uint64
+	// DataRef is the reference of an extent data ref
+	DataRef BtrfsExtentDataRef
+	// Count is the number of references of a shared data ref
+	Count uint32
+}
+
+// struct btrfs_extent_data_ref {
+//     __le64 root;
+//     __le64 objectid;
+//     __le64 offset;
+//     __le32 count;
+// } __attribute__ ((__packed__));
+
+type BtrfsExtentDataRef struct {
+	Root     uint64
+	ObjectId uint64
+	Offset   uint64
+	Count    uint32
+}
+
+// struct btrfs_block_group_item {
+//     __le64 used;
+//     __le64 chunk_objectid;
+//     __le64 flags;
+// } __attribute__ ((__packed__));
+
+type BtrfsBlockGroupItem struct {
+	Used          uint64
+	ChunkObjectId uint64
+	Flags         uint64
+}
+
+// struct btrfs_chunk {
+//     __le64 length;
+//     __le64 owner;
+//     __le64 stripe_len;
+//     __le64 type;
+//     __le32 io_align;
+//     __le32 io_width;
+//     __le32 sector_size;
+//     __le16 num_stripes;
+//     __le16 sub_stripes;
+//     struct btrfs_stripe stripe;
+//     /* additional stripes go here */
+// } __attribute__ ((__packed__));
+//
+// struct btrfs_stripe {
+//     __le64 devid;
+//     __le64 offset;
+//     u8 dev_uuid[BTRFS_UUID_SIZE];
+// } __attribute__ ((__packed__));
+
+type BtrfsChunk struct {
+	Length     uint64
+	Owner      uint64
+	StripeLen  uint64
+	Type       uint64
+	IOAlign    uint32
+	IOWidth    uint32
+	SectorSize uint32
+	NumStripes uint16
+	SubStripes uint16
+	Stripes    []BtrfsStripe `len:"NumStripes"`
+}
+
+type BtrfsStripe struct {
+	DevId   uint64
+	Offset  uint64
+	DevUUID uuid.UUID
+}
+
+// struct btrfs_dev_item {
+//     __le64 devid;
+//     __le64 total_bytes;
+//     __le64 bytes_used;
+//     __le32 io_align;
+//     __le32 io_width;
+//     __le32 sector_size;
+//     __le64 type;
+//     __le64 generation;
+//     __le64 start_offset;
+//     __le32 dev_group;
+//     u8 seek_speed;
+//     u8 bandwidth;
+//     u8 uuid[BTRFS_UUID_SIZE];
+//     u8 fsid[BTRFS_UUID_SIZE];
+// } __attribute__ ((__packed__));
+
+type BtrfsDevItem struct {
+	DevId       uint64
+	TotalBytes  uint64
+	BytesUsed   uint64
+	IOAlign     uint32
+	IOWidth     uint32
+	SectorSize  uint32
+	Type        uint64
+	Generation  uint64
+	StartOffset uint64
+	DevGroup    uint32
+	SeekSpeed   uint8
+	Bandwidth   uint8
+	UUID        uuid.UUID
+	FSID        uuid.UUID
+}
+
+// struct btrfs_dev_extent {
+//     __le64 chunk_tree;
+//     __le64 chunk_objectid;
+//     __le64 chunk_offset;
+//     __le64 length;
+//     u8 chunk_tree_uuid[BTRFS_UUID_SIZE];
+// } __attribute__ ((__packed__));
+
+type BtrfsDevExtent struct {
+	ChunkTree     uint64
+	ChunkObjectId uint64
+	ChunkOffset   uint64
+	Length        uint64
+	ChunkTreeUUID uuid.UUID
+}
+
 func NewBtrfsRootItem(s *C.struct_btrfs_root_item) (*BtrfsRootItem, error) {
 	raw := unsafe.Pointer(s)
 	data := *(*[C.sizeof_struct_btrfs_root_item]byte)(raw)
@@ -170,15 +458,11 @@ func NewBtrfsRootItem(s *C.struct_btrfs_root_item) (*BtrfsRootItem, error) {
 	return ri, err
 }
 
-func NewBtrfsRootRef(s *C.struct_btrfs_root_ref) (*BtrfsRootRef, error) {
-	raw := unsafe.Pointer(s)
-	data := *(*[C.sizeof_struct_btrfs_root_ref]byte)(raw)
-	r := bytes.NewReader(data[:])
-
-	var rr *BtrfsRootRef = &BtrfsRootRef{}
-	err := NewStruct(rr, r)
+// NewBtrfsRootRef maps a ROOT_REF or ROOT_BACKREF item with the name
+func NewBtrfsRootRef(data []byte) (*BtrfsRootRef, error) {
+	rr := &BtrfsRootRef{}
+	err := decodeItem(rr, data, C.sizeof_struct_btrfs_root_ref, "btrfs_root_ref")
 	return rr, err
-
 }
 
 func NewBtrfsFileExtentItem(s *C.struct_btrfs_file_extent_item) (*BtrfsFileExtentItem, error) {
@@ -191,76 +475,606 @@ func NewBtrfsFileExtentItem(s *C.struct_btrfs_file_extent_item) (*BtrfsFileExten
 	return fei, err
 }
 
+func NewBtrfsQgroupInfoItem(s *C.struct_btrfs_qgroup_info_item) (*BtrfsQgroupInfoItem, error) {
+	raw := unsafe.Pointer(s)
+	data := *(*[C.sizeof_struct_btrfs_qgroup_info_item]byte)(raw)
+	r := bytes.NewReader(data[:])
+
+	var qi *BtrfsQgroupInfoItem = &BtrfsQgroupInfoItem{}
+	err := NewStruct(qi, r)
+	return qi, err
+}
+
+func NewBtrfsQgroupLimitItem(s *C.struct_btrfs_qgroup_limit_item) (*BtrfsQgroupLimitItem, error) {
+	raw := unsafe.Pointer(s)
+	data := *(*[C.sizeof_struct_btrfs_qgroup_limit_item]byte)(raw)
+	r := bytes.NewReader(data[:])
+
+	var ql *BtrfsQgroupLimitItem = &BtrfsQgroupLimitItem{}
+	err := NewStruct(ql, r)
+	return ql, err
+}
+
+// decodeEntry maps the next entry of an item to dest, the fixed part of the entry must have size bytes
+func decodeEntry(dest interface{}, r *bytes.Reader, size int, name string) error {
+	if r.Len() < size {
+		return fmt.Errorf("%s has %d bytes, expected at least %d", name, r.Len(), size)
+	}
+	if err := NewStruct(dest, r); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// decodeItem maps the item to dest, the fixed part of the item must have size bytes
+func decodeItem(dest interface{}, data []byte, size int, name string) error {
+	return decodeEntry(dest, bytes.NewReader(data), size, name)
+}
+
+func NewBtrfsInodeItem(data []byte) (*BtrfsInodeItem, error) {
+	ii := &BtrfsInodeItem{}
+	err := decodeItem(ii, data, C.sizeof_struct_btrfs_inode_item, "btrfs_inode_item")
+	return ii, err
+}
+
+// NewBtrfsInodeRefs returns the refs of an INODE_REF item, one per hard link in the parent directory
+func NewBtrfsInodeRefs(data []byte) ([]BtrfsInodeRef, error) {
+	var refs []BtrfsInodeRef
+	for r := bytes.NewReader(data); r.Len() > 0; {
+		var ref BtrfsInodeRef
+		if err := decodeEntry(&ref, r, C.sizeof_struct_btrfs_inode_ref, "btrfs_inode_ref"); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// NewBtrfsInodeExtrefs returns the refs of an INODE_EXTREF item
+func NewBtrfsInodeExtrefs(data []byte) ([]BtrfsInodeExtref, error) {
+	var refs []BtrfsInodeExtref
+	for r := bytes.NewReader(data); r.Len() > 0; {
+		var ref BtrfsInodeExtref
+		if err := decodeEntry(&ref, r, C.sizeof_struct_btrfs_inode_extref, "btrfs_inode_extref"); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// NewBtrfsDirItems returns the entries of a DIR_ITEM, DIR_INDEX or XATTR_ITEM item,
+// a DIR_ITEM has several entries if their names have the same hash
+func NewBtrfsDirItems(data []byte) ([]BtrfsDirItem, error) {
+	var items []BtrfsDirItem
+	for r := bytes.NewReader(data); r.Len() > 0; {
+		var di BtrfsDirItem
+		if err := decodeEntry(&di, r, C.sizeof_struct_btrfs_dir_item, "btrfs_dir_item"); err != nil {
+			return nil, err
+		}
+		items = append(items, di)
+	}
+	return items, nil
+}
+
+// extentOwnerRefKey is BTRFS_EXTENT_OWNER_REF_KEY of the simple quotas, missing in older headers
+const extentOwnerRefKey = 172
+
+// NewBtrfsExtentItem maps an EXTENT_ITEM or a METADATA_ITEM with its inline refs
+func NewBtrfsExtentItem(keyType uint8, data []byte) (*BtrfsExtentItem, error) {
+	r := bytes.NewReader(data)
+
+	ei := &BtrfsExtentItem{}
+	err := decodeEntry(ei, r, C.sizeof_struct_btrfs_extent_item, "btrfs_extent_item")
+	if err != nil {
+		return nil, err
+	}
+
+	if keyType == C.BTRFS_EXTENT_ITEM_KEY && ei.Flags&C.BTRFS_EXTENT_FLAG_TREE_BLOCK != 0 {
+		var info struct {
+			Key   BtrfsDiskKey
+			Level uint8
+		}
+		err := decodeEntry(&info, r, C.sizeof_struct_btrfs_tree_block_info, "btrfs_tree_block_info")
+		if err != nil {
+			return nil, err
+		}
+		ei.TreeBlockKey = info.Key
+		ei.TreeBlockLevel = info.Level
+	}
+
+	for r.Len() > 0 {
+		ref := BtrfsExtentInlineRef{}
+		ref.Type, _ = r.ReadByte()
+
+		// the data ref replaces the offset, the shared data ref count follows it
+		switch ref.Type {
+		case C.BTRFS_EXTENT_DATA_REF_KEY:
+			err = decodeEntry(&ref.DataRef, r, C.sizeof_struct_btrfs_extent_data_ref, "btrfs_extent_data_ref")
+		case C.BTRFS_SHARED_DATA_REF_KEY:
+			var shared struct {
+				Offset uint64
+				Count  uint32
+			}
+			err = decodeEntry(&shared, r, 8+C.sizeof_struct_btrfs_shared_data_ref, "btrfs_shared_data_ref")
+			ref.Offset, ref.Count = shared.Offset, shared.Count
+		case C.BTRFS_TREE_BLOCK_REF_KEY, C.BTRFS_SHARED_BLOCK_REF_KEY, extentOwnerRefKey:
+			var inline struct {
+				Offset uint64
+			}
+			err = decodeEntry(&inline, r, 8, "btrfs_extent_inline_ref")
+			ref.Offset = inline.Offset
+		default:
+			return nil, fmt.Errorf("unknown inline ref type %d", ref.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ei.InlineRefs = append(ei.InlineRefs, ref)
+	}
+	return ei, nil
+}
+
+func NewBtrfsExtentDataRef(data []byte) (*BtrfsExtentDataRef, error) {
+	dr := &BtrfsExtentDataRef{}
+	err := decodeItem(dr, data, C.sizeof_struct_btrfs_extent_data_ref, "btrfs_extent_data_ref")
+	return dr, err
+}
+
+func NewBtrfsBlockGroupItem(data []byte) (*BtrfsBlockGroupItem, error) {
+	bg := &BtrfsBlockGroupItem{}
+	err := decodeItem(bg, data, C.sizeof_struct_btrfs_block_group_item, "btrfs_block_group_item")
+	return bg, err
+}
+
+// NewBtrfsChunk maps a CHUNK_ITEM with all its stripes
+func NewBtrfsChunk(data []byte) (*BtrfsChunk, error) {
+	chunk := &BtrfsChunk{}
+	err := decodeItem(chunk, data, C.sizeof_struct_btrfs_chunk, "btrfs_chunk")
+	return chunk, err
+}
+
+func NewBtrfsDevItem(data []byte) (*BtrfsDevItem, error) {
+	di := &BtrfsDevItem{}
+	err := decodeItem(di, data, C.sizeof_struct_btrfs_dev_item, "btrfs_dev_item")
+	return di, err
+}
+
+func NewBtrfsDevExtent(data []byte) (*BtrfsDevExtent, error) {
+	de := &BtrfsDevExtent{}
+	err := decodeItem(de, data, C.sizeof_struct_btrfs_dev_extent, "btrfs_dev_extent")
+	return de, err
+}
+
+// NewBtrfsUUIDItem returns the subvolume ids of a UUID_KEY_SUBVOL or UUID_KEY_RECEIVED_SUBVOL item
+func NewBtrfsUUIDItem(data []byte) ([]uint64, error) {
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("uuid item has %d bytes, expected a multiple of 8", len(data))
+	}
+
+	// the item is an array of le64 subvolume ids
+	var ids []uint64
+	for len(data) >= 8 {
+		ids = append(ids, binary.LittleEndian.Uint64(data))
+		data = data[8:]
+	}
+	return ids, nil
+}
+
+// structSizes pairs the mappings with the size of their C struct, the fixed part of a mapping
+// must have the same size, see TestStructSizes
+var structSizes = []struct {
+	v    interface{}
+	size int
+}{
+	{BtrfsTimespec{}, C.sizeof_struct_btrfs_timespec},
+	{BtrfsDiskKey{}, C.sizeof_struct_btrfs_disk_key},
+	{BtrfsInodeItem{}, C.sizeof_struct_btrfs_inode_item},
+	{BtrfsRootItem{}, C.sizeof_struct_btrfs_root_item},
+	{BtrfsRootRef{}, C.sizeof_struct_btrfs_root_ref},
+	{BtrfsFileExtentItem{}, C.sizeof_struct_btrfs_file_extent_item},
+	{BtrfsQgroupInfoItem{}, C.sizeof_struct_btrfs_qgroup_info_item},
+	{BtrfsQgroupLimitItem{}, C.sizeof_struct_btrfs_qgroup_limit_item},
+	{BtrfsInodeRef{}, C.sizeof_struct_btrfs_inode_ref},
+	{BtrfsInodeExtref{}, C.sizeof_struct_btrfs_inode_extref},
+	{BtrfsDirItem{}, C.sizeof_struct_btrfs_dir_item},
+	{BtrfsExtentItem{}, C.sizeof_struct_btrfs_extent_item},
+	{BtrfsExtentDataRef{}, C.sizeof_struct_btrfs_extent_data_ref},
+	{BtrfsBlockGroupItem{}, C.sizeof_struct_btrfs_block_group_item},
+	// struct btrfs_chunk contains the first stripe
+	{BtrfsChunk{}, C.sizeof_struct_btrfs_chunk - C.sizeof_struct_btrfs_stripe},
+	{BtrfsStripe{}, C.sizeof_struct_btrfs_stripe},
+	{BtrfsDevItem{}, C.sizeof_struct_btrfs_dev_item},
+	{BtrfsDevExtent{}, C.sizeof_struct_btrfs_dev_extent},
+}
+
+var uuidType = reflect.TypeOf(uuid.UUID{})
+
+// NewStruct maps the little endian data of r to the struct dest points to.
+//
+// The fields can be signed and unsigned integers, uuid.UUID, fixed size arrays and structs,
+// the fields tagged with `btrfs:"-"` and the unexported fields are skipped.
+// A `seek:"0x100"` tag moves r to the offset before reading the field, r must be an io.Seeker then.
+// A string or a slice tagged with `len:"NameLen"` is a variable length tail, the number of bytes
+// or elements is the value of the integer field NameLen, which must precede it.
 func NewStruct(dest interface{}, r io.ByteReader) error {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a pointer to a struct, got %T", dest)
+	}
 
-	value := reflect.ValueOf(dest).Elem()
-	typ := value.Type()
+	return decodeStruct(value.Elem(), r)
+}
 
-	for i := 0; i < value.NumField(); i++ {
-		sfl := value.Field(i)
+// fields returns the mapped fields of the struct type
+func fields(typ reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < typ.NumField(); i++ {
 		fl := typ.Field(i)
-		rawSeek := fl.Tag.Get("seek")
-		if len(rawSeek) > 0 {
-			base := 10
-			if strings.HasPrefix(rawSeek, "0x") {
-				base = 16
-				rawSeek = rawSeek[2:]
+		if len(fl.PkgPath) > 0 || fl.Tag.Get("btrfs") == "-" {
+			continue
+		}
+		fields = append(fields, fl)
+	}
+	return fields
+}
+
+func seekOffset(fl reflect.StructField) (int64, bool, error) {
+	rawSeek := fl.Tag.Get("seek")
+	if len(rawSeek) == 0 {
+		return 0, false, nil
+	}
+
+	base := 10
+	if strings.HasPrefix(rawSeek, "0x") {
+		base = 16
+		rawSeek = rawSeek[2:]
+	}
+	seek, err := strconv.ParseUint(rawSeek, base, 32)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: invalid seek tag: %v", fl.Name, err)
+	}
+	return int64(seek), true, nil
+}
+
+// tailLen returns the value of the length field of a len tagged tail
+func tailLen(value reflect.Value, fl reflect.StructField) (int, error) {
+	name := fl.Tag.Get("len")
+	lf, ok := value.Type().FieldByName(name)
+	if !ok || lf.Index[0] >= fl.Index[0] {
+		return 0, fmt.Errorf("%s: length field %s must precede the field", fl.Name, name)
+	}
+
+	switch v := value.FieldByIndex(lf.Index); v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return 0, fmt.Errorf("%s: negative length %d", fl.Name, v.Int())
+		}
+		return int(v.Int()), nil
+	}
+	return 0, fmt.Errorf("%s: length field %s is not an integer", fl.Name, name)
+}
+
+func decodeStruct(value reflect.Value, r io.ByteReader) error {
+	for _, fl := range fields(value.Type()) {
+		sfl := value.FieldByIndex(fl.Index)
+
+		seek, ok, err := seekOffset(fl)
+		if err != nil {
+			return err
+		}
+		if ok {
+			seeker, ok := r.(io.Seeker)
+			if !ok {
+				return errors.New("io.Seeker interface is required")
 			}
-			seek, err := strconv.ParseUint(rawSeek, base, 32)
+			if _, err := seeker.Seek(seek, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+		if len(fl.Tag.Get("len")) > 0 {
+			n, err := tailLen(value, fl)
 			if err != nil {
 				return err
 			}
+			err = decodeTail(sfl, n, r)
+			if err != nil {
+				return fmt.Errorf("%s: %v", fl.Name, err)
+			}
+			continue
+		}
 
-			seeker, ok := r.(io.Seeker)
-			if !ok {
-				return errors.New("io.Seeker interface is required")
+		if err := decodeValue(sfl, r); err != nil {
+			return fmt.Errorf("%s: %v", fl.Name, err)
+		}
+	}
+	return nil
+}
+
+func decodeTail(v reflect.Value, n int, r io.ByteReader) error {
+	switch {
+	case v.Kind() == reflect.String:
+		b, err := readBytes(r, n)
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		b, err := readBytes(r, n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			v.SetBytes(b)
+		}
+	case v.Kind() == reflect.Slice:
+		if n == 0 {
+			return nil
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := decodeValue(s.Index(i), r); err != nil {
+				return err
 			}
-			seeker.Seek(int64(seek), 0)
-		}
-
-		if sfl.IsValid() && sfl.CanSet() {
-			var err error
-			switch fl.Type.Kind() {
-			case reflect.Uint8:
-				u8, err := readU8(r)
-				if err == nil {
-					sfl.SetUint(uint64(u8))
-				}
-			case reflect.Uint16:
-				u16, err := readU16(r)
-				if err == nil {
-					sfl.SetUint(uint64(u16))
-				}
-			case reflect.Uint32:
-				u32, err := readU32(r)
-				if err == nil {
-					sfl.SetUint(uint64(u32))
-				}
-			case reflect.Uint64:
-				u64, err := readU64(r)
-				if err == nil {
-					sfl.SetUint(u64)
-				}
-
-			case reflect.Slice:
-				if sfl.Type() == reflect.TypeOf(uuid.UUID{}) {
-					uuidValue, err := readUUID(r.(io.Reader))
-					if err == nil {
-						sfl.SetBytes([]byte(uuidValue))
-					}
-				} else {
-
-				}
-
-			case reflect.Struct:
-				err = NewStruct(sfl.Addr().Interface(), r)
+		}
+		v.Set(s)
+	default:
+		return fmt.Errorf("unsupported len tagged kind %s", v.Kind())
+	}
+	return nil
+}
+
+func decodeValue(v reflect.Value, r io.ByteReader) error {
+	if v.Type() == uuidType {
+		b, err := readBytes(r, C.BTRFS_UUID_SIZE)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, err := readUint(r, int(v.Type().Size()))
+		if err != nil {
+			return err
+		}
+		v.SetUint(x)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size := int(v.Type().Size())
+		x, err := readUint(r, size)
+		if err != nil {
+			return err
+		}
+		// sign extension
+		shift := uint(64 - 8*size)
+		v.SetInt(int64(x<<shift) >> shift)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := decodeValue(v.Index(i), r); err != nil {
+				return err
 			}
+		}
+	case reflect.Struct:
+		return decodeStruct(v, r)
+	default:
+		return fmt.Errorf("unsupported kind %s", v.Kind())
+	}
+	return nil
+}
 
+func readUint(r io.ByteReader, size int) (uint64, error) {
+	var x uint64
+	var err error
+	switch size {
+	case 1:
+		var u8 uint8
+		u8, err = readU8(r)
+		x = uint64(u8)
+	case 2:
+		var u16 uint16
+		u16, err = readU16(r)
+		x = uint64(u16)
+	case 4:
+		var u32 uint32
+		u32, err = readU32(r)
+		x = uint64(u32)
+	default:
+		x, err = readU64(r)
+	}
+	return x, unexpectedEOF(err)
+}
+
+func readBytes(r io.ByteReader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	for i := range b {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		b[i] = c
+	}
+	return b, nil
+}
+
+// unexpectedEOF reports a truncated value
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Sizeof returns the size of the fixed part of the mapping v, the len tagged tails are not counted
+func Sizeof(v interface{}) (int, error) {
+	typ := reflect.TypeOf(v)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return 0, fmt.Errorf("expected a struct, got %T", v)
+	}
+	return sizeof(typ)
+}
+
+func sizeof(typ reflect.Type) (int, error) {
+	if typ == uuidType {
+		return C.BTRFS_UUID_SIZE, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(typ.Size()), nil
+	case reflect.Array:
+		n, err := sizeof(typ.Elem())
+		return n * typ.Len(), err
+	case reflect.Struct:
+		off := 0
+		for _, fl := range fields(typ) {
+			seek, ok, err := seekOffset(fl)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				off = int(seek)
+			}
+			if len(fl.Tag.Get("len")) > 0 {
+				continue
+			}
+
+			n, err := sizeof(fl.Type)
 			if err != nil {
+				return 0, fmt.Errorf("%s: %v", fl.Name, err)
+			}
+			off += n
+		}
+		return off, nil
+	}
+	return 0, fmt.Errorf("unsupported kind %s", typ.Kind())
+}
+
+// Marshal encodes the struct v in little endian, the reverse of NewStruct. The gaps before seek
+// tagged fields are filled with zeros and the length fields of the len tagged tails are set to
+// the size of the tails.
+func Marshal(v interface{}) ([]byte, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, got %T", v)
+	}
+
+	var buf bytes.Buffer
+	err := encodeStruct(&buf, value)
+	return buf.Bytes(), err
+}
+
+func encodeStruct(buf *bytes.Buffer, value reflect.Value) error {
+	// the sizes of the tails by their length fields
+	lengths := map[string]int{}
+	for _, fl := range fields(value.Type()) {
+		if name := fl.Tag.Get("len"); len(name) > 0 {
+			if _, err := tailLen(value, fl); err != nil {
 				return err
 			}
+			lengths[name] = value.FieldByIndex(fl.Index).Len()
 		}
 	}
 
+	for _, fl := range fields(value.Type()) {
+		sfl := value.FieldByIndex(fl.Index)
+
+		seek, ok, err := seekOffset(fl)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if int(seek) < buf.Len() {
+				return fmt.Errorf("%s: seek to 0x%x behind the end of the previous field 0x%x", fl.Name, seek, buf.Len())
+			}
+			buf.Write(make([]byte, int(seek)-buf.Len()))
+		}
+
+		if len(fl.Tag.Get("len")) > 0 {
+			if err := encodeTail(buf, sfl); err != nil {
+				return fmt.Errorf("%s: %v", fl.Name, err)
+			}
+			continue
+		}
+
+		if n, ok := lengths[fl.Name]; ok {
+			size := sfl.Type().Size()
+			if size < 8 && uint64(n) >= 1<<(8*size) {
+				return fmt.Errorf("%s: length %d doesn't fit", fl.Name, n)
+			}
+			writeUint(buf, uint64(n), int(size))
+			continue
+		}
+
+		if err := encodeValue(buf, sfl); err != nil {
+			return fmt.Errorf("%s: %v", fl.Name, err)
+		}
+	}
 	return nil
 }
+
+func encodeTail(buf *bytes.Buffer, v reflect.Value) error {
+	switch {
+	case v.Kind() == reflect.String:
+		buf.WriteString(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		buf.Write(v.Bytes())
+	case v.Kind() == reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported len tagged kind %s", v.Kind())
+	}
+	return nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	if v.Type() == uuidType {
+		b := make([]byte, C.BTRFS_UUID_SIZE)
+		if v.Len() > 0 && v.Len() != len(b) {
+			return fmt.Errorf("invalid uuid length %d", v.Len())
+		}
+		copy(b, v.Bytes())
+		buf.Write(b)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		writeUint(buf, v.Uint(), int(v.Type().Size()))
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint(buf, uint64(v.Int()), int(v.Type().Size()))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return encodeStruct(buf, v)
+	default:
+		return fmt.Errorf("unsupported kind %s", v.Kind())
+	}
+	return nil
+}
+
+func writeUint(buf *bytes.Buffer, x uint64, size int) {
+	for i := 0; i < size; i++ {
+		buf.WriteByte(byte(x >> (8 * uint(i))))
+	}
+}
@@ -1,7 +1,9 @@
 package ioctl
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
 	"testing"
 
 	"github.com/pborman/uuid"
@@ -78,3 +80,343 @@ func TestNewStruct(t *testing.T) {
 
 	assert.Equal(t, uuid.UUID([]byte{0xa, 0xb, 0xc, 0xd, 0xe, 0xf, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19}), f.UUID)
 }
+
+// le encodes the values of the fixture in little endian
+func le(values ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			v = []byte(s)
+		}
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			panic(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+var testUUID = uuid.UUID(bytes.Repeat([]byte{0xab}, 16))
+
+func TestNewBtrfsInodeItem(t *testing.T) {
+	data := le(uint64(1), uint64(2), uint64(3), uint64(4), uint64(5),
+		uint32(6), uint32(1000), uint32(1001), uint32(0100644),
+		uint64(7), uint64(8), uint64(9), make([]byte, 32),
+		uint64(10), uint32(11), uint64(12), uint32(13), uint64(14), uint32(15), uint64(16), uint32(17))
+	assert.Len(t, data, 160)
+
+	ii, err := NewBtrfsInodeItem(data)
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsInodeItem{
+		Generation: 1, TransId: 2, Size: 3, NBytes: 4, BlockGroup: 5,
+		NLink: 6, Uid: 1000, Gid: 1001, Mode: 0100644, RDev: 7, Flags: 8, Sequence: 9,
+		ATime: BtrfsTimespec{10, 11}, CTime: BtrfsTimespec{12, 13},
+		MTime: BtrfsTimespec{14, 15}, OTime: BtrfsTimespec{16, 17},
+	}, ii)
+
+	_, err = NewBtrfsInodeItem(data[:100])
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "btrfs_inode_item has 100 bytes, expected at least 160")
+}
+
+func TestNewBtrfsInodeRefs(t *testing.T) {
+	data := le(uint64(2), uint16(4), "file", uint64(3), uint16(4), "link")
+
+	refs, err := NewBtrfsInodeRefs(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []BtrfsInodeRef{{Index: 2, NameLen: 4, Name: "file"}, {Index: 3, NameLen: 4, Name: "link"}}, refs)
+
+	_, err = NewBtrfsInodeRefs(data[:12])
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "btrfs_inode_ref: Name: unexpected EOF")
+}
+
+func TestNewBtrfsInodeExtrefs(t *testing.T) {
+	data := le(uint64(256), uint64(5), uint16(3), "abc", uint64(257), uint64(6), uint16(1), "d")
+
+	refs, err := NewBtrfsInodeExtrefs(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []BtrfsInodeExtref{
+		{ParentObjectId: 256, Index: 5, NameLen: 3, Name: "abc"},
+		{ParentObjectId: 257, Index: 6, NameLen: 1, Name: "d"},
+	}, refs)
+
+	_, err = NewBtrfsInodeExtrefs(data[:10])
+	assert.Error(t, err)
+}
+
+func TestNewBtrfsDirItems(t *testing.T) {
+	data := le(
+		uint64(257), uint8(1), uint64(0), uint64(7), uint16(0), uint16(3), uint8(1), "dir",
+		uint64(0), uint8(0), uint64(0), uint64(8), uint16(4), uint16(10), uint8(8), "user.color", "blue")
+
+	items, err := NewBtrfsDirItems(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []BtrfsDirItem{
+		{Location: BtrfsDiskKey{ObjectId: 257, Type: 1}, TransId: 7, NameLen: 3, Type: 1, Name: "dir"},
+		{TransId: 8, DataLen: 4, NameLen: 10, Type: 8, Name: "user.color", Data: []byte("blue")},
+	}, items)
+
+	_, err = NewBtrfsDirItems(data[:len(data)-1])
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "btrfs_dir_item: Data: unexpected EOF")
+}
+
+func TestNewBtrfsExtentItem(t *testing.T) {
+	const (
+		extentItemKey   = 168
+		metadataItemKey = 169
+		flagData        = 1
+		flagTreeBlock   = 2
+		treeBlockRef    = 176
+		extentDataRef   = 178
+		sharedBlockRef  = 182
+		sharedDataRef   = 184
+	)
+
+	// data extent referenced by a file and a shared leaf
+	data := le(uint64(3), uint64(10), uint64(flagData),
+		uint8(extentDataRef), uint64(5), uint64(257), uint64(0), uint32(2),
+		uint8(sharedDataRef), uint64(30408704), uint32(1))
+
+	ei, err := NewBtrfsExtentItem(extentItemKey, data)
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsExtentItem{Refs: 3, Generation: 10, Flags: flagData, InlineRefs: []BtrfsExtentInlineRef{
+		{Type: extentDataRef, DataRef: BtrfsExtentDataRef{Root: 5, ObjectId: 257, Count: 2}},
+		{Type: sharedDataRef, Offset: 30408704, Count: 1},
+	}}, ei)
+
+	// tree block without the skinny metadata
+	data = le(uint64(1), uint64(11), uint64(flagTreeBlock),
+		uint64(256), uint8(1), uint64(0), uint8(1),
+		uint8(treeBlockRef), uint64(5))
+
+	ei, err = NewBtrfsExtentItem(extentItemKey, data)
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsExtentItem{Refs: 1, Generation: 11, Flags: flagTreeBlock,
+		TreeBlockKey: BtrfsDiskKey{ObjectId: 256, Type: 1}, TreeBlockLevel: 1,
+		InlineRefs: []BtrfsExtentInlineRef{{Type: treeBlockRef, Offset: 5}},
+	}, ei)
+
+	// the metadata item has no tree block info
+	data = le(uint64(1), uint64(12), uint64(flagTreeBlock), uint8(sharedBlockRef), uint64(22020096))
+
+	ei, err = NewBtrfsExtentItem(metadataItemKey, data)
+	assert.NoError(t, err)
+	assert.Equal(t, []BtrfsExtentInlineRef{{Type: sharedBlockRef, Offset: 22020096}}, ei.InlineRefs)
+
+	_, err = NewBtrfsExtentItem(metadataItemKey, data[:30])
+	assert.Error(t, err)
+
+	_, err = NewBtrfsExtentItem(metadataItemKey, le(uint64(1), uint64(12), uint64(flagTreeBlock), uint8(99)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown inline ref type 99")
+
+	dr, err := NewBtrfsExtentDataRef(le(uint64(5), uint64(258), uint64(4096), uint32(1)))
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsExtentDataRef{Root: 5, ObjectId: 258, Offset: 4096, Count: 1}, dr)
+}
+
+func TestNewBtrfsBlockGroupItem(t *testing.T) {
+	bg, err := NewBtrfsBlockGroupItem(le(uint64(1<<20), uint64(256), uint64(0x11)))
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsBlockGroupItem{Used: 1 << 20, ChunkObjectId: 256, Flags: 0x11}, bg)
+
+	_, err = NewBtrfsBlockGroupItem(make([]byte, 16))
+	assert.Error(t, err)
+}
+
+func TestNewBtrfsChunk(t *testing.T) {
+	data := le(uint64(1<<30), uint64(2), uint64(64*1024), uint64(0x14), uint32(4096), uint32(4096), uint32(4096),
+		uint16(2), uint16(1),
+		uint64(1), uint64(22020096), testUUID,
+		uint64(2), uint64(1048576), bytes.Repeat([]byte{0xcd}, 16))
+
+	chunk, err := NewBtrfsChunk(data)
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsChunk{
+		Length: 1 << 30, Owner: 2, StripeLen: 64 * 1024, Type: 0x14,
+		IOAlign: 4096, IOWidth: 4096, SectorSize: 4096, NumStripes: 2, SubStripes: 1,
+		Stripes: []BtrfsStripe{
+			{DevId: 1, Offset: 22020096, DevUUID: testUUID},
+			{DevId: 2, Offset: 1048576, DevUUID: uuid.UUID(bytes.Repeat([]byte{0xcd}, 16))},
+		},
+	}, chunk)
+
+	_, err = NewBtrfsChunk(data[:100])
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "btrfs_chunk: Stripes: DevUUID: unexpected EOF")
+}
+
+func TestNewBtrfsDevItem(t *testing.T) {
+	data := le(uint64(1), uint64(1<<30), uint64(1<<20), uint32(4096), uint32(4096), uint32(4096),
+		uint64(0), uint64(9), uint64(0), uint32(0), uint8(0), uint8(0), testUUID, make([]byte, 16))
+	assert.Len(t, data, 98)
+
+	di, err := NewBtrfsDevItem(data)
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsDevItem{DevId: 1, TotalBytes: 1 << 30, BytesUsed: 1 << 20,
+		IOAlign: 4096, IOWidth: 4096, SectorSize: 4096, Generation: 9,
+		UUID: testUUID, FSID: uuid.UUID(make([]byte, 16))}, di)
+
+	_, err = NewBtrfsDevItem(data[:97])
+	assert.Error(t, err)
+}
+
+func TestNewBtrfsDevExtent(t *testing.T) {
+	de, err := NewBtrfsDevExtent(le(uint64(3), uint64(256), uint64(22020096), uint64(1<<30), testUUID))
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsDevExtent{ChunkTree: 3, ChunkObjectId: 256, ChunkOffset: 22020096, Length: 1 << 30,
+		ChunkTreeUUID: testUUID}, de)
+}
+
+func TestQgroupItems(t *testing.T) {
+	qi := &BtrfsQgroupInfoItem{}
+	err := NewStruct(qi, bytes.NewReader(le(uint64(7), uint64(16384), uint64(16384), uint64(4096), uint64(4096))))
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsQgroupInfoItem{Generation: 7, Rfer: 16384, RferCmpr: 16384, Excl: 4096, ExclCmpr: 4096}, qi)
+
+	ql := &BtrfsQgroupLimitItem{}
+	err = NewStruct(ql, bytes.NewReader(le(uint64(3), uint64(1<<30), uint64(1<<29), uint64(0), uint64(0))))
+	assert.NoError(t, err)
+	assert.Equal(t, &BtrfsQgroupLimitItem{Flags: 3, MaxRfer: 1 << 30, MaxExcl: 1 << 29}, ql)
+}
+
+func TestNewBtrfsUUIDItem(t *testing.T) {
+	ids, err := NewBtrfsUUIDItem(le(uint64(256), uint64(300)))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{256, 300}, ids)
+
+	_, err = NewBtrfsUUIDItem(make([]byte, 12))
+	assert.Error(t, err)
+}
+
+type Tail struct {
+	S8      int8
+	S16     int16
+	S32     int32
+	S64     int64
+	Label   [4]byte
+	Words   [2]uint16
+	NameLen uint16
+	Count   uint8
+	Name    string         `len:"NameLen"`
+	Keys    []BtrfsDiskKey `len:"Count"`
+	skipped uint64
+	Ignored uint64 `btrfs:"-"`
+}
+
+func TestNewStructTail(t *testing.T) {
+	data := le(int8(-2), int16(-300), int32(-70000), int64(-5000000000), "abcd", uint16(1), uint16(2),
+		uint16(3), uint8(2), "dir", uint64(256), uint8(1), uint64(0), uint64(257), uint8(84), uint64(9))
+
+	tail := &Tail{}
+	err := NewStruct(tail, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, &Tail{
+		S8: -2, S16: -300, S32: -70000, S64: -5000000000,
+		Label: [4]byte{'a', 'b', 'c', 'd'}, Words: [2]uint16{1, 2},
+		NameLen: 3, Count: 2, Name: "dir",
+		Keys: []BtrfsDiskKey{{ObjectId: 256, Type: 1}, {ObjectId: 257, Type: 84, Offset: 9}},
+	}, tail)
+
+	err = NewStruct(&Tail{}, bytes.NewReader(data[:len(data)-1]))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Keys: Offset: unexpected EOF")
+
+	err = NewStruct(&Tail{}, bytes.NewReader(nil))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "S8: unexpected EOF")
+
+	// the seek tag requires an io.Seeker
+	err = NewStruct(&Foo{}, bufio.NewReader(bytes.NewReader(make([]byte, 1024))))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "io.Seeker interface is required")
+}
+
+func TestNewStructUnsupported(t *testing.T) {
+	var floats struct {
+		F float64
+	}
+	err := NewStruct(&floats, bytes.NewReader(make([]byte, 8)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "F: unsupported kind float64")
+
+	var slices struct {
+		S []uint32
+	}
+	err = NewStruct(&slices, bytes.NewReader(make([]byte, 8)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "S: unsupported kind slice")
+
+	var lens struct {
+		Name    string `len:"NameLen"`
+		NameLen uint8
+	}
+	err = NewStruct(&lens, bytes.NewReader(make([]byte, 8)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "length field NameLen must precede the field")
+
+	err = NewStruct(floats, bytes.NewReader(make([]byte, 8)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected a pointer to a struct")
+
+	_, err = Sizeof(floats)
+	assert.Error(t, err)
+	_, err = Marshal(&floats)
+	assert.Error(t, err)
+}
+
+func TestStructSizes(t *testing.T) {
+	for _, s := range structSizes {
+		size, err := Sizeof(s.v)
+		assert.NoError(t, err)
+		assert.Equal(t, s.size, size, "%T", s.v)
+	}
+
+	size, err := Sizeof(&Foo{})
+	assert.NoError(t, err)
+	assert.Equal(t, 512+8+1+16, size)
+}
+
+func TestMarshal(t *testing.T) {
+	tail := &Tail{
+		S8: -2, S16: -300, S32: -70000, S64: -5000000000,
+		Label: [4]byte{'a', 'b', 'c', 'd'}, Words: [2]uint16{1, 2},
+		Name:    "dir",
+		Keys:    []BtrfsDiskKey{{ObjectId: 256, Type: 1}, {ObjectId: 257, Type: 84, Offset: 9}},
+		Ignored: 7,
+	}
+	data, err := Marshal(tail)
+	assert.NoError(t, err)
+	assert.Equal(t, le(int8(-2), int16(-300), int32(-70000), int64(-5000000000), "abcd", uint16(1), uint16(2),
+		uint16(3), uint8(2), "dir", uint64(256), uint8(1), uint64(0), uint64(257), uint8(84), uint64(9)), data)
+
+	// the seek gaps are zero filled
+	foo := &Foo{F1: 1, F5: 5, F6: 6, F7: 7, UUID: testUUID}
+	data, err = Marshal(foo)
+	assert.NoError(t, err)
+	assert.Len(t, data, 512+8+1+16)
+	assert.Equal(t, make([]byte, 0x100-0x12), data[0x12:0x100])
+
+	decoded := &Foo{}
+	assert.NoError(t, NewStruct(decoded, bytes.NewReader(data)))
+	assert.Equal(t, foo, decoded)
+
+	ref := &BtrfsRootRef{DirId: 256, Sequence: 2, Name: "snap"}
+	data, err = Marshal(ref)
+	assert.NoError(t, err)
+	assert.Equal(t, le(uint64(256), uint64(2), uint16(4), "snap"), data)
+
+	decodedRef, err := NewBtrfsRootRef(data)
+	assert.NoError(t, err)
+	ref.NameLen = 4
+	assert.Equal(t, ref, decodedRef)
+
+	_, err = Marshal(&Tail{Keys: make([]BtrfsDiskKey, 256)})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Count: length 256 doesn't fit")
+
+	_, err = Marshal(&Foo{UUID: uuid.UUID{1, 2}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid uuid length 2")
+}
@@ -0,0 +1,213 @@
+package ioctl
+
+/*
+#include <string.h>
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+// qgroup limit flags, see struct btrfs_qgroup_limit.flags
+const (
+	QgroupLimitMaxRfer = uint64(C.BTRFS_QGROUP_LIMIT_MAX_RFER)
+	QgroupLimitMaxExcl = uint64(C.BTRFS_QGROUP_LIMIT_MAX_EXCL)
+)
+
+// QgroupLimitNone removes the limit when passed with its limit flag
+const QgroupLimitNone = uint64(math.MaxUint64)
+
+func qgroupCreate(path string, qgroupid uint64, create bool) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_qgroup_create_args
+	args.qgroupid = C.__u64(qgroupid)
+	if create {
+		args.create = 1
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_QGROUP_CREATE,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		op := "destroy"
+		if create {
+			op = "create"
+		}
+		return fmt.Errorf("Failed to %s qgroup %d/%d on '%s': %v", op,
+			qgroupid>>48, qgroupid&(1<<48-1), path, errno.Error())
+	}
+	return nil
+}
+
+// QgroupCreate creates the qgroup on the filesystem mounted at path
+func QgroupCreate(path string, qgroupid uint64) error {
+	return qgroupCreate(path, qgroupid, true)
+}
+
+// QgroupDestroy destroys the qgroup, it must not have any relations
+func QgroupDestroy(path string, qgroupid uint64) error {
+	return qgroupCreate(path, qgroupid, false)
+}
+
+// QgroupAssign adds or removes the relation between the src and dst qgroups. The returned
+// inconsistent flag is set when the kernel couldn't update the accounting and a rescan is needed.
+func QgroupAssign(path string, src, dst uint64, assign bool) (inconsistent bool, err error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return false, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_qgroup_assign_args
+	args.src = C.__u64(src)
+	args.dst = C.__u64(dst)
+	if assign {
+		args.assign = 1
+	}
+
+	ret, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_QGROUP_ASSIGN,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		op := "remove"
+		if assign {
+			op = "assign"
+		}
+		return false, fmt.Errorf("Failed to %s qgroup %d/%d to %d/%d on '%s': %v", op,
+			src>>48, src&(1<<48-1), dst>>48, dst&(1<<48-1), path, errno.Error())
+	}
+	return ret > 0, nil
+}
+
+// QgroupLimit sets the limits selected by flags, the qgroup of the subvolume at path is
+// used if qgroupid is 0. QgroupLimitNone removes the limit.
+func QgroupLimit(path string, qgroupid, flags, maxRfer, maxExcl uint64) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_qgroup_limit_args
+	args.qgroupid = C.__u64(qgroupid)
+	args.lim.flags = C.__u64(flags)
+	args.lim.max_rfer = C.__u64(maxRfer)
+	args.lim.max_excl = C.__u64(maxExcl)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_QGROUP_LIMIT,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to limit qgroup %d/%d on '%s': %v",
+			qgroupid>>48, qgroupid&(1<<48-1), path, errno.Error())
+	}
+	return nil
+}
+
+// Qgroup is a quota group read from the quota tree, Parents and Children hold the qgroup ids of the relations
+type Qgroup struct {
+	Id uint64
+
+	Generation uint64
+	Rfer       uint64
+	RferCmpr   uint64
+	Excl       uint64
+	ExclCmpr   uint64
+
+	LimitFlags uint64
+	MaxRfer    uint64
+	MaxExcl    uint64
+
+	Parents  []uint64
+	Children []uint64
+}
+
+// GetQgroups reads all qgroups from the quota tree of the filesystem mounted at path
+func GetQgroups(path string) ([]Qgroup, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	qgroups := map[uint64]*Qgroup{}
+	qgroup := func(id uint64) *Qgroup {
+		q, ok := qgroups[id]
+		if !ok {
+			q = &Qgroup{Id: id}
+			qgroups[id] = q
+		}
+		return q
+	}
+
+	it := newTreeSearch(getDirFd(dir), TreeSearch{
+		TreeID: C.BTRFS_QUOTA_TREE_OBJECTID,
+		Min:    Key{Type: C.BTRFS_QGROUP_INFO_KEY},
+		Max:    Key{ObjectID: math.MaxUint64, Type: C.BTRFS_QGROUP_RELATION_KEY, Offset: math.MaxUint64},
+	})
+
+	for it.Next() {
+		sh := it.Header()
+
+		switch sh.Key.Type {
+		case C.BTRFS_QGROUP_INFO_KEY:
+			item := (*C.struct_btrfs_qgroup_info_item)(it.raw())
+			info, err := NewBtrfsQgroupInfoItem(item)
+			if err != nil {
+				return nil, err
+			}
+
+			q := qgroup(sh.Key.Offset)
+			q.Generation = info.Generation
+			q.Rfer = info.Rfer
+			q.RferCmpr = info.RferCmpr
+			q.Excl = info.Excl
+			q.ExclCmpr = info.ExclCmpr
+
+		case C.BTRFS_QGROUP_LIMIT_KEY:
+			item := (*C.struct_btrfs_qgroup_limit_item)(it.raw())
+			limit, err := NewBtrfsQgroupLimitItem(item)
+			if err != nil {
+				return nil, err
+			}
+
+			q := qgroup(sh.Key.Offset)
+			q.LimitFlags = limit.Flags
+			q.MaxRfer = limit.MaxRfer
+			q.MaxExcl = limit.MaxExcl
+
+		case C.BTRFS_QGROUP_RELATION_KEY:
+			// every relation is stored twice, (child, parent) and (parent, child)
+			src, dst := sh.Key.ObjectID, sh.Key.Offset
+			if src>>48 < dst>>48 {
+				qgroup(src).Parents = append(qgroup(src).Parents, dst)
+				qgroup(dst).Children = append(qgroup(dst).Children, src)
+			}
+		}
+	}
+	if err, ok := it.Err().(*SearchError); ok && err.Errno == syscall.ENOENT {
+		return nil, fmt.Errorf("Quota is not enabled on '%s'", path)
+	} else if it.Err() != nil {
+		return nil, it.Err()
+	}
+
+	var result []Qgroup
+	for _, q := range qgroups {
+		result = append(result, *q)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+
+	return result, nil
+}
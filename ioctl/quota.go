@@ -0,0 +1,125 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+
+#ifndef BTRFS_QUOTA_CTL_ENABLE_SIMPLE_QUOTA
+#define BTRFS_QUOTA_CTL_ENABLE_SIMPLE_QUOTA 4
+#endif
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+type QuotaRescanStatus struct {
+	Running bool
+	// Progress is the objectid the rescan has reached
+	Progress uint64
+}
+
+func quotaCtl(path string, cmd C.__u64) (syscall.Errno, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_quota_ctl_args
+	args.cmd = cmd
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_QUOTA_CTL,
+		uintptr(unsafe.Pointer(&args)))
+	return errno, nil
+}
+
+// QuotaEnable enables the quota groups on the filesystem mounted at path, simple
+// quotas account the extents to the subvolume which created them (kernel 6.7+)
+func QuotaEnable(path string, simple bool) error {
+	var cmd C.__u64 = C.BTRFS_QUOTA_CTL_ENABLE
+	if simple {
+		cmd = C.BTRFS_QUOTA_CTL_ENABLE_SIMPLE_QUOTA
+	}
+
+	errno, err := quotaCtl(path, cmd)
+	if err != nil {
+		return err
+	}
+	if errno == syscall.EINVAL && simple {
+		return fmt.Errorf("Failed to enable simple quota on '%s': not supported by the kernel", path)
+	} else if errno != 0 {
+		return fmt.Errorf("Failed to enable quota on '%s': %v", path, errno.Error())
+	}
+	return nil
+}
+
+// QuotaDisable disables the quota groups and removes the quota tree
+func QuotaDisable(path string) error {
+	errno, err := quotaCtl(path, C.BTRFS_QUOTA_CTL_DISABLE)
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return fmt.Errorf("Failed to disable quota on '%s': %v", path, errno.Error())
+	}
+	return nil
+}
+
+// QuotaRescan starts the rescan of the quota groups, the kernel runs it in background
+func QuotaRescan(path string) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_quota_rescan_args
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_QUOTA_RESCAN,
+		uintptr(unsafe.Pointer(&args)))
+	if errno == syscall.EINPROGRESS {
+		return fmt.Errorf("Quota rescan is already running on '%s'", path)
+	} else if errno != 0 {
+		return fmt.Errorf("Failed to start quota rescan on '%s': %v", path, errno.Error())
+	}
+	return nil
+}
+
+// GetQuotaRescanStatus returns whether a quota rescan is running and how far it got
+func GetQuotaRescanStatus(path string) (*QuotaRescanStatus, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_quota_rescan_args
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_QUOTA_RESCAN_STATUS,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return nil, fmt.Errorf("Failed to get quota rescan status of '%s': %v", path, errno.Error())
+	}
+
+	return &QuotaRescanStatus{
+		Running:  args.flags != 0,
+		Progress: uint64(args.progress),
+	}, nil
+}
+
+// QuotaRescanWait blocks until the running quota rescan is finished
+func QuotaRescanWait(path string) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_QUOTA_RESCAN_WAIT, 0)
+	if errno != 0 {
+		return fmt.Errorf("Failed to wait for quota rescan on '%s': %v", path, errno.Error())
+	}
+	return nil
+}
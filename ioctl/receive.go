@@ -0,0 +1,140 @@
+package ioctl
+
+/*
+#include <string.h>
+#include <sys/uio.h>
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// UUID tree key types
+const (
+	UUIDKeySubvol         = uint8(C.BTRFS_UUID_KEY_SUBVOL)
+	UUIDKeyReceivedSubvol = uint8(C.BTRFS_UUID_KEY_RECEIVED_SUBVOL)
+)
+
+// encoded write compression types, see BTRFS_ENCODED_IO_COMPRESSION_*
+const (
+	EncodedCompressionNone = uint32(C.BTRFS_ENCODED_IO_COMPRESSION_NONE)
+	EncodedCompressionZlib = uint32(C.BTRFS_ENCODED_IO_COMPRESSION_ZLIB)
+	EncodedCompressionZstd = uint32(C.BTRFS_ENCODED_IO_COMPRESSION_ZSTD)
+)
+
+// UUIDTreeLookup returns the ids of the subvolumes having the uuid, the key type selects
+// between the subvolume uuid and the received uuid.
+func UUIDTreeLookup(path string, uuid []byte, keyType uint8) ([]uint64, error) {
+	if len(uuid) != C.BTRFS_UUID_SIZE {
+		return nil, fmt.Errorf("invalid uuid length %d", len(uuid))
+	}
+
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	// the key is (upper 64 bits of the uuid, key type, lower 64 bits of the uuid)
+	key := Key{
+		ObjectID: binary.LittleEndian.Uint64(uuid[0:8]),
+		Type:     keyType,
+		Offset:   binary.LittleEndian.Uint64(uuid[8:16]),
+	}
+	it := newTreeSearch(getDirFd(dir), TreeSearch{TreeID: C.BTRFS_UUID_TREE_OBJECTID, Min: key, Max: key})
+	if !it.Next() {
+		// ENOENT if the filesystem has no uuid tree
+		if err, ok := it.Err().(*SearchError); it.Err() == nil || ok && err.Errno == syscall.ENOENT {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to search the uuid tree of '%s': %v", path, it.Err())
+	}
+	return NewBtrfsUUIDItem(it.Item())
+}
+
+// CloneRange clones length bytes at srcOffset of the file srcFd to destOffset of the file destFd,
+// length 0 clones to the end of the source file.
+func CloneRange(srcFd uintptr, srcOffset, length uint64, destFd uintptr, destOffset uint64) error {
+	var args C.struct_btrfs_ioctl_clone_range_args
+	args.src_fd = C.__s64(srcFd)
+	args.src_offset = C.__u64(srcOffset)
+	args.src_length = C.__u64(length)
+	args.dest_offset = C.__u64(destOffset)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, destFd, C.BTRFS_IOC_CLONE_RANGE, uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to clone range: %v", errno.Error())
+	}
+	return nil
+}
+
+// SetReceivedSubvol records the uuid and the transaction id of the sent subvolume on the subvolume at path
+func SetReceivedSubvol(path string, uuid []byte, stransid uint64) error {
+	if len(uuid) != C.BTRFS_UUID_SIZE {
+		return fmt.Errorf("invalid uuid length %d", len(uuid))
+	}
+
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_received_subvol_args
+	for i, b := range uuid {
+		args.uuid[i] = C.char(b)
+	}
+	args.stransid = C.__u64(stransid)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SET_RECEIVED_SUBVOL,
+		uintptr(unsafe.Pointer(&args)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to set received subvolume '%s': %v", path, errno.Error())
+	}
+	return nil
+}
+
+// ErrEncodedWriteUnsupported is returned by EncodedWrite if the kernel or the caller can't write encoded data
+var ErrEncodedWriteUnsupported = errors.New("encoded write is not supported")
+
+// EncodedWrite writes the compressed data to the file fd at offset without decompressing it,
+// the arguments follow the encoded_write command of the send stream.
+func EncodedWrite(fd uintptr, data []byte, offset, unencodedFileLen, unencodedLen, unencodedOffset uint64,
+	compression, encryption uint32) error {
+	if len(data) == 0 {
+		return errors.New("encoded data is empty")
+	}
+
+	var iov C.struct_iovec
+	iov.iov_base = unsafe.Pointer(&data[0])
+	iov.iov_len = C.size_t(len(data))
+
+	var args C.struct_btrfs_ioctl_encoded_io_args
+	args.iov = &iov
+	args.iovcnt = 1
+	args.offset = C.__s64(offset)
+	args.len = C.__u64(unencodedFileLen)
+	args.unencoded_len = C.__u64(unencodedLen)
+	args.unencoded_offset = C.__u64(unencodedOffset)
+	args.compression = C.__u32(compression)
+	args.encryption = C.__u32(encryption)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, C.BTRFS_IOC_ENCODED_WRITE, uintptr(unsafe.Pointer(&args)))
+	runtime.KeepAlive(data)
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOTTY, syscall.EPERM, syscall.EINVAL:
+		// old kernels, missing CAP_SYS_ADMIN or an encoding the kernel can't store
+		return ErrEncodedWriteUnsupported
+	}
+	return fmt.Errorf("Failed to write encoded data: %v", errno.Error())
+}
@@ -0,0 +1,133 @@
+package ioctl
+
+/*
+#include <string.h>
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+
+// start and status share the same union in struct btrfs_ioctl_dev_replace_args
+static struct btrfs_ioctl_dev_replace_start_params *dev_replace_start(struct btrfs_ioctl_dev_replace_args *args) {
+	return &args->start;
+}
+
+static struct btrfs_ioctl_dev_replace_status_params *dev_replace_status(struct btrfs_ioctl_dev_replace_args *args) {
+	return &args->status;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	DevReplaceStateNeverStarted = uint64(C.BTRFS_IOCTL_DEV_REPLACE_STATE_NEVER_STARTED)
+	DevReplaceStateStarted      = uint64(C.BTRFS_IOCTL_DEV_REPLACE_STATE_STARTED)
+	DevReplaceStateFinished     = uint64(C.BTRFS_IOCTL_DEV_REPLACE_STATE_FINISHED)
+	DevReplaceStateCanceled     = uint64(C.BTRFS_IOCTL_DEV_REPLACE_STATE_CANCELED)
+	DevReplaceStateSuspended    = uint64(C.BTRFS_IOCTL_DEV_REPLACE_STATE_SUSPENDED)
+)
+
+type DevReplaceStatus struct {
+	State                      uint64
+	Progress1000               uint64
+	TimeStarted                uint64
+	TimeStopped                uint64
+	NumWriteErrors             uint64
+	NumUncorrectableReadErrors uint64
+}
+
+func devReplaceResult(result C.__u64) error {
+	switch result {
+	case C.BTRFS_IOCTL_DEV_REPLACE_RESULT_NO_ERROR:
+		return nil
+	case C.BTRFS_IOCTL_DEV_REPLACE_RESULT_NOT_STARTED:
+		return errors.New("replace not started")
+	case C.BTRFS_IOCTL_DEV_REPLACE_RESULT_ALREADY_STARTED:
+		return errors.New("replace already started")
+	case C.BTRFS_IOCTL_DEV_REPLACE_RESULT_SCRUB_INPROGRESS:
+		return errors.New("scrub is in progress")
+	default:
+		return fmt.Errorf("unknown replace result %d", uint64(result))
+	}
+}
+
+func devReplace(path string, args *C.struct_btrfs_ioctl_dev_replace_args) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_DEV_REPLACE,
+		uintptr(unsafe.Pointer(args)))
+	if errno != 0 {
+		return errno
+	}
+	return devReplaceResult(args.result)
+}
+
+// DevReplaceStart replaces the source device, given by srcDevid or by srcDev if srcDevid is 0,
+// with the target device. The call blocks until the replace is finished or canceled.
+// The source device is read only if there is no other mirror when avoidSrc is set.
+func DevReplaceStart(path string, srcDevid uint64, srcDev, tgtDev string, avoidSrc bool) error {
+	var args C.struct_btrfs_ioctl_dev_replace_args
+	args.cmd = C.BTRFS_IOCTL_DEV_REPLACE_CMD_START
+
+	start := C.dev_replace_start(&args)
+	if len(srcDev) > C.BTRFS_DEVICE_PATH_NAME_MAX || len(tgtDev) > C.BTRFS_DEVICE_PATH_NAME_MAX {
+		return errors.New("device name is too long")
+	}
+
+	start.srcdevid = C.__u64(srcDevid)
+	for i, c := range []byte(srcDev) {
+		start.srcdev_name[i] = C.__u8(c)
+	}
+	for i, c := range []byte(tgtDev) {
+		start.tgtdev_name[i] = C.__u8(c)
+	}
+
+	start.cont_reading_from_srcdev_mode = C.BTRFS_IOCTL_DEV_REPLACE_CONT_READING_FROM_SRCDEV_MODE_ALWAYS
+	if avoidSrc {
+		start.cont_reading_from_srcdev_mode = C.BTRFS_IOCTL_DEV_REPLACE_CONT_READING_FROM_SRCDEV_MODE_AVOID
+	}
+
+	if err := devReplace(path, &args); err != nil {
+		return fmt.Errorf("Failed to start replace on '%s': %v", path, err)
+	}
+	return nil
+}
+
+// GetDevReplaceStatus returns the state of the last replace operation
+func GetDevReplaceStatus(path string) (*DevReplaceStatus, error) {
+	var args C.struct_btrfs_ioctl_dev_replace_args
+	args.cmd = C.BTRFS_IOCTL_DEV_REPLACE_CMD_STATUS
+
+	if err := devReplace(path, &args); err != nil {
+		return nil, fmt.Errorf("Failed to get replace status of '%s': %v", path, err)
+	}
+
+	status := C.dev_replace_status(&args)
+	return &DevReplaceStatus{
+		State:                      uint64(status.replace_state),
+		Progress1000:               uint64(status.progress_1000),
+		TimeStarted:                uint64(status.time_started),
+		TimeStopped:                uint64(status.time_stopped),
+		NumWriteErrors:             uint64(status.num_write_errors),
+		NumUncorrectableReadErrors: uint64(status.num_uncorrectable_read_errors),
+	}, nil
+}
+
+// DevReplaceCancel cancels the running replace operation
+func DevReplaceCancel(path string) error {
+	var args C.struct_btrfs_ioctl_dev_replace_args
+	args.cmd = C.BTRFS_IOCTL_DEV_REPLACE_CMD_CANCEL
+
+	if err := devReplace(path, &args); err != nil {
+		return fmt.Errorf("Failed to cancel replace on '%s': %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"syscall"
+	"unsafe"
+)
+
+// ScrubProgress mirrors struct btrfs_scrub_progress
+type ScrubProgress struct {
+	DataExtentsScrubbed uint64
+	TreeExtentsScrubbed uint64
+	DataBytesScrubbed   uint64
+	TreeBytesScrubbed   uint64
+	ReadErrors          uint64
+	CsumErrors          uint64
+	VerifyErrors        uint64
+	NoCsum              uint64
+	CsumDiscards        uint64
+	SuperErrors         uint64
+	MallocErrors        uint64
+	UncorrectableErrors uint64
+	CorrectedErrors     uint64
+	LastPhysical        uint64
+	UnverifiedErrors    uint64
+}
+
+func newScrubProgress(p *C.struct_btrfs_scrub_progress) *ScrubProgress {
+	return &ScrubProgress{
+		DataExtentsScrubbed: uint64(p.data_extents_scrubbed),
+		TreeExtentsScrubbed: uint64(p.tree_extents_scrubbed),
+		DataBytesScrubbed:   uint64(p.data_bytes_scrubbed),
+		TreeBytesScrubbed:   uint64(p.tree_bytes_scrubbed),
+		ReadErrors:          uint64(p.read_errors),
+		CsumErrors:          uint64(p.csum_errors),
+		VerifyErrors:        uint64(p.verify_errors),
+		NoCsum:              uint64(p.no_csum),
+		CsumDiscards:        uint64(p.csum_discards),
+		SuperErrors:         uint64(p.super_errors),
+		MallocErrors:        uint64(p.malloc_errors),
+		UncorrectableErrors: uint64(p.uncorrectable_errors),
+		CorrectedErrors:     uint64(p.corrected_errors),
+		LastPhysical:        uint64(p.last_physical),
+		UnverifiedErrors:    uint64(p.unverified_errors),
+	}
+}
+
+// Scrub scrubs the whole device devid of the filesystem mounted at path, nothing is
+// repaired if readOnly is set. The call blocks until the scrub is finished or canceled,
+// the progress of a canceled scrub is returned together with the error.
+func Scrub(path string, devid uint64, readOnly bool) (*ScrubProgress, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_scrub_args
+	args.devid = C.__u64(devid)
+	args.start = 0
+	args.end = C.__u64(math.MaxUint64)
+	if readOnly {
+		args.flags = C.BTRFS_SCRUB_READONLY
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SCRUB,
+		uintptr(unsafe.Pointer(&args)))
+	if errno == syscall.ECANCELED {
+		return newScrubProgress(&args.progress), fmt.Errorf("Scrub of device %d was canceled", devid)
+	} else if errno == syscall.EINPROGRESS {
+		return nil, fmt.Errorf("Failed to scrub device %d: scrub is already running", devid)
+	} else if errno != 0 {
+		return nil, fmt.Errorf("Failed to scrub device %d of '%s': %v", devid, path, errno.Error())
+	}
+	return newScrubProgress(&args.progress), nil
+}
+
+// ScrubCancel cancels the scrub of all devices of the filesystem mounted at path
+func ScrubCancel(path string) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SCRUB_CANCEL, 0)
+	if errno == syscall.ENOTCONN {
+		return fmt.Errorf("No scrub is running on '%s'", path)
+	} else if errno != 0 {
+		return fmt.Errorf("Failed to cancel scrub of '%s': %v", path, errno.Error())
+	}
+	return nil
+}
+
+// GetScrubProgress returns the progress of the scrub running on the device devid,
+// the progress is nil if the device is not being scrubbed
+func GetScrubProgress(path string, devid uint64) (*ScrubProgress, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_scrub_args
+	args.devid = C.__u64(devid)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SCRUB_PROGRESS,
+		uintptr(unsafe.Pointer(&args)))
+	if errno == syscall.ENOTCONN {
+		return nil, nil
+	} else if errno != 0 {
+		return nil, fmt.Errorf("Failed to get scrub progress of device %d of '%s': %v", devid, path, errno.Error())
+	}
+	return newScrubProgress(&args.progress), nil
+}
@@ -0,0 +1,273 @@
+package ioctl
+
+/*
+#include <string.h>
+#include <dirent.h>
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"syscall"
+	"unsafe"
+)
+
+// the search buffer starts with 64KiB and grows for large items up to the kernel limit of 16MiB,
+// the tests start with a smaller buffer
+var treeSearchBufSize uint64 = 64 * 1024
+
+const treeSearchMaxBufSize = 16 * 1024 * 1024
+
+// Key is the key of a btrfs tree item, the items are sorted by objectid, type and offset
+type Key struct {
+	ObjectID uint64
+	Type     uint8
+	Offset   uint64
+}
+
+// MaxKey is the largest possible key
+var MaxKey = Key{ObjectID: math.MaxUint64, Type: math.MaxUint8, Offset: math.MaxUint64}
+
+// Compare returns -1, 0 or 1 if k is less than, equal to or greater than o
+func (k Key) Compare(o Key) int {
+	switch {
+	case k.ObjectID != o.ObjectID:
+		return compareU64(k.ObjectID, o.ObjectID)
+	case k.Type != o.Type:
+		return compareU64(uint64(k.Type), uint64(o.Type))
+	}
+	return compareU64(k.Offset, o.Offset)
+}
+
+// next returns the smallest key greater than k, false if k is the largest key
+func (k Key) next() (Key, bool) {
+	switch {
+	case k.Offset < math.MaxUint64:
+		return Key{ObjectID: k.ObjectID, Type: k.Type, Offset: k.Offset + 1}, true
+	case k.Type < math.MaxUint8:
+		return Key{ObjectID: k.ObjectID, Type: k.Type + 1}, true
+	case k.ObjectID < math.MaxUint64:
+		return Key{ObjectID: k.ObjectID + 1}, true
+	}
+	return k, false
+}
+
+func compareU64(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// SearchHeader describes an item found by the tree search
+type SearchHeader struct {
+	Key Key
+	// TransID is the generation of the leaf containing the item
+	TransID uint64
+	// Len is the size of the item
+	Len uint32
+}
+
+// TreeSearch selects the items of a tree with a key between Min and Max inclusive, in key order,
+// which are stored in leaves written between MinTransID and MaxTransID
+type TreeSearch struct {
+	// TreeID is the tree to search, 0 is the tree of the subvolume containing the path
+	TreeID uint64
+	Min    Key
+	Max    Key
+	// MaxTransID 0 means no limit
+	MinTransID uint64
+	MaxTransID uint64
+}
+
+// SearchError is returned if BTRFS_IOC_TREE_SEARCH_V2 fails
+type SearchError struct {
+	TreeID uint64
+	Errno  syscall.Errno
+}
+
+func (e *SearchError) Error() string {
+	return fmt.Sprintf("Failed to search the tree %d: %v", e.TreeID, e.Errno.Error())
+}
+
+// TreeSearchIterator walks through the items selected by a TreeSearch:
+//
+//	for it.Next() {
+//		header, item := it.Header(), it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type TreeSearchIterator struct {
+	fd     uintptr
+	dir    *C.DIR
+	search TreeSearch
+
+	// buf holds struct btrfs_ioctl_search_args_v2 followed by the found items
+	buf []uint64
+	// count is the number of found items, pos the index and off the buffer offset of the next one
+	count uint32
+	pos   uint32
+	off   uintptr
+
+	header SearchHeader
+	item   unsafe.Pointer
+	done   bool
+	err    error
+}
+
+// NewTreeSearch starts a search on the filesystem containing path, Close releases the path
+func NewTreeSearch(path string, search TreeSearch) (*TreeSearchIterator, error) {
+	dir, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	it := newTreeSearch(getDirFd(dir), search)
+	it.dir = dir
+	return it, nil
+}
+
+func newTreeSearch(fd uintptr, search TreeSearch) *TreeSearchIterator {
+	if search.MaxTransID == 0 {
+		search.MaxTransID = math.MaxUint64
+	}
+	return &TreeSearchIterator{
+		fd:     fd,
+		search: search,
+		done:   search.Min.Compare(search.Max) > 0,
+	}
+}
+
+// Close releases the path opened by NewTreeSearch
+func (it *TreeSearchIterator) Close() {
+	if it.dir != nil {
+		closeDir(it.dir)
+		it.dir = nil
+	}
+}
+
+// Next advances to the next item, it returns false at the end of the search or on error
+func (it *TreeSearchIterator) Next() bool {
+	for it.pos == it.count {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.err = it.fetch()
+	}
+
+	var sh C.struct_btrfs_ioctl_search_header
+	C.memcpy(unsafe.Pointer(&sh), it.items(it.off), C.sizeof_struct_btrfs_ioctl_search_header)
+	it.off += C.sizeof_struct_btrfs_ioctl_search_header
+
+	it.header = SearchHeader{
+		Key:     Key{ObjectID: uint64(sh.objectid), Type: uint8(sh._type), Offset: uint64(sh.offset)},
+		TransID: uint64(sh.transid),
+		Len:     uint32(sh.len),
+	}
+	it.item = it.items(it.off)
+	it.off += uintptr(sh.len)
+	it.pos++
+
+	// the next search continues after the last item of the buffer
+	if it.pos == it.count {
+		next, ok := it.header.Key.next()
+		if !ok || next.Compare(it.search.Max) > 0 {
+			it.done = true
+		}
+		it.search.Min = next
+	}
+	return true
+}
+
+// Header returns the header of the current item
+func (it *TreeSearchIterator) Header() SearchHeader {
+	return it.header
+}
+
+// Item returns a copy of the current item
+func (it *TreeSearchIterator) Item() []byte {
+	return C.GoBytes(it.item, C.int(it.header.Len))
+}
+
+// raw returns the current item in the search buffer, it is valid until the next call of Next
+func (it *TreeSearchIterator) raw() unsafe.Pointer {
+	return it.item
+}
+
+// Err returns the error which stopped the search
+func (it *TreeSearchIterator) Err() error {
+	return it.err
+}
+
+func (it *TreeSearchIterator) args() *C.struct_btrfs_ioctl_search_args_v2 {
+	return (*C.struct_btrfs_ioctl_search_args_v2)(unsafe.Pointer(&it.buf[0]))
+}
+
+// items returns the found items at the buffer offset, cgo doesn't map the flexible array buf
+func (it *TreeSearchIterator) items(off uintptr) unsafe.Pointer {
+	return addptr(unsafe.Pointer(&it.buf[0]), C.sizeof_struct_btrfs_ioctl_search_args_v2+off)
+}
+
+// alloc replaces the search buffer by one with size bytes for the items
+func (it *TreeSearchIterator) alloc(size uint64) {
+	it.buf = make([]uint64, (C.sizeof_struct_btrfs_ioctl_search_args_v2+size+7)/8)
+}
+
+func (it *TreeSearchIterator) bufSize() uint64 {
+	return uint64(len(it.buf)*8 - C.sizeof_struct_btrfs_ioctl_search_args_v2)
+}
+
+// fetch fills the buffer with the items following search.Min
+func (it *TreeSearchIterator) fetch() error {
+	if it.buf == nil {
+		it.alloc(treeSearchBufSize)
+	}
+
+	for {
+		args := it.args()
+		sk := &args.key
+		sk.tree_id = C.__u64(it.search.TreeID)
+		sk.min_objectid = C.__u64(it.search.Min.ObjectID)
+		sk.min_type = C.__u32(it.search.Min.Type)
+		sk.min_offset = C.__u64(it.search.Min.Offset)
+		sk.max_objectid = C.__u64(it.search.Max.ObjectID)
+		sk.max_type = C.__u32(it.search.Max.Type)
+		sk.max_offset = C.__u64(it.search.Max.Offset)
+		sk.min_transid = C.__u64(it.search.MinTransID)
+		sk.max_transid = C.__u64(it.search.MaxTransID)
+		sk.nr_items = math.MaxUint32
+		args.buf_size = C.__u64(it.bufSize())
+
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, it.fd, C.BTRFS_IOC_TREE_SEARCH_V2, uintptr(unsafe.Pointer(args)))
+		if errno == syscall.EOVERFLOW && it.bufSize() < treeSearchMaxBufSize {
+			// the next item doesn't fit, buf_size is the size it needs
+			size := uint64(args.buf_size)
+			if size <= it.bufSize() {
+				size = it.bufSize() * 2
+			}
+			if size > treeSearchMaxBufSize {
+				size = treeSearchMaxBufSize
+			}
+			it.alloc(size)
+			continue
+		}
+		if errno != 0 {
+			it.done = true
+			return &SearchError{TreeID: it.search.TreeID, Errno: errno}
+		}
+
+		it.count = uint32(sk.nr_items)
+		it.pos = 0
+		it.off = 0
+		if it.count == 0 {
+			it.done = true
+		}
+		return nil
+	}
+}
@@ -0,0 +1,34 @@
+package ioctl
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyCompare(t *testing.T) {
+	k := Key{ObjectID: 256, Type: 132, Offset: 10}
+	assert.Equal(t, 0, k.Compare(k))
+	assert.Equal(t, -1, k.Compare(Key{ObjectID: 257}))
+	assert.Equal(t, 1, k.Compare(Key{ObjectID: 256, Type: 84, Offset: math.MaxUint64}))
+	assert.Equal(t, -1, k.Compare(Key{ObjectID: 256, Type: 132, Offset: 11}))
+	assert.Equal(t, 1, MaxKey.Compare(k))
+}
+
+func TestKeyNext(t *testing.T) {
+	next, ok := Key{ObjectID: 256, Type: 132, Offset: 10}.next()
+	assert.True(t, ok)
+	assert.Equal(t, Key{ObjectID: 256, Type: 132, Offset: 11}, next)
+
+	next, ok = Key{ObjectID: 256, Type: 132, Offset: math.MaxUint64}.next()
+	assert.True(t, ok)
+	assert.Equal(t, Key{ObjectID: 256, Type: 133}, next)
+
+	next, ok = Key{ObjectID: 256, Type: math.MaxUint8, Offset: math.MaxUint64}.next()
+	assert.True(t, ok)
+	assert.Equal(t, Key{ObjectID: 257}, next)
+
+	_, ok = MaxKey.next()
+	assert.False(t, ok)
+}
@@ -0,0 +1,57 @@
+package ioctl
+
+/*
+#include <btrfs/ctree.h>
+#include <btrfs/ioctl.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// send flags, see struct btrfs_ioctl_send_args.flags
+const (
+	SendFlagNoFileData       = uint64(C.BTRFS_SEND_FLAG_NO_FILE_DATA)
+	SendFlagOmitStreamHeader = uint64(C.BTRFS_SEND_FLAG_OMIT_STREAM_HEADER)
+	SendFlagOmitEndCmd       = uint64(C.BTRFS_SEND_FLAG_OMIT_END_CMD)
+	SendFlagVersion          = uint64(C.BTRFS_SEND_FLAG_VERSION)
+	SendFlagCompressed       = uint64(C.BTRFS_SEND_FLAG_COMPRESSED)
+)
+
+// Send writes the send stream of the read only subvolume at path into the file descriptor fd.
+// The stream is incremental if parentRoot is not 0, the extents of the parent and of cloneRoots
+// are cloned instead of sent. The version is used with the SendFlagVersion flag.
+func Send(path string, fd uintptr, parentRoot uint64, cloneRoots []uint64, flags uint64, version uint32) error {
+	dir, err := openDir(path)
+	if err != nil {
+		return err
+	}
+	defer closeDir(dir)
+
+	var args C.struct_btrfs_ioctl_send_args
+	args.send_fd = C.__s64(fd)
+	args.parent_root = C.__u64(parentRoot)
+	args.flags = C.__u64(flags)
+	args.version = C.__u32(version)
+
+	roots := make([]C.__u64, len(cloneRoots))
+	for i, root := range cloneRoots {
+		roots[i] = C.__u64(root)
+	}
+	if len(roots) > 0 {
+		args.clone_sources_count = C.__u64(len(roots))
+		args.clone_sources = &roots[0]
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, getDirFd(dir), C.BTRFS_IOC_SEND,
+		uintptr(unsafe.Pointer(&args)))
+	runtime.KeepAlive(roots)
+	if errno != 0 {
+		return fmt.Errorf("Failed to send '%s': %v", path, errno.Error())
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+// Package mount mounts btrfs filesystems and subvolumes with mount(2) and unmounts them.
+//
+// The options are typed, Mount turns them into the mount flags and the btrfs option string:
+//
+//	err := mount.Mount("/dev/sdb", "/mnt/data", mount.Options{Subvol: "data", Compress: "zstd", NoAtime: true})
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/plar/btrfs/internal/blkdev"
+	"github.com/plar/btrfs/internal/mountinfo"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+// SpaceCache selects the free space cache
+type SpaceCache string
+
+const (
+	SpaceCacheV1 SpaceCache = "v1"
+	SpaceCacheV2 SpaceCache = "v2"
+	// NoSpaceCache disables the free space cache
+	NoSpaceCache SpaceCache = "none"
+)
+
+// Discard selects how freed extents are discarded
+type Discard string
+
+const (
+	DiscardSync  Discard = "sync"
+	DiscardAsync Discard = "async"
+)
+
+// Options are the mount options, the zero value mounts the default subvolume read write
+type Options struct {
+	// Subvol is the path of the subvolume relative to the top level subvolume
+	Subvol string
+	// SubvolID is the id of the subvolume, 5 is the top level subvolume
+	SubvolID uint64
+
+	// Compress is zlib, lzo, zstd or no, CompressLevel 0 is the default level of the algorithm,
+	// zlib has the levels 1-9 and zstd 1-15
+	Compress      string
+	CompressLevel int
+
+	NoAtime    bool
+	SpaceCache SpaceCache
+	SSD        bool
+	Discard    Discard
+	// Degraded allows to mount with missing devices
+	Degraded bool
+	ReadOnly bool
+}
+
+func (o Options) validate() error {
+	if len(o.Subvol) > 0 && o.SubvolID != 0 {
+		return errors.New("subvol and subvolid are exclusive")
+	}
+
+	if o.CompressLevel < 0 {
+		return fmt.Errorf("invalid compression level %d for '%s'", o.CompressLevel, o.Compress)
+	}
+	if o.CompressLevel > 0 && len(o.Compress) == 0 {
+		return errors.New("compression level without algorithm")
+	}
+	if len(o.Compress) > 0 {
+		if err := validators.ValidCompression(o.compress()); err != nil {
+			return err
+		}
+	}
+
+	switch o.SpaceCache {
+	case "", SpaceCacheV1, SpaceCacheV2, NoSpaceCache:
+	default:
+		return fmt.Errorf("invalid space cache '%s', expected v1, v2 or none", o.SpaceCache)
+	}
+
+	switch o.Discard {
+	case "", DiscardSync, DiscardAsync:
+	default:
+		return fmt.Errorf("invalid discard '%s', expected sync or async", o.Discard)
+	}
+	return nil
+}
+
+// flags returns the generic mount flags
+func (o Options) flags() uintptr {
+	var flags uintptr
+	if o.ReadOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	if o.NoAtime {
+		flags |= syscall.MS_NOATIME
+	}
+	return flags
+}
+
+// compress returns the compression with the level
+func (o Options) compress() string {
+	if o.CompressLevel > 0 {
+		return fmt.Sprintf("%s:%d", o.Compress, o.CompressLevel)
+	}
+	return o.Compress
+}
+
+// data returns the btrfs options
+func (o Options) data() string {
+	var opts []string
+	if len(o.Subvol) > 0 {
+		opts = append(opts, "subvol="+o.Subvol)
+	}
+	if o.SubvolID != 0 {
+		opts = append(opts, fmt.Sprintf("subvolid=%d", o.SubvolID))
+	}
+
+	if len(o.Compress) > 0 {
+		opts = append(opts, "compress="+o.compress())
+	}
+
+	switch o.SpaceCache {
+	case NoSpaceCache:
+		opts = append(opts, "nospace_cache")
+	case SpaceCacheV1, SpaceCacheV2:
+		opts = append(opts, "space_cache="+string(o.SpaceCache))
+	}
+
+	if o.SSD {
+		opts = append(opts, "ssd")
+	}
+	if len(o.Discard) > 0 {
+		opts = append(opts, "discard="+string(o.Discard))
+	}
+	if o.Degraded {
+		opts = append(opts, "degraded")
+	}
+	return strings.Join(opts, ",")
+}
+
+func isDir(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", path)
+	}
+	return nil
+}
+
+// Mount mounts the btrfs filesystem on the block device at target, a subvolume if the options select one
+func Mount(device, target string, opts Options) error {
+	if len(device) == 0 {
+		return errors.New("device is empty")
+	}
+	if len(target) == 0 {
+		return errors.New("target is empty")
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	ok, err := blkdev.IsBlockDevice(device)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("'%s' is not a block device", device)
+	}
+	if ok, err = blkdev.HasBtrfsMagic(device); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("'%s' has no btrfs filesystem", device)
+	}
+	if err := isDir(target); err != nil {
+		return err
+	}
+
+	if err := syscall.Mount(device, target, "btrfs", opts.flags(), opts.data()); err != nil {
+		return &os.PathError{Op: "mount", Path: target, Err: err}
+	}
+	return nil
+}
+
+// MountSubvolume mounts the subvolume at path of a mounted btrfs filesystem at target as well,
+// the subvolume is selected by its id.
+func MountSubvolume(subvol, target string, opts Options) error {
+	if len(opts.Subvol) > 0 || opts.SubvolID != 0 {
+		return errors.New("subvol and subvolid are set by MountSubvolume")
+	}
+
+	ok, err := ioctl.TestIsSubvolume(subvol)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("'%s' is not a subvolume", subvol)
+	}
+
+	m, err := mountinfo.Find(subvol)
+	if err != nil {
+		return err
+	}
+	if m.FsType != "btrfs" {
+		return fmt.Errorf("'%s' is not on a btrfs filesystem", subvol)
+	}
+
+	if opts.SubvolID, err = ioctl.GetRootId(subvol); err != nil {
+		return err
+	}
+	return Mount(m.Source, target, opts)
+}
+
+// checkTarget makes sure target is the mount point of a btrfs subvolume before it is unmounted
+func checkTarget(target string) error {
+	if len(target) == 0 {
+		return errors.New("target is empty")
+	}
+
+	ok, err := mountinfo.IsMountPoint(target)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("'%s' is not a mount point", target)
+	}
+
+	m, err := mountinfo.Find(target)
+	if err != nil {
+		return err
+	}
+	if m.FsType != "btrfs" {
+		return fmt.Errorf("'%s' is not a btrfs mount, found %s", target, m.FsType)
+	}
+
+	if ok, err = ioctl.TestIsSubvolume(target); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("'%s' is not a subvolume", target)
+	}
+	return nil
+}
+
+func unmount(target string, flags int) error {
+	if err := checkTarget(target); err != nil {
+		return err
+	}
+	if err := syscall.Unmount(target, flags); err != nil {
+		return &os.PathError{Op: "umount", Path: target, Err: err}
+	}
+	return nil
+}
+
+// Unmount unmounts the btrfs subvolume mounted at target, it fails if the filesystem is busy
+func Unmount(target string) error {
+	return unmount(target, 0)
+}
+
+// LazyUnmount detaches the btrfs subvolume mounted at target at once,
+// the filesystem is cleaned up when it is not busy anymore
+func LazyUnmount(target string) error {
+	return unmount(target, syscall.MNT_DETACH)
+}
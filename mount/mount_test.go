@@ -0,0 +1,102 @@
+package mount
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsData(t *testing.T) {
+	assert.Equal(t, "", Options{}.data())
+	assert.Equal(t, uintptr(0), Options{}.flags())
+
+	opts := Options{
+		Subvol:        "releases/v1",
+		Compress:      "zstd",
+		CompressLevel: 3,
+		NoAtime:       true,
+		SpaceCache:    SpaceCacheV2,
+		SSD:           true,
+		Discard:       DiscardAsync,
+		Degraded:      true,
+		ReadOnly:      true,
+	}
+	assert.Equal(t, "subvol=releases/v1,compress=zstd:3,space_cache=v2,ssd,discard=async,degraded", opts.data())
+	assert.Equal(t, uintptr(syscall.MS_RDONLY|syscall.MS_NOATIME), opts.flags())
+
+	opts = Options{SubvolID: 256, Compress: "lzo", SpaceCache: NoSpaceCache}
+	assert.Equal(t, "subvolid=256,compress=lzo,nospace_cache", opts.data())
+}
+
+func TestOptionsValidate(t *testing.T) {
+	assert.NoError(t, Options{}.validate())
+	assert.NoError(t, Options{Compress: "zlib", CompressLevel: 9}.validate())
+
+	err := Options{Subvol: "a", SubvolID: 256}.validate()
+	assert.EqualError(t, err, "subvol and subvolid are exclusive")
+
+	err = Options{Compress: "gzip"}.validate()
+	assert.EqualError(t, err, "unknown compression algorithm 'gzip', expected zlib, lzo, zstd or none")
+
+	err = Options{Compress: "lzo", CompressLevel: 1}.validate()
+	assert.EqualError(t, err, "invalid compression level 1 for 'lzo'")
+
+	err = Options{Compress: "zstd", CompressLevel: 16}.validate()
+	assert.EqualError(t, err, "invalid compression level 16 for 'zstd'")
+
+	err = Options{CompressLevel: 1}.validate()
+	assert.EqualError(t, err, "compression level without algorithm")
+
+	err = Options{SpaceCache: "v3"}.validate()
+	assert.EqualError(t, err, "invalid space cache 'v3', expected v1, v2 or none")
+
+	err = Options{Discard: "always"}.validate()
+	assert.EqualError(t, err, "invalid discard 'always', expected sync or async")
+}
+
+func TestMountValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mount-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = Mount("", dir, Options{})
+	assert.EqualError(t, err, "device is empty")
+
+	err = Mount("/dev/null", "", Options{})
+	assert.EqualError(t, err, "target is empty")
+
+	err = Mount("/dev/null", dir, Options{Discard: "always"})
+	assert.Error(t, err)
+
+	err = Mount("/dev/null", dir, Options{})
+	assert.EqualError(t, err, "'/dev/null' is not a block device")
+
+	err = MountSubvolume(dir, dir, Options{SubvolID: 5})
+	assert.EqualError(t, err, "subvol and subvolid are set by MountSubvolume")
+
+	err = MountSubvolume(dir, dir, Options{})
+	assert.EqualError(t, err, "'"+dir+"' is not a subvolume")
+}
+
+func TestUnmountValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mount-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = Unmount("")
+	assert.EqualError(t, err, "target is empty")
+
+	if _, err := os.Stat("/proc/self/mountinfo"); err != nil {
+		t.Skip("no /proc/self/mountinfo")
+	}
+
+	err = Unmount(dir)
+	assert.EqualError(t, err, "'"+dir+"' is not a mount point")
+
+	err = LazyUnmount(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package property
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+)
+
+type propGet struct {
+	object     string
+	objectType btrfs.ObjectType
+	name       string
+
+	executor func(c *propGet) ([]btrfs.PropertyValue, error)
+}
+
+func (c *propGet) Object(path string) btrfs.PropertyGet {
+	c.object = path
+	return c
+}
+
+func (c *propGet) Type(objectType btrfs.ObjectType) btrfs.PropertyGet {
+	c.objectType = objectType
+	return c
+}
+
+func (c *propGet) Name(name string) btrfs.PropertyGet {
+	c.name = name
+	return c
+}
+
+func (c *propGet) context() string {
+	return fmt.Sprintf("object='%s', type='%s', name='%s'", c.object, c.objectType, c.name)
+}
+
+func (c *propGet) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdPropertyGet), Context: c.context(), Err: err}
+}
+
+func (c *propGet) validate() error {
+	if len(c.object) == 0 {
+		return errors.New("object is empty")
+	}
+	return validType(c.objectType)
+}
+
+func (c *propGet) Execute() ([]btrfs.PropertyValue, error) {
+	values, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return values, nil
+}
+
+// btrfs ioctl executor
+func ioctlGetExecute(c *propGet) ([]btrfs.PropertyValue, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := resolve(c.object, c.objectType)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := find(c.object, types, c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []btrfs.PropertyValue
+	for _, h := range found {
+		value, err := h.get(c.object)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, btrfs.PropertyValue{Name: h.name, Value: value, Type: h.objectType})
+	}
+	return values, nil
+}
+
+// btrfs cli executor
+func cliGetExecute(c *propGet) ([]btrfs.PropertyValue, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlGet() interface{} {
+	return &propGet{executor: ioctlGetExecute}
+}
+
+func cliGet() interface{} {
+	return &propGet{executor: cliGetExecute}
+}
@@ -0,0 +1,91 @@
+package property
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+)
+
+type propList struct {
+	object     string
+	objectType btrfs.ObjectType
+
+	executor func(c *propList) ([]btrfs.PropertyInfo, error)
+}
+
+func (c *propList) Object(path string) btrfs.PropertyList {
+	c.object = path
+	return c
+}
+
+func (c *propList) Type(objectType btrfs.ObjectType) btrfs.PropertyList {
+	c.objectType = objectType
+	return c
+}
+
+func (c *propList) context() string {
+	return fmt.Sprintf("object='%s', type='%s'", c.object, c.objectType)
+}
+
+func (c *propList) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdPropertyList), Context: c.context(), Err: err}
+}
+
+func (c *propList) validate() error {
+	if len(c.object) == 0 {
+		return errors.New("object is empty")
+	}
+	return validType(c.objectType)
+}
+
+func (c *propList) Execute() ([]btrfs.PropertyInfo, error) {
+	infos, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return infos, nil
+}
+
+// btrfs ioctl executor
+func ioctlListExecute(c *propList) ([]btrfs.PropertyInfo, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := resolve(c.object, c.objectType)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := find(c.object, types, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []btrfs.PropertyInfo
+	for _, h := range found {
+		infos = append(infos, btrfs.PropertyInfo{Name: h.name, Description: h.description, Type: h.objectType})
+	}
+	return infos, nil
+}
+
+// btrfs cli executor
+func cliListExecute(c *propList) ([]btrfs.PropertyInfo, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlList() interface{} {
+	return &propList{executor: ioctlListExecute}
+}
+
+func cliList() interface{} {
+	return &propList{executor: cliListExecute}
+}
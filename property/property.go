@@ -0,0 +1,253 @@
+package property
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/blkdev"
+	"github.com/plar/btrfs/internal/mountinfo"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdPropertyGet, ioctlGet)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdPropertyGet, cliGet)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdPropertySet, ioctlSet)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdPropertySet, cliSet)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdPropertyList, ioctlList)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdPropertyList, cliList)
+}
+
+// compressionXattr stores the compression of an inode
+const compressionXattr = "btrfs.compression"
+
+type handler struct {
+	name        string
+	description string
+	objectType  btrfs.ObjectType
+	get         func(path string) (string, error)
+	set         func(path, value string) error
+	// setForce replaces set if the caller forces the change, nil if there is nothing to force
+	setForce func(path, value string) error
+}
+
+var handlers = []handler{
+	{"ro", "read-only status of a subvolume", btrfs.ObjectSubvol, getReadOnly, setReadOnly, forceReadOnly},
+	{"label", "label of the filesystem", btrfs.ObjectFilesystem, ioctl.GetLabel, ioctl.SetLabel, nil},
+	{"label", "label of the device", btrfs.ObjectDevice, getDeviceLabel, setDeviceLabel, nil},
+	{"compression", "compression algorithm of the file or directory", btrfs.ObjectInode, getCompression, setCompression, nil},
+}
+
+// objectTypes are the valid object types in the order the properties are listed
+var objectTypes = []btrfs.ObjectType{btrfs.ObjectSubvol, btrfs.ObjectFilesystem, btrfs.ObjectDevice, btrfs.ObjectInode}
+
+func validType(objectType btrfs.ObjectType) error {
+	if len(objectType) == 0 {
+		return nil
+	}
+	for _, t := range objectTypes {
+		if t == objectType {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown object type '%s'", objectType)
+}
+
+// detect returns the object types of the path, a directory can be a subvolume,
+// the mount point of the filesystem and an inode at once
+func detect(path string) ([]btrfs.ObjectType, error) {
+	if ok, err := blkdev.IsBlockDevice(path); err != nil {
+		return nil, err
+	} else if ok {
+		return []btrfs.ObjectType{btrfs.ObjectDevice}, nil
+	}
+
+	m, err := mountinfo.Find(path)
+	if err != nil {
+		return nil, err
+	}
+	if m.FsType != "btrfs" {
+		return nil, fmt.Errorf("'%s' is not on a btrfs filesystem", path)
+	}
+
+	var types []btrfs.ObjectType
+	if ok, err := ioctl.TestIsSubvolume(path); err != nil {
+		return nil, err
+	} else if ok {
+		types = append(types, btrfs.ObjectSubvol)
+	}
+
+	if ok, err := mountinfo.IsMountPoint(path); err != nil {
+		return nil, err
+	} else if ok {
+		types = append(types, btrfs.ObjectFilesystem)
+	}
+
+	return append(types, btrfs.ObjectInode), nil
+}
+
+// resolve returns the object types of the path, restricted to objectType if it is set
+func resolve(path string, objectType btrfs.ObjectType) ([]btrfs.ObjectType, error) {
+	types, err := detect(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(objectType) == 0 {
+		return types, nil
+	}
+
+	for _, t := range types {
+		if t == objectType {
+			return []btrfs.ObjectType{t}, nil
+		}
+	}
+	return nil, fmt.Errorf("'%s' is not a %s", path, objectType)
+}
+
+// find returns the handlers of the types, all of them if name is empty
+func find(path string, types []btrfs.ObjectType, name string) ([]handler, error) {
+	var found []handler
+	for _, t := range types {
+		for _, h := range handlers {
+			if h.objectType == t && (len(name) == 0 || h.name == name) {
+				found = append(found, h)
+			}
+		}
+	}
+	if len(name) == 0 || len(found) > 0 {
+		return found, nil
+	}
+
+	for _, h := range handlers {
+		if h.name == name {
+			return nil, fmt.Errorf("property '%s' does not apply to '%s'", name, path)
+		}
+	}
+	return nil, fmt.Errorf("unknown property '%s'", name)
+}
+
+func getReadOnly(path string) (string, error) {
+	flags, err := ioctl.SubvolGetFlags(path)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatBool(flags&ioctl.SubvolFlagReadOnly != 0), nil
+}
+
+// isReceived reports whether the subvolume has a received uuid
+func isReceived(path string) (bool, error) {
+	id, err := ioctl.GetRootId(path)
+	if err != nil {
+		return false, err
+	}
+	subvols, err := ioctl.SubvolListAll(path)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range subvols {
+		if s.Id == id {
+			return len(s.ReceivedUUID) > 0 && !bytes.Equal(s.ReceivedUUID, make([]byte, len(s.ReceivedUUID))), nil
+		}
+	}
+	return false, nil
+}
+
+func setReadOnly(path, value string) error {
+	return changeReadOnly(path, value, false)
+}
+
+func forceReadOnly(path, value string) error {
+	return changeReadOnly(path, value, true)
+}
+
+// changeReadOnly refuses to make a received subvolume writable like btrfs property set does,
+// incremental receives would use it as parent after it changed. Forced, the received uuid is cleared.
+func changeReadOnly(path, value string, force bool) error {
+	ro, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid value '%s' for ro, expected true or false", value)
+	}
+
+	flags, err := ioctl.SubvolGetFlags(path)
+	if err != nil {
+		return err
+	}
+	if ro {
+		return ioctl.SubvolSetFlags(path, flags|ioctl.SubvolFlagReadOnly)
+	}
+
+	received, err := isReceived(path)
+	if err != nil {
+		return err
+	}
+	if received && !force {
+		return fmt.Errorf("'%s' is a received subvolume, making it writable requires force and clears its received uuid", path)
+	}
+
+	if err := ioctl.SubvolSetFlags(path, flags&^ioctl.SubvolFlagReadOnly); err != nil {
+		return err
+	}
+	if received {
+		// the kernel refuses to change the received uuid of read only subvolumes
+		return ioctl.SetReceivedSubvol(path, make([]byte, 16), 0)
+	}
+	return nil
+}
+
+// the label of a mounted device is read and changed through the filesystem
+func getDeviceLabel(device string) (string, error) {
+	point, err := blkdev.MountPoint(device)
+	if err != nil {
+		return "", err
+	}
+	if len(point) > 0 {
+		return ioctl.GetLabel(point)
+	}
+	return blkdev.Label(device)
+}
+
+func setDeviceLabel(device, label string) error {
+	point, err := blkdev.MountPoint(device)
+	if err != nil {
+		return err
+	}
+	if len(point) == 0 {
+		return fmt.Errorf("setting the label of the unmounted device '%s' is not supported", device)
+	}
+	return ioctl.SetLabel(point, label)
+}
+
+func getCompression(path string) (string, error) {
+	buf := make([]byte, 64)
+	n, err := syscall.Getxattr(path, compressionXattr, buf)
+	if err == syscall.ENODATA {
+		return "", nil
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+	return string(buf[:n]), nil
+}
+
+func setCompression(path, value string) error {
+	if len(value) == 0 {
+		err := syscall.Removexattr(path, compressionXattr)
+		if err != nil && err != syscall.ENODATA {
+			return &os.PathError{Op: "removexattr", Path: path, Err: err}
+		}
+		return nil
+	}
+
+	if err := validators.ValidCompression(value); err != nil {
+		return err
+	}
+	if err := syscall.Setxattr(path, compressionXattr, []byte(value), 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package property
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	_ "github.com/plar/btrfs/subvolume"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func get(t *testing.T, path string, objectType btrfs.ObjectType, name string) string {
+	values, err := btrfs.NewIoctl().Property().Get().Object(path).Type(objectType).Name(name).Execute()
+	assert.NoError(t, err)
+	if assert.Len(t, values, 1) {
+		assert.Equal(t, name, values[0].Name)
+		return values[0].Value
+	}
+	return ""
+}
+
+func TestPropertyValidation(t *testing.T) {
+	_, err := btrfs.NewIoctl().Property().Get().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "object is empty")
+
+	_, err = btrfs.NewIoctl().Property().Get().Object(mount).Type("volume").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown object type 'volume'")
+
+	err = btrfs.NewIoctl().Property().Set().Object(mount).Value("true").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "name is empty")
+
+	_, err = btrfs.NewIoctl().Property().Get().Object(mount).Name("color").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown property 'color'")
+
+	_, err = btrfs.NewIoctl().Property().Get().Object(os.TempDir()).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not on a btrfs filesystem")
+}
+
+func TestPropertyList(t *testing.T) {
+	infos, err := btrfs.NewIoctl().Property().List().Object(mount).Execute()
+	assert.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, string(info.Type)+":"+info.Name)
+	}
+	assert.Equal(t, []string{"subvol:ro", "filesystem:label", "inode:compression"}, names)
+
+	dir := filepath.Join(mount, "list-dir")
+	assert.NoError(t, os.Mkdir(dir, 0700))
+	infos, err = btrfs.NewIoctl().Property().List().Object(dir).Execute()
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, "compression", infos[0].Name)
+	}
+
+	_, err = btrfs.NewIoctl().Property().List().Object(dir).Type(btrfs.ObjectSubvol).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a subvol")
+}
+
+func TestReadOnly(t *testing.T) {
+	subvol := filepath.Join(mount, "ro-subvol")
+	err := btrfs.NewIoctl().Subvolume().Create().Destination(subvol).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "false", get(t, subvol, "", "ro"))
+
+	err = btrfs.NewIoctl().Property().Set().Object(subvol).Name("ro").Value("true").Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "true", get(t, subvol, btrfs.ObjectSubvol, "ro"))
+	assert.Error(t, os.Mkdir(filepath.Join(subvol, "dir"), 0700))
+
+	err = btrfs.NewIoctl().Property().Set().Object(subvol).Name("ro").Value("false").Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "false", get(t, subvol, "", "ro"))
+	assert.NoError(t, os.Mkdir(filepath.Join(subvol, "dir"), 0700))
+
+	err = btrfs.NewIoctl().Property().Set().Object(subvol).Name("ro").Value("maybe").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid value 'maybe'")
+
+	err = btrfs.NewIoctl().Property().Set().Object(filepath.Join(subvol, "dir")).Name("ro").Value("true").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "property 'ro' does not apply to")
+}
+
+func TestLabel(t *testing.T) {
+	err := btrfs.NewIoctl().Property().Set().Object(mount).Name("label").Value("backup").Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", get(t, mount, "", "label"))
+	assert.Equal(t, "backup", get(t, mount, btrfs.ObjectFilesystem, "label"))
+
+	err = btrfs.NewIoctl().Property().Set().Object(mount).Name("label").Value(strings.Repeat("x", 256)).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "label is too long")
+
+	err = btrfs.NewIoctl().Property().Set().Object(mount).Name("label").Value("").Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "", get(t, mount, "", "label"))
+}
+
+func TestCompression(t *testing.T) {
+	dir := filepath.Join(mount, "compressed")
+	assert.NoError(t, os.Mkdir(dir, 0700))
+	assert.Equal(t, "", get(t, dir, "", "compression"))
+
+	err := btrfs.NewIoctl().Property().Set().Object(dir).Name("compression").Value("zstd").Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "zstd", get(t, dir, btrfs.ObjectInode, "compression"))
+
+	err = btrfs.NewIoctl().Property().Set().Object(dir).Name("compression").Value("gzip").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid compression 'gzip'")
+
+	err = btrfs.NewIoctl().Property().Set().Object(dir).Name("compression").Value("").Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "", get(t, dir, "", "compression"))
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,111 @@
+package property
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+)
+
+type propSet struct {
+	object     string
+	objectType btrfs.ObjectType
+	name       string
+	value      string
+	force      bool
+
+	executor func(c *propSet) error
+}
+
+func (c *propSet) Object(path string) btrfs.PropertySet {
+	c.object = path
+	return c
+}
+
+func (c *propSet) Type(objectType btrfs.ObjectType) btrfs.PropertySet {
+	c.objectType = objectType
+	return c
+}
+
+func (c *propSet) Name(name string) btrfs.PropertySet {
+	c.name = name
+	return c
+}
+
+func (c *propSet) Value(value string) btrfs.PropertySet {
+	c.value = value
+	return c
+}
+
+func (c *propSet) Force() btrfs.PropertySet {
+	c.force = true
+	return c
+}
+
+func (c *propSet) context() string {
+	return fmt.Sprintf("object='%s', type='%s', name='%s', value='%s', force=%v", c.object, c.objectType, c.name, c.value, c.force)
+}
+
+func (c *propSet) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdPropertySet), Context: c.context(), Err: err}
+}
+
+func (c *propSet) validate() error {
+	if len(c.object) == 0 {
+		return errors.New("object is empty")
+	}
+	if len(c.name) == 0 {
+		return errors.New("name is empty")
+	}
+	return validType(c.objectType)
+}
+
+func (c *propSet) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlSetExecute(c *propSet) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	types, err := resolve(c.object, c.objectType)
+	if err != nil {
+		return err
+	}
+
+	found, err := find(c.object, types, c.name)
+	if err != nil {
+		return err
+	}
+
+	if c.force && found[0].setForce != nil {
+		return found[0].setForce(c.object, c.value)
+	}
+	return found[0].set(c.object, c.value)
+}
+
+// btrfs cli executor
+func cliSetExecute(c *propSet) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlSet() interface{} {
+	return &propSet{executor: ioctlSetExecute}
+}
+
+func cliSet() interface{} {
+	return &propSet{executor: cliSetExecute}
+}
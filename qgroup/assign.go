@@ -0,0 +1,86 @@
+package qgroup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+)
+
+type qgroupAssign struct {
+	path   string
+	child  string
+	parent string
+	rescan bool
+
+	executor func(c *qgroupAssign) error
+}
+
+func (c *qgroupAssign) Path(path string) btrfs.QgroupAssign {
+	c.path = path
+	return c
+}
+
+func (c *qgroupAssign) Child(qgroupid string) btrfs.QgroupAssign {
+	c.child = qgroupid
+	return c
+}
+
+func (c *qgroupAssign) Parent(qgroupid string) btrfs.QgroupAssign {
+	c.parent = qgroupid
+	return c
+}
+
+func (c *qgroupAssign) Rescan() btrfs.QgroupAssign {
+	c.rescan = true
+	return c
+}
+
+func (c *qgroupAssign) context() string {
+	return fmt.Sprintf("path='%s', child='%s', parent='%s', rescan=%v", c.path, c.child, c.parent, c.rescan)
+}
+
+func (c *qgroupAssign) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQgroupAssign), Context: c.context(), Err: err}
+}
+
+func (c *qgroupAssign) validate() error {
+	return validateRelation(c.path, c.child, c.parent)
+}
+
+func (c *qgroupAssign) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlAssignExecute(c *qgroupAssign) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return relation(c.path, c.child, c.parent, true, c.rescan)
+}
+
+// btrfs cli executor
+func cliAssignExecute(c *qgroupAssign) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlAssign() interface{} {
+	return &qgroupAssign{executor: ioctlAssignExecute}
+}
+
+func cliAssign() interface{} {
+	return &qgroupAssign{executor: cliAssignExecute}
+}
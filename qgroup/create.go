@@ -0,0 +1,82 @@
+package qgroup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+type qgroupCreate struct {
+	path     string
+	qgroupid string
+
+	executor func(c *qgroupCreate) error
+}
+
+func (c *qgroupCreate) Path(path string) btrfs.QgroupCreate {
+	c.path = path
+	return c
+}
+
+func (c *qgroupCreate) ID(qgroupid string) btrfs.QgroupCreate {
+	c.qgroupid = qgroupid
+	return c
+}
+
+func (c *qgroupCreate) context() string {
+	return fmt.Sprintf("path='%s', qgroupid='%s'", c.path, c.qgroupid)
+}
+
+func (c *qgroupCreate) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQgroupCreate), Context: c.context(), Err: err}
+}
+
+func (c *qgroupCreate) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	_, err := validators.ParseQgroupID(c.qgroupid)
+	return err
+}
+
+func (c *qgroupCreate) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlCreateExecute(c *qgroupCreate) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	qgroupid, _ := validators.ParseQgroupID(c.qgroupid)
+	return ioctl.QgroupCreate(c.path, qgroupid)
+}
+
+// btrfs cli executor
+func cliCreateExecute(c *qgroupCreate) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlCreate() interface{} {
+	return &qgroupCreate{executor: ioctlCreateExecute}
+}
+
+func cliCreate() interface{} {
+	return &qgroupCreate{executor: cliCreateExecute}
+}
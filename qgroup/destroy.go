@@ -0,0 +1,82 @@
+package qgroup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+type qgroupDestroy struct {
+	path     string
+	qgroupid string
+
+	executor func(c *qgroupDestroy) error
+}
+
+func (c *qgroupDestroy) Path(path string) btrfs.QgroupDestroy {
+	c.path = path
+	return c
+}
+
+func (c *qgroupDestroy) ID(qgroupid string) btrfs.QgroupDestroy {
+	c.qgroupid = qgroupid
+	return c
+}
+
+func (c *qgroupDestroy) context() string {
+	return fmt.Sprintf("path='%s', qgroupid='%s'", c.path, c.qgroupid)
+}
+
+func (c *qgroupDestroy) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQgroupDestroy), Context: c.context(), Err: err}
+}
+
+func (c *qgroupDestroy) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	_, err := validators.ParseQgroupID(c.qgroupid)
+	return err
+}
+
+func (c *qgroupDestroy) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlDestroyExecute(c *qgroupDestroy) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	qgroupid, _ := validators.ParseQgroupID(c.qgroupid)
+	return ioctl.QgroupDestroy(c.path, qgroupid)
+}
+
+// btrfs cli executor
+func cliDestroyExecute(c *qgroupDestroy) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlDestroy() interface{} {
+	return &qgroupDestroy{executor: ioctlDestroyExecute}
+}
+
+func cliDestroy() interface{} {
+	return &qgroupDestroy{executor: cliDestroyExecute}
+}
@@ -0,0 +1,140 @@
+package qgroup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+const none = "none"
+
+type qgroupLimit struct {
+	path       string
+	qgroupid   string
+	referenced string
+	exclusive  string
+
+	executor func(c *qgroupLimit) error
+}
+
+func (c *qgroupLimit) Path(path string) btrfs.QgroupLimit {
+	c.path = path
+	return c
+}
+
+func (c *qgroupLimit) ID(qgroupid string) btrfs.QgroupLimit {
+	c.qgroupid = qgroupid
+	return c
+}
+
+func (c *qgroupLimit) Referenced(size string) btrfs.QgroupLimit {
+	c.referenced = size
+	return c
+}
+
+func (c *qgroupLimit) Exclusive(size string) btrfs.QgroupLimit {
+	c.exclusive = size
+	return c
+}
+
+func (c *qgroupLimit) context() string {
+	return fmt.Sprintf("path='%s', qgroupid='%s', referenced='%s', exclusive='%s'",
+		c.path, c.qgroupid, c.referenced, c.exclusive)
+}
+
+func (c *qgroupLimit) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQgroupLimit), Context: c.context(), Err: err}
+}
+
+// limit parses the size of a limit, "none" removes the limit
+func limit(size string) (uint64, error) {
+	if size == none {
+		return ioctl.QgroupLimitNone, nil
+	}
+	return validators.ParseSize(size)
+}
+
+func (c *qgroupLimit) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	if len(c.qgroupid) > 0 {
+		if _, err := validators.ParseQgroupID(c.qgroupid); err != nil {
+			return err
+		}
+	}
+
+	if len(c.referenced) == 0 && len(c.exclusive) == 0 {
+		return errors.New("no limits")
+	}
+
+	if len(c.referenced) > 0 {
+		if _, err := limit(c.referenced); err != nil {
+			return fmt.Errorf("referenced: %v", err)
+		}
+	}
+
+	if len(c.exclusive) > 0 {
+		if _, err := limit(c.exclusive); err != nil {
+			return fmt.Errorf("exclusive: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *qgroupLimit) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlLimitExecute(c *qgroupLimit) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	var qgroupid, flags, maxRfer, maxExcl uint64
+	if len(c.qgroupid) > 0 {
+		qgroupid, _ = validators.ParseQgroupID(c.qgroupid)
+	}
+
+	if len(c.referenced) > 0 {
+		flags |= ioctl.QgroupLimitMaxRfer
+		maxRfer, _ = limit(c.referenced)
+	}
+
+	if len(c.exclusive) > 0 {
+		flags |= ioctl.QgroupLimitMaxExcl
+		maxExcl, _ = limit(c.exclusive)
+	}
+
+	return ioctl.QgroupLimit(c.path, qgroupid, flags, maxRfer, maxExcl)
+}
+
+// btrfs cli executor
+func cliLimitExecute(c *qgroupLimit) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlLimit() interface{} {
+	return &qgroupLimit{executor: ioctlLimitExecute}
+}
+
+func cliLimit() interface{} {
+	return &qgroupLimit{executor: cliLimitExecute}
+}
@@ -0,0 +1,72 @@
+package qgroup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/validators"
+)
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQgroupCreate, ioctlCreate)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQgroupDestroy, ioctlDestroy)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQgroupAssign, ioctlAssign)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQgroupRemove, ioctlRemove)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQgroupLimit, ioctlLimit)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQgroupShow, ioctlShow)
+
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQgroupCreate, cliCreate)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQgroupDestroy, cliDestroy)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQgroupAssign, cliAssign)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQgroupRemove, cliRemove)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQgroupLimit, cliLimit)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQgroupShow, cliShow)
+}
+
+func level(qgroupid uint64) uint64 {
+	return qgroupid >> 48
+}
+
+// validateRelation checks the child and parent qgroup ids of an assign or remove
+func validateRelation(path, child, parent string) error {
+	if len(path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	src, err := validators.ParseQgroupID(child)
+	if err != nil {
+		return fmt.Errorf("child: %v", err)
+	}
+
+	dst, err := validators.ParseQgroupID(parent)
+	if err != nil {
+		return fmt.Errorf("parent: %v", err)
+	}
+
+	if level(src) >= level(dst) {
+		return fmt.Errorf("parent qgroup '%s' must have a higher level than child '%s'", parent, child)
+	}
+
+	return nil
+}
+
+// relation assigns or removes the child qgroup to the parent and rescans the quota if requested
+// and the kernel reports the accounting inconsistent
+func relation(path, child, parent string, assign, rescan bool) error {
+	src, _ := validators.ParseQgroupID(child)
+	dst, _ := validators.ParseQgroupID(parent)
+
+	inconsistent, err := ioctl.QgroupAssign(path, src, dst, assign)
+	if err != nil || !inconsistent || !rescan {
+		return err
+	}
+
+	return ioctl.QuotaRescan(path)
+}
+
+// formatID formats the qgroup id in the level/id form
+func formatID(qgroupid uint64) string {
+	return fmt.Sprintf("%d/%d", level(qgroupid), qgroupid&(1<<48-1))
+}
@@ -0,0 +1,218 @@
+package qgroup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	_ "github.com/plar/btrfs/quota"
+	_ "github.com/plar/btrfs/subvolume"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func TestQgroupValidation(t *testing.T) {
+	qgroup := btrfs.NewIoctl().Qgroup()
+
+	err := qgroup.Create().ID("1/100").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = qgroup.Create().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "qgroup id is empty")
+
+	err = qgroup.Destroy().Path(mount).ID("x/1").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid qgroup id 'x/1'")
+
+	err = qgroup.Assign().Path(mount).Child("1/100").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "parent: qgroup id is empty")
+
+	err = qgroup.Assign().Path(mount).Child("1/100").Parent("1/200").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must have a higher level")
+
+	err = qgroup.Remove().Path(mount).Child("2/1").Parent("1/1").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must have a higher level")
+
+	err = qgroup.Limit().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no limits")
+
+	err = qgroup.Limit().Path(mount).Referenced("lots").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "referenced: invalid size 'lots'")
+
+	err = qgroup.Limit().Path(mount).Exclusive("").Referenced("1G").ID("1/").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid qgroup id '1/'")
+}
+
+func TestQgroup(t *testing.T) {
+	qgroup := btrfs.NewIoctl().Qgroup()
+
+	err := qgroup.Create().Path(mount).ID("1/100").Execute()
+	assert.NoError(t, err)
+
+	err = qgroup.Create().Path(mount).ID("1/100").Execute()
+	assert.Error(t, err)
+
+	// the top level subvolume qgroup
+	err = qgroup.Assign().Path(mount).Child("0/5").Parent("1/100").Rescan().Execute()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = btrfs.NewIoctl().Quota().RescanStatus().Path(mount).Wait(ctx)
+	assert.NoError(t, err)
+
+	err = qgroup.Limit().Path(mount).ID("1/100").Referenced("1G").Exclusive("512M").Execute()
+	assert.NoError(t, err)
+
+	err = qgroup.Limit().Path(mount).ID("1/100").Exclusive("none").Execute()
+	assert.NoError(t, err)
+
+	// the qgroup of the subvolume at path
+	err = qgroup.Limit().Path(mount).Referenced("100M").Execute()
+	assert.NoError(t, err)
+
+	err = qgroup.Limit().Path(mount).Referenced("none").Execute()
+	assert.NoError(t, err)
+
+	err = qgroup.Remove().Path(mount).Child("5").Parent("1/100").Execute()
+	assert.NoError(t, err)
+
+	err = qgroup.Destroy().Path(mount).ID("1/100").Execute()
+	assert.NoError(t, err)
+
+	err = qgroup.Destroy().Path(mount).ID("1/100").Execute()
+	assert.Error(t, err)
+}
+
+func TestQgroupShow(t *testing.T) {
+	qgroup := btrfs.NewIoctl().Qgroup()
+
+	_, err := qgroup.Show().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = qgroup.Show().Path(mount).Sort("size").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown sort key 'size'")
+
+	tenant := filepath.Join(mount, "tenant")
+	err = btrfs.NewIoctl().Subvolume().Create().Destination(tenant).Execute()
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(tenant, "data"), make([]byte, 1024*1024), 0600)
+	assert.NoError(t, err)
+
+	err = qgroup.Create().Path(mount).ID("1/200").Execute()
+	assert.NoError(t, err)
+	err = qgroup.Limit().Path(tenant).Referenced("1G").Execute()
+	assert.NoError(t, err)
+
+	subvols, err := btrfs.NewIoctl().Subvolume().List().Path(mount).Execute()
+	assert.NoError(t, err)
+	var tenantID string
+	for _, s := range subvols {
+		if s.Path == "tenant" {
+			tenantID = fmt.Sprintf("0/%d", s.ID)
+		}
+	}
+	assert.NotEmpty(t, tenantID)
+
+	err = qgroup.Assign().Path(mount).Child(tenantID).Parent("1/200").Rescan().Execute()
+	assert.NoError(t, err)
+
+	// the accounting is updated on commit
+	syscall.Sync()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = btrfs.NewIoctl().Quota().RescanStatus().Path(mount).Wait(ctx)
+	assert.NoError(t, err)
+
+	qgroups, err := qgroup.Show().Path(mount).Execute()
+	assert.NoError(t, err)
+
+	byID := map[string]btrfs.QgroupInfo{}
+	for _, q := range qgroups {
+		byID[q.ID] = q
+	}
+
+	assert.Equal(t, "<FS_TREE>", byID["0/5"].Path)
+
+	q, ok := byID[tenantID]
+	if assert.True(t, ok) {
+		assert.Equal(t, "tenant", q.Path)
+		assert.Equal(t, uint16(0), q.Level)
+		assert.True(t, q.Exclusive >= 1024*1024)
+		assert.Equal(t, uint64(1<<30), q.MaxReferenced)
+		assert.Equal(t, uint64(0), q.MaxExclusive)
+		assert.Equal(t, []string{"1/200"}, q.Parents)
+	}
+
+	q, ok = byID["1/200"]
+	if assert.True(t, ok) {
+		assert.Equal(t, "", q.Path)
+		assert.Equal(t, []string{tenantID}, q.Children)
+	}
+
+	// the qgroups of the tenant subvolume including the parent
+	qgroups, err = qgroup.Show().Path(tenant).FilterPath().Execute()
+	assert.NoError(t, err)
+	if assert.Len(t, qgroups, 2) {
+		assert.Equal(t, tenantID, qgroups[0].ID)
+		assert.Equal(t, "1/200", qgroups[1].ID)
+	}
+
+	// an ordinary directory of the subvolume works as path too
+	dir := filepath.Join(tenant, "dir")
+	assert.NoError(t, os.Mkdir(dir, 0700))
+	qgroups, err = qgroup.Show().Path(dir).FilterPath().Execute()
+	assert.NoError(t, err)
+	if assert.Len(t, qgroups, 2) {
+		assert.Equal(t, tenantID, qgroups[0].ID)
+		assert.Equal(t, "tenant", qgroups[0].Path)
+	}
+
+	qgroups, err = qgroup.Show().Path(mount).FilterLevel(1).Execute()
+	assert.NoError(t, err)
+	for _, q := range qgroups {
+		assert.Equal(t, uint16(1), q.Level)
+	}
+
+	qgroups, err = qgroup.Show().Path(mount).FilterLevel(0).Sort("-excl,qgroupid").Execute()
+	assert.NoError(t, err)
+	for i := 1; i < len(qgroups); i++ {
+		assert.True(t, qgroups[i-1].Exclusive >= qgroups[i].Exclusive)
+	}
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+
+	if err := btrfs.NewIoctl().Quota().Enable().Path(mount).Execute(); err != nil {
+		loop.Teardown()
+		log.Fatalf("ERROR: quota enable %s, err=%s", mount, err)
+	}
+
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
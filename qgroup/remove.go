@@ -0,0 +1,86 @@
+package qgroup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+)
+
+type qgroupRemove struct {
+	path   string
+	child  string
+	parent string
+	rescan bool
+
+	executor func(c *qgroupRemove) error
+}
+
+func (c *qgroupRemove) Path(path string) btrfs.QgroupRemove {
+	c.path = path
+	return c
+}
+
+func (c *qgroupRemove) Child(qgroupid string) btrfs.QgroupRemove {
+	c.child = qgroupid
+	return c
+}
+
+func (c *qgroupRemove) Parent(qgroupid string) btrfs.QgroupRemove {
+	c.parent = qgroupid
+	return c
+}
+
+func (c *qgroupRemove) Rescan() btrfs.QgroupRemove {
+	c.rescan = true
+	return c
+}
+
+func (c *qgroupRemove) context() string {
+	return fmt.Sprintf("path='%s', child='%s', parent='%s', rescan=%v", c.path, c.child, c.parent, c.rescan)
+}
+
+func (c *qgroupRemove) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQgroupRemove), Context: c.context(), Err: err}
+}
+
+func (c *qgroupRemove) validate() error {
+	return validateRelation(c.path, c.child, c.parent)
+}
+
+func (c *qgroupRemove) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlRemoveExecute(c *qgroupRemove) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return relation(c.path, c.child, c.parent, false, c.rescan)
+}
+
+// btrfs cli executor
+func cliRemoveExecute(c *qgroupRemove) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlRemove() interface{} {
+	return &qgroupRemove{executor: ioctlRemoveExecute}
+}
+
+func cliRemove() interface{} {
+	return &qgroupRemove{executor: cliRemoveExecute}
+}
@@ -0,0 +1,258 @@
+package qgroup
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+// the top level subvolume has no path in the subvolume listing
+const (
+	fsTreeObjectId = 5
+	fsTreePath     = "<FS_TREE>"
+)
+
+type showEntry struct {
+	id   uint64
+	info btrfs.QgroupInfo
+}
+
+// sortKeys compare two qgroups by the sort key
+var sortKeys = map[string]func(a, b *showEntry) int{
+	"qgroupid": func(a, b *showEntry) int { return compare(a.id, b.id) },
+	"rfer":     func(a, b *showEntry) int { return compare(a.info.Referenced, b.info.Referenced) },
+	"excl":     func(a, b *showEntry) int { return compare(a.info.Exclusive, b.info.Exclusive) },
+	"max_rfer": func(a, b *showEntry) int { return compare(a.info.MaxReferenced, b.info.MaxReferenced) },
+	"max_excl": func(a, b *showEntry) int { return compare(a.info.MaxExclusive, b.info.MaxExclusive) },
+	"path":     func(a, b *showEntry) int { return strings.Compare(a.info.Path, b.info.Path) },
+}
+
+func compare(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+type sortKey struct {
+	cmp  func(a, b *showEntry) int
+	desc bool
+}
+
+func parseSort(order string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, key := range strings.Split(order, ",") {
+		desc := false
+		if strings.HasPrefix(key, "-") {
+			desc, key = true, key[1:]
+		} else if strings.HasPrefix(key, "+") {
+			key = key[1:]
+		}
+
+		cmp, ok := sortKeys[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort key '%s'", key)
+		}
+		keys = append(keys, sortKey{cmp, desc})
+	}
+	return keys, nil
+}
+
+type qgroupShow struct {
+	path     string
+	level    int
+	filtPath bool
+	order    string
+
+	executor func(c *qgroupShow) ([]btrfs.QgroupInfo, error)
+}
+
+func (c *qgroupShow) Path(path string) btrfs.QgroupShow {
+	c.path = path
+	return c
+}
+
+func (c *qgroupShow) FilterLevel(level uint16) btrfs.QgroupShow {
+	c.level = int(level)
+	return c
+}
+
+func (c *qgroupShow) FilterPath() btrfs.QgroupShow {
+	c.filtPath = true
+	return c
+}
+
+func (c *qgroupShow) Sort(order string) btrfs.QgroupShow {
+	c.order = order
+	return c
+}
+
+func (c *qgroupShow) context() string {
+	return fmt.Sprintf("path='%s', level=%d, filterPath=%v, sort='%s'", c.path, c.level, c.filtPath, c.order)
+}
+
+func (c *qgroupShow) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQgroupShow), Context: c.context(), Err: err}
+}
+
+func (c *qgroupShow) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	if len(c.order) > 0 {
+		if _, err := parseSort(c.order); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *qgroupShow) Execute() ([]btrfs.QgroupInfo, error) {
+	qgroups, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return qgroups, nil
+}
+
+// impacting returns the qgroup of the subvolume at path and all its ancestors
+func impacting(path string, qgroups []ioctl.Qgroup) (map[uint64]bool, error) {
+	rootId, err := ioctl.GetRootId(path)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := map[uint64][]uint64{}
+	for _, q := range qgroups {
+		parents[q.Id] = q.Parents
+	}
+
+	selected := map[uint64]bool{}
+	queue := []uint64{rootId}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if selected[id] {
+			continue
+		}
+		selected[id] = true
+		queue = append(queue, parents[id]...)
+	}
+	return selected, nil
+}
+
+func formatIDs(ids []uint64) []string {
+	var result []string
+	for _, id := range ids {
+		result = append(result, formatID(id))
+	}
+	return result
+}
+
+// btrfs ioctl executor
+func ioctlShowExecute(c *qgroupShow) ([]btrfs.QgroupInfo, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	qgroups, err := ioctl.GetQgroups(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the path can be any directory, GetQgroups accepts it as well
+	subvols, err := ioctl.SubvolListAll(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[uint64]string{fsTreeObjectId: fsTreePath}
+	for _, subvol := range subvols {
+		paths[subvol.Id] = subvol.Path
+	}
+
+	var selected map[uint64]bool
+	if c.filtPath {
+		if selected, err = impacting(c.path, qgroups); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []showEntry
+	for _, q := range qgroups {
+		if c.level >= 0 && level(q.Id) != uint64(c.level) {
+			continue
+		}
+		if selected != nil && !selected[q.Id] {
+			continue
+		}
+
+		info := btrfs.QgroupInfo{
+			ID:                   formatID(q.Id),
+			Level:                uint16(level(q.Id)),
+			Referenced:           q.Rfer,
+			ReferencedCompressed: q.RferCmpr,
+			Exclusive:            q.Excl,
+			ExclusiveCompressed:  q.ExclCmpr,
+			Parents:              formatIDs(q.Parents),
+			Children:             formatIDs(q.Children),
+		}
+
+		if level(q.Id) == 0 {
+			info.Path = paths[q.Id]
+		}
+		if q.LimitFlags&ioctl.QgroupLimitMaxRfer != 0 {
+			info.MaxReferenced = q.MaxRfer
+		}
+		if q.LimitFlags&ioctl.QgroupLimitMaxExcl != 0 {
+			info.MaxExclusive = q.MaxExcl
+		}
+
+		entries = append(entries, showEntry{q.Id, info})
+	}
+
+	if len(c.order) > 0 {
+		keys, _ := parseSort(c.order)
+		sort.SliceStable(entries, func(i, j int) bool {
+			for _, key := range keys {
+				r := key.cmp(&entries[i], &entries[j])
+				if key.desc {
+					r = -r
+				}
+				if r != 0 {
+					return r < 0
+				}
+			}
+			return false
+		})
+	}
+
+	result := make([]btrfs.QgroupInfo, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.info)
+	}
+	return result, nil
+}
+
+// btrfs cli executor
+func cliShowExecute(c *qgroupShow) ([]btrfs.QgroupInfo, error) {
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlShow() interface{} {
+	return &qgroupShow{level: -1, executor: ioctlShowExecute}
+}
+
+func cliShow() interface{} {
+	return &qgroupShow{level: -1, executor: cliShowExecute}
+}
@@ -0,0 +1,72 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type quotaDisable struct {
+	path string
+
+	executor func(c *quotaDisable) error
+}
+
+func (c *quotaDisable) Path(path string) btrfs.QuotaDisable {
+	c.path = path
+	return c
+}
+
+func (c *quotaDisable) context() string {
+	return fmt.Sprintf("path='%s'", c.path)
+}
+
+func (c *quotaDisable) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQuotaDisable), Context: c.context(), Err: err}
+}
+
+func (c *quotaDisable) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *quotaDisable) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlDisableExecute(c *quotaDisable) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return ioctl.QuotaDisable(c.path)
+}
+
+// btrfs cli executor
+func cliDisableExecute(c *quotaDisable) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlDisable() interface{} {
+	return &quotaDisable{executor: ioctlDisableExecute}
+}
+
+func cliDisable() interface{} {
+	return &quotaDisable{executor: cliDisableExecute}
+}
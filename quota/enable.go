@@ -0,0 +1,78 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type quotaEnable struct {
+	path   string
+	simple bool
+
+	executor func(c *quotaEnable) error
+}
+
+func (c *quotaEnable) Path(path string) btrfs.QuotaEnable {
+	c.path = path
+	return c
+}
+
+func (c *quotaEnable) Simple() btrfs.QuotaEnable {
+	c.simple = true
+	return c
+}
+
+func (c *quotaEnable) context() string {
+	return fmt.Sprintf("path='%s', simple=%v", c.path, c.simple)
+}
+
+func (c *quotaEnable) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQuotaEnable), Context: c.context(), Err: err}
+}
+
+func (c *quotaEnable) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *quotaEnable) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlEnableExecute(c *quotaEnable) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return ioctl.QuotaEnable(c.path, c.simple)
+}
+
+// btrfs cli executor
+func cliEnableExecute(c *quotaEnable) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlEnable() interface{} {
+	return &quotaEnable{executor: ioctlEnableExecute}
+}
+
+func cliEnable() interface{} {
+	return &quotaEnable{executor: cliEnableExecute}
+}
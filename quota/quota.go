@@ -0,0 +1,36 @@
+package quota
+
+import (
+	"context"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQuotaEnable, ioctlEnable)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQuotaDisable, ioctlDisable)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQuotaRescan, ioctlRescan)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdQuotaRescanStatus, ioctlRescanStatus)
+
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQuotaEnable, cliEnable)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQuotaDisable, cliDisable)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQuotaRescan, cliRescan)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdQuotaRescanStatus, cliRescanStatus)
+}
+
+// waitRescan waits for the rescan in a goroutine, the ioctl can't be interrupted
+// so it keeps waiting aside when the context is done first
+func waitRescan(ctx context.Context, path string) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- ioctl.QuotaRescanWait(path)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
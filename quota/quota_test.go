@@ -0,0 +1,100 @@
+package quota
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func TestQuotaValidation(t *testing.T) {
+	quota := btrfs.NewIoctl().Quota()
+
+	err := quota.Enable().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = quota.Disable().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = quota.Rescan().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = quota.RescanStatus().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = quota.RescanStatus().Wait(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	// the cli api runs no ioctl while waiting
+	cli := btrfs.NewCli().Quota()
+	err = cli.RescanStatus().Path(mount).Wait(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unimplemented")
+
+	err = cli.Rescan().Path(mount).Wait(context.Background()).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unimplemented")
+}
+
+func TestQuota(t *testing.T) {
+	quota := btrfs.NewIoctl().Quota()
+
+	// rescan requires enabled quota
+	err := quota.Rescan().Path(mount).Execute()
+	assert.Error(t, err)
+
+	err = quota.Enable().Path(mount).Execute()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// enabling starts a rescan on its own
+	err = quota.RescanStatus().Path(mount).Wait(ctx)
+	assert.NoError(t, err)
+
+	err = quota.Rescan().Path(mount).Wait(ctx).Execute()
+	assert.NoError(t, err)
+
+	progress, err := quota.RescanStatus().Path(mount).Execute()
+	assert.NoError(t, err)
+	assert.False(t, progress.Running)
+
+	err = quota.Disable().Path(mount).Execute()
+	assert.NoError(t, err)
+}
+
+func TestQuotaSimple(t *testing.T) {
+	quota := btrfs.NewIoctl().Quota()
+
+	err := quota.Enable().Path(mount).Simple().Execute()
+	if err != nil && strings.Contains(err.Error(), "not supported") {
+		t.Skip("simple quota requires kernel 6.7")
+	}
+	assert.NoError(t, err)
+
+	err = quota.Disable().Path(mount).Execute()
+	assert.NoError(t, err)
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,84 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type quotaRescan struct {
+	path string
+	ctx  context.Context
+
+	executor func(c *quotaRescan) error
+}
+
+func (c *quotaRescan) Path(path string) btrfs.QuotaRescan {
+	c.path = path
+	return c
+}
+
+func (c *quotaRescan) Wait(ctx context.Context) btrfs.QuotaRescan {
+	c.ctx = ctx
+	return c
+}
+
+func (c *quotaRescan) context() string {
+	return fmt.Sprintf("path='%s', wait=%v", c.path, c.ctx != nil)
+}
+
+func (c *quotaRescan) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQuotaRescan), Context: c.context(), Err: err}
+}
+
+func (c *quotaRescan) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *quotaRescan) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlRescanExecute(c *quotaRescan) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	err = ioctl.QuotaRescan(c.path)
+	if err != nil || c.ctx == nil {
+		return err
+	}
+
+	return waitRescan(c.ctx, c.path)
+}
+
+// btrfs cli executor
+func cliRescanExecute(c *quotaRescan) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlRescan() interface{} {
+	return &quotaRescan{executor: ioctlRescanExecute}
+}
+
+func cliRescan() interface{} {
+	return &quotaRescan{executor: cliRescanExecute}
+}
@@ -0,0 +1,105 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type quotaRescanStatus struct {
+	path string
+
+	executor func(c *quotaRescanStatus) (*btrfs.QuotaRescanProgress, error)
+	waiter   func(c *quotaRescanStatus, ctx context.Context) error
+}
+
+func (c *quotaRescanStatus) Path(path string) btrfs.QuotaRescanStatus {
+	c.path = path
+	return c
+}
+
+func (c *quotaRescanStatus) context() string {
+	return fmt.Sprintf("path='%s'", c.path)
+}
+
+func (c *quotaRescanStatus) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdQuotaRescanStatus), Context: c.context(), Err: err}
+}
+
+func (c *quotaRescanStatus) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *quotaRescanStatus) Execute() (*btrfs.QuotaRescanProgress, error) {
+	progress, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return progress, nil
+}
+
+func (c *quotaRescanStatus) Wait(ctx context.Context) error {
+	err := c.waiter(c, ctx)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlRescanStatusExecute(c *quotaRescanStatus) (*btrfs.QuotaRescanProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := ioctl.GetQuotaRescanStatus(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &btrfs.QuotaRescanProgress{Running: status.Running, Progress: status.Progress}, nil
+}
+
+func ioctlRescanStatusWait(c *quotaRescanStatus, ctx context.Context) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return waitRescan(ctx, c.path)
+}
+
+// btrfs cli executor
+func cliRescanStatusExecute(c *quotaRescanStatus) (*btrfs.QuotaRescanProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+func cliRescanStatusWait(c *quotaRescanStatus, ctx context.Context) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlRescanStatus() interface{} {
+	return &quotaRescanStatus{executor: ioctlRescanStatusExecute, waiter: ioctlRescanStatusWait}
+}
+
+func cliRescanStatus() interface{} {
+	return &quotaRescanStatus{executor: cliRescanStatusExecute, waiter: cliRescanStatusWait}
+}
@@ -0,0 +1,101 @@
+package receive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/plar/btrfs"
+)
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdReceive, ioctlReceive)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdReceive, cliReceive)
+}
+
+type receive struct {
+	dest   string
+	reader io.Reader
+
+	executor func(c *receive) ([]string, error)
+}
+
+func (c *receive) Destination(dir string) btrfs.Receive {
+	c.dest = dir
+	return c
+}
+
+func (c *receive) Reader(r io.Reader) btrfs.Receive {
+	c.reader = r
+	return c
+}
+
+func (c *receive) context() string {
+	return fmt.Sprintf("dest='%s'", c.dest)
+}
+
+func (c *receive) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdReceive), Context: c.context(), Err: err}
+}
+
+func (c *receive) validate() error {
+	if len(c.dest) == 0 {
+		return errors.New("destination is empty")
+	}
+
+	if c.reader == nil {
+		return errors.New("reader is not set")
+	}
+
+	fi, err := os.Stat(c.dest)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", c.dest)
+	}
+
+	return nil
+}
+
+func (c *receive) Execute() ([]string, error) {
+	paths, err := c.executor(c)
+	if err != nil {
+		return paths, c.error(err)
+	}
+	return paths, nil
+}
+
+// btrfs ioctl executor
+func ioctlReceiveExecute(c *receive) ([]string, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newReceiver(c.dest)
+	if err != nil {
+		return nil, err
+	}
+	return r.receive(c.reader)
+}
+
+// btrfs cli executor
+func cliReceiveExecute(c *receive) ([]string, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlReceive() interface{} {
+	return &receive{executor: ioctlReceiveExecute}
+}
+
+func cliReceive() interface{} {
+	return &receive{executor: cliReceiveExecute}
+}
@@ -0,0 +1,284 @@
+package receive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	"github.com/plar/btrfs/ioctl"
+	_ "github.com/plar/btrfs/property"
+	_ "github.com/plar/btrfs/send"
+	"github.com/plar/btrfs/sendstream"
+	_ "github.com/plar/btrfs/subvolume"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func snapshot(t *testing.T, src, name string) string {
+	dest := filepath.Join(mount, name)
+	err := btrfs.NewIoctl().Subvolume().Snapshot().ReadOnly().Source(src).Destination(dest).Execute()
+	assert.NoError(t, err)
+	return dest
+}
+
+func subvolInfo(t *testing.T, path string) btrfs.SubvolInfo {
+	rel, err := filepath.Rel(mount, path)
+	assert.NoError(t, err)
+
+	subvols, err := btrfs.NewIoctl().Subvolume().List().Path(mount).Execute()
+	assert.NoError(t, err)
+	for _, s := range subvols {
+		if s.Path == rel {
+			return s
+		}
+	}
+	t.Fatalf("subvolume '%s' not found", rel)
+	return btrfs.SubvolInfo{}
+}
+
+func clone(t *testing.T, src, dest string) {
+	s, err := os.Open(src)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	d, err := os.Create(dest)
+	assert.NoError(t, err)
+	defer d.Close()
+
+	assert.NoError(t, ioctl.CloneRange(s.Fd(), 0, 0, d.Fd(), 0))
+}
+
+func assertFile(t *testing.T, path string, content []byte) {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, data), "content of '%s'", path)
+}
+
+func TestJoin(t *testing.T) {
+	p, err := join("/mnt/subvol", "dir/file")
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/subvol/dir/file", p)
+
+	p, err = join("/mnt/subvol", "dir/../file")
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/subvol/file", p)
+
+	_, err = join("/mnt/subvol", "../file")
+	assert.EqualError(t, err, "path '../file' is outside of '/mnt/subvol'")
+
+	_, err = join("/mnt/subvol", "/etc/passwd")
+	assert.Error(t, err)
+
+	assert.Error(t, subvolName("a/b"))
+	assert.Error(t, subvolName(".."))
+	assert.NoError(t, subvolName("snap"))
+}
+
+func TestReceiveValidation(t *testing.T) {
+	err := func() error {
+		_, err := btrfs.NewIoctl().Receive().Reader(&bytes.Buffer{}).Execute()
+		return err
+	}()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "destination is empty")
+
+	_, err = btrfs.NewIoctl().Receive().Destination(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "reader is not set")
+
+	_, err = btrfs.NewIoctl().Receive().Destination(mount).Reader(strings.NewReader("not a stream")).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "stream header")
+}
+
+func TestReceive(t *testing.T) {
+	src := filepath.Join(mount, "recv-src")
+	err := btrfs.NewIoctl().Subvolume().Create().Destination(src).Execute()
+	assert.NoError(t, err)
+
+	data := bytes.Repeat([]byte("receive"), 64*1024)
+	assert.NoError(t, os.Mkdir(filepath.Join(src, "dir"), 0750))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), data, 0640))
+	assert.NoError(t, os.Symlink("dir/file", filepath.Join(src, "symlink")))
+	assert.NoError(t, os.Link(filepath.Join(src, "dir", "file"), filepath.Join(src, "hardlink")))
+	assert.NoError(t, syscall.Setxattr(filepath.Join(src, "dir", "file"), "user.backup", []byte("yes"), 0))
+	snap1 := snapshot(t, src, "recv-snap1")
+
+	dest := filepath.Join(mount, "received")
+	assert.NoError(t, os.Mkdir(dest, 0700))
+
+	var stream bytes.Buffer
+	err = btrfs.NewIoctl().Send().Subvolume(snap1).Writer(&stream).Execute()
+	assert.NoError(t, err)
+
+	paths, err := btrfs.NewIoctl().Receive().Destination(dest).Reader(&stream).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dest, "recv-snap1")}, paths)
+
+	received := filepath.Join(dest, "recv-snap1")
+	assertFile(t, filepath.Join(received, "dir", "file"), data)
+	assertFile(t, filepath.Join(received, "hardlink"), data)
+
+	link, err := os.Readlink(filepath.Join(received, "symlink"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dir/file", link)
+
+	fi, err := os.Stat(filepath.Join(received, "dir"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), fi.Mode().Perm())
+
+	xattr := make([]byte, 16)
+	n, err := syscall.Getxattr(filepath.Join(received, "dir", "file"), "user.backup", xattr)
+	assert.NoError(t, err)
+	assert.Equal(t, "yes", string(xattr[:n]))
+
+	info := subvolInfo(t, received)
+	assert.True(t, info.IsReadOnly)
+	assert.Equal(t, subvolInfo(t, snap1).UUID, info.ReceivedUUID)
+
+	// incremental stream with a clone of the file and a removed file
+	clone(t, filepath.Join(src, "dir", "file"), filepath.Join(src, "cloned"))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "new"), []byte("incremental"), 0600))
+	assert.NoError(t, os.Remove(filepath.Join(src, "hardlink")))
+	snap2 := snapshot(t, src, "recv-snap2")
+
+	stream.Reset()
+	err = btrfs.NewIoctl().Send().Subvolume(snap2).Parent(snap1).Writer(&stream).Execute()
+	assert.NoError(t, err)
+
+	paths, err = btrfs.NewIoctl().Receive().Destination(dest).Reader(&stream).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dest, "recv-snap2")}, paths)
+
+	received = filepath.Join(dest, "recv-snap2")
+	assertFile(t, filepath.Join(received, "dir", "file"), data)
+	assertFile(t, filepath.Join(received, "cloned"), data)
+	assertFile(t, filepath.Join(received, "new"), []byte("incremental"))
+	_, err = os.Lstat(filepath.Join(received, "hardlink"))
+	assert.True(t, os.IsNotExist(err))
+
+	info = subvolInfo(t, received)
+	assert.True(t, info.IsReadOnly)
+	assert.Equal(t, subvolInfo(t, snap2).UUID, info.ReceivedUUID)
+
+	// the parent was made writable after the send
+	other := filepath.Join(mount, "received-other")
+	assert.NoError(t, os.Mkdir(other, 0700))
+	stream.Reset()
+	err = btrfs.NewIoctl().Send().Subvolume(snap2).Parent(snap1).Writer(&stream).Execute()
+	assert.NoError(t, err)
+	assert.NoError(t, btrfs.NewIoctl().Subvolume().Delete().Destination(filepath.Join(dest, "recv-snap1")).Execute())
+	sent := stream.Bytes()
+
+	assert.NoError(t, btrfs.NewIoctl().Property().Set().Object(snap1).Name("ro").Value("false").Execute())
+	_, err = btrfs.NewIoctl().Receive().Destination(other).Reader(bytes.NewReader(sent)).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not read only")
+
+	// and changed
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(snap1, "changed"), []byte("changed"), 0600))
+	assert.NoError(t, btrfs.NewIoctl().Property().Set().Object(snap1).Name("ro").Value("true").Execute())
+	_, err = btrfs.NewIoctl().Receive().Destination(other).Reader(bytes.NewReader(sent)).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "has changed")
+
+	// neither the parent nor its received copy exist anymore
+	assert.NoError(t, btrfs.NewIoctl().Subvolume().Delete().Destination(snap1).Execute())
+
+	_, err = btrfs.NewIoctl().Receive().Destination(other).Reader(bytes.NewReader(sent)).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot find the parent subvolume")
+}
+
+func TestReceiveWritableReceivedParent(t *testing.T) {
+	src := filepath.Join(mount, "flip-src")
+	err := btrfs.NewIoctl().Subvolume().Create().Destination(src).Execute()
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("first"), 0600))
+	snap1 := snapshot(t, src, "flip-snap1")
+
+	dest := filepath.Join(mount, "flip-received")
+	assert.NoError(t, os.Mkdir(dest, 0700))
+	var stream bytes.Buffer
+	assert.NoError(t, btrfs.NewIoctl().Send().Subvolume(snap1).Writer(&stream).Execute())
+	_, err = btrfs.NewIoctl().Receive().Destination(dest).Reader(&stream).Execute()
+	assert.NoError(t, err)
+	received := filepath.Join(dest, "flip-snap1")
+
+	// the received copy isn't made writable silently
+	prop := btrfs.NewIoctl().Property()
+	err = prop.Set().Object(received).Name("ro").Value("false").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "requires force")
+	assert.True(t, subvolInfo(t, received).IsReadOnly)
+
+	// forced, it loses the received uuid and can't be the parent after a change
+	assert.NoError(t, prop.Set().Object(received).Name("ro").Value("false").Force().Execute())
+	assert.Equal(t, uuid.Nil, subvolInfo(t, received).ReceivedUUID)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(received, "file"), []byte("changed"), 0600))
+	assert.NoError(t, prop.Set().Object(received).Name("ro").Value("true").Execute())
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "new"), []byte("second"), 0600))
+	snap2 := snapshot(t, src, "flip-snap2")
+	stream.Reset()
+	assert.NoError(t, btrfs.NewIoctl().Send().Subvolume(snap2).Parent(snap1).Writer(&stream).Execute())
+	assert.NoError(t, btrfs.NewIoctl().Subvolume().Delete().Destination(snap1).Execute())
+
+	_, err = btrfs.NewIoctl().Receive().Destination(dest).Reader(&stream).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot find the parent subvolume")
+	_, err = os.Stat(filepath.Join(dest, "flip-snap2"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReceiveSymlinkOutside(t *testing.T) {
+	outside := filepath.Join(mount, "outside")
+	assert.NoError(t, os.Mkdir(outside, 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outside, "passwd"), []byte("root"), 0600))
+
+	root := filepath.Join(mount, "escape")
+	assert.NoError(t, os.Mkdir(root, 0700))
+	r := &receiver{dest: mount, current: &subvol{path: root}}
+	defer r.closeFile()
+
+	// the commands must not follow the symlink of the stream out of the subvolume
+	assert.NoError(t, r.apply(&sendstream.Symlink{Path: "link", PathLink: outside}))
+	for _, cmd := range []sendstream.Command{
+		&sendstream.Mkfile{Path: "link/new"},
+		&sendstream.Write{Path: "link/passwd", Data: []byte("evil")},
+		&sendstream.Truncate{Path: "link/passwd"},
+		&sendstream.Chmod{Path: "link/passwd", Mode: 0777},
+		&sendstream.Rename{Path: "link/passwd", PathTo: "stolen"},
+		&sendstream.Chmod{Path: "link", Mode: 0777},
+		&sendstream.Write{Path: "link", Data: []byte("evil")},
+	} {
+		assert.Error(t, r.apply(cmd), "%T", cmd)
+	}
+
+	assertFile(t, filepath.Join(outside, "passwd"), []byte("root"))
+	_, err := os.Lstat(filepath.Join(outside, "new"))
+	assert.True(t, os.IsNotExist(err))
+	for p, mode := range map[string]os.FileMode{outside: 0700, filepath.Join(outside, "passwd"): 0600} {
+		fi, err := os.Stat(p)
+		assert.NoError(t, err)
+		assert.Equal(t, mode, fi.Mode().Perm())
+	}
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,452 @@
+package receive
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/plar/btrfs/internal/mountinfo"
+	"github.com/plar/btrfs/ioctl"
+	"github.com/plar/btrfs/sendstream"
+	"github.com/satori/go.uuid"
+)
+
+// subvol is the subvolume being received
+type subvol struct {
+	path     string
+	uuid     uuid.UUID
+	ctransid uint64
+}
+
+type receiver struct {
+	dest string
+	// mount is the btrfs mount containing the destination
+	mount *mountinfo.Mount
+
+	current  *subvol
+	received []string
+
+	// file is kept open for consecutive writes to the same path
+	file     *os.File
+	filePath string
+}
+
+func newReceiver(dest string) (*receiver, error) {
+	mount, err := mountinfo.FindBtrfs(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &receiver{dest: dest, mount: mount}, nil
+}
+
+// receive applies the commands of the stream and returns the paths of the received subvolumes
+func (r *receiver) receive(stream io.Reader) ([]string, error) {
+	defer r.closeFile()
+
+	d := sendstream.NewDecoder(stream)
+	for {
+		cmd, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return r.received, err
+		}
+
+		if err := r.apply(cmd); err != nil {
+			return r.received, fmt.Errorf("%s: %v", cmd.Cmd(), err)
+		}
+	}
+
+	// btrfs send streams may omit the end command
+	if r.current != nil {
+		if err := r.finish(); err != nil {
+			return r.received, err
+		}
+	}
+
+	if len(r.received) == 0 {
+		return nil, fmt.Errorf("the stream has no subvolume")
+	}
+	return r.received, nil
+}
+
+// join returns the absolute path of a path of the stream, it must not leave root lexically,
+// resolve also refuses the symlinks on the way
+func join(root, p string) (string, error) {
+	clean := filepath.Clean(p)
+	if filepath.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("path '%s' is outside of '%s'", p, root)
+	}
+	return filepath.Join(root, clean), nil
+}
+
+// entry resolves a path of the stream inside of the received subvolume
+func (r *receiver) entry(p string) (*entry, error) {
+	if r.current == nil {
+		return nil, fmt.Errorf("no subvolume to apply '%s' to", p)
+	}
+	return resolve(r.current.path, p)
+}
+
+// subvolName validates the name of a new subvolume
+func subvolName(name string) error {
+	if len(name) == 0 || strings.Contains(name, "/") || name == "." || name == ".." {
+		return fmt.Errorf("invalid subvolume name '%s'", name)
+	}
+	return nil
+}
+
+// lookup finds the subvolume with the uuid, received from it or created with it, whose
+// transid is the one the stream expects. The subvolume is nil if it is the one being received.
+func (r *receiver) lookup(id uuid.UUID, transid uint64) (string, *ioctl.SubvolSearchResult, error) {
+	if r.current != nil && uuid.Equal(r.current.uuid, id) {
+		return r.current.path, nil, nil
+	}
+
+	subvols, err := ioctl.SubvolList(r.mount.Point)
+	if err != nil {
+		return "", nil, err
+	}
+
+	found, inaccessible := false, false
+	for _, keyType := range []uint8{ioctl.UUIDKeyReceivedSubvol, ioctl.UUIDKeySubvol} {
+		roots, err := ioctl.UUIDTreeLookup(r.mount.Point, id.Bytes(), keyType)
+		if err != nil {
+			return "", nil, err
+		}
+
+		for _, root := range roots {
+			for i := range subvols {
+				s := &subvols[i]
+				if s.Id != root {
+					continue
+				}
+				found = true
+
+				// a received subvolume is matched by the transid of the sent one
+				t := s.CTransid
+				if keyType == ioctl.UUIDKeyReceivedSubvol {
+					t = s.STransid
+				}
+				if t != transid {
+					continue
+				}
+
+				// another match may be below the mount point
+				if p, ok := r.mount.SubvolPath(s.Path); ok {
+					return p, s, nil
+				}
+				inaccessible = true
+			}
+		}
+	}
+	if inaccessible {
+		return "", nil, fmt.Errorf("subvolume with uuid %s is not accessible from '%s'", id, r.mount.Point)
+	}
+	if found {
+		return "", nil, fmt.Errorf("subvolume with uuid %s has changed, transid %d not found", id, transid)
+	}
+	return "", nil, fmt.Errorf("subvolume with uuid %s not found", id)
+}
+
+func (r *receiver) begin(name string, id uuid.UUID, ctransid uint64) error {
+	if r.current != nil {
+		return fmt.Errorf("subvolume '%s' is not finished", r.current.path)
+	}
+	r.current = &subvol{path: filepath.Join(r.dest, name), uuid: id, ctransid: ctransid}
+	return nil
+}
+
+// finish marks the subvolume as received and read only
+func (r *receiver) finish() error {
+	r.closeFile()
+
+	s := r.current
+	r.current = nil
+
+	if err := ioctl.SetReceivedSubvol(s.path, s.uuid.Bytes(), s.ctransid); err != nil {
+		return err
+	}
+
+	flags, err := ioctl.SubvolGetFlags(s.path)
+	if err != nil {
+		return err
+	}
+	if err := ioctl.SubvolSetFlags(s.path, flags|ioctl.SubvolFlagReadOnly); err != nil {
+		return err
+	}
+
+	r.received = append(r.received, s.path)
+	return nil
+}
+
+// openFile opens the file at the path of the stream for writing
+func (r *receiver) openFile(path string) (*os.File, error) {
+	if r.file != nil && r.filePath == path {
+		return r.file, nil
+	}
+	r.closeFile()
+
+	e, err := r.entry(path)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+
+	f, err := e.open(syscall.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	r.file, r.filePath = f, path
+	return f, nil
+}
+
+func (r *receiver) closeFile() {
+	if r.file != nil {
+		r.file.Close()
+		r.file, r.filePath = nil, ""
+	}
+}
+
+func (r *receiver) apply(cmd sendstream.Command) error {
+	switch cmd.(type) {
+	case *sendstream.Write, *sendstream.Clone, *sendstream.EncodedWrite, *sendstream.UpdateExtent:
+		// the data commands reuse the open file
+	default:
+		r.closeFile()
+	}
+
+	switch c := cmd.(type) {
+	case *sendstream.Subvol:
+		if err := subvolName(c.Path); err != nil {
+			return err
+		}
+		if err := ioctl.SubvolCreate(r.dest, c.Path); err != nil {
+			return err
+		}
+		return r.begin(c.Path, c.UUID, c.CTransid)
+
+	case *sendstream.Snapshot:
+		if err := subvolName(c.Path); err != nil {
+			return err
+		}
+		parent, info, err := r.lookup(c.CloneUUID, c.CloneCTransid)
+		if err != nil {
+			return fmt.Errorf("cannot find the parent subvolume: %v", err)
+		}
+		if info == nil || !info.IsReadOnly() {
+			return fmt.Errorf("parent subvolume '%s' is not read only", parent)
+		}
+		if err := ioctl.SubvolSnapshot(false, parent, r.dest, c.Path); err != nil {
+			return err
+		}
+		return r.begin(c.Path, c.UUID, c.CTransid)
+
+	case *sendstream.End:
+		if r.current == nil {
+			return nil
+		}
+		return r.finish()
+
+	case *sendstream.Mkfile:
+		return r.do(c.Path, func(e *entry) error {
+			f, err := e.open(syscall.O_CREAT|syscall.O_EXCL|syscall.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			return f.Close()
+		})
+
+	case *sendstream.Mkdir:
+		return r.do(c.Path, func(e *entry) error {
+			return e.wrap(syscall.Mkdirat(e.dir, e.name, 0700))
+		})
+
+	case *sendstream.Mknod:
+		return r.do(c.Path, func(e *entry) error {
+			return e.wrap(syscall.Mknodat(e.dir, e.name, uint32(c.Mode), int(c.Rdev)))
+		})
+
+	case *sendstream.Mkfifo:
+		return r.do(c.Path, func(e *entry) error {
+			return e.wrap(syscall.Mknodat(e.dir, e.name, syscall.S_IFIFO|0600, 0))
+		})
+
+	case *sendstream.Mksock:
+		return r.do(c.Path, func(e *entry) error {
+			return e.wrap(syscall.Mknodat(e.dir, e.name, syscall.S_IFSOCK|0600, 0))
+		})
+
+	case *sendstream.Symlink:
+		return r.do(c.Path, func(e *entry) error {
+			return symlinkat(c.PathLink, e)
+		})
+
+	case *sendstream.Rename:
+		return r.do2(c.Path, c.PathTo, func(from, to *entry) error {
+			return from.wrap(syscall.Renameat(from.dir, from.name, to.dir, to.name))
+		})
+
+	case *sendstream.Link:
+		// the new link is path, pointing to the existing path_link
+		return r.do2(c.PathLink, c.Path, linkat)
+
+	case *sendstream.Unlink:
+		return r.do(c.Path, func(e *entry) error {
+			return unlinkat(e, 0)
+		})
+
+	case *sendstream.Rmdir:
+		return r.do(c.Path, func(e *entry) error {
+			return unlinkat(e, atRemovedir)
+		})
+
+	case *sendstream.SetXattr:
+		return r.do(c.Path, func(e *entry) error {
+			return lsetxattr(e, c.Name, c.Data)
+		})
+
+	case *sendstream.RemoveXattr:
+		return r.do(c.Path, func(e *entry) error {
+			return lremovexattr(e, c.Name)
+		})
+
+	case *sendstream.Write:
+		f, err := r.openFile(c.Path)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteAt(c.Data, int64(c.Offset))
+		return err
+
+	case *sendstream.Clone:
+		return r.clone(c)
+
+	case *sendstream.EncodedWrite:
+		return r.encodedWrite(c)
+
+	case *sendstream.Truncate:
+		return r.do(c.Path, func(e *entry) error {
+			f, err := e.open(syscall.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return f.Truncate(int64(c.Size))
+		})
+
+	case *sendstream.Chmod:
+		return r.do(c.Path, func(e *entry) error {
+			return lchmod(e, uint32(c.Mode)&07777)
+		})
+
+	case *sendstream.Chown:
+		return r.do(c.Path, func(e *entry) error {
+			return e.wrap(syscall.Fchownat(e.dir, e.name, int(c.UID), int(c.GID), atSymlinkNofollow))
+		})
+
+	case *sendstream.Utimes:
+		return r.do(c.Path, func(e *entry) error {
+			return utimensat(e, c.Atime.UnixNano(), c.Mtime.UnixNano())
+		})
+
+	case *sendstream.Fallocate:
+		return r.do(c.Path, func(e *entry) error {
+			f, err := e.open(syscall.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return syscall.Fallocate(int(f.Fd()), c.Mode, int64(c.Offset), int64(c.Size))
+		})
+
+	case *sendstream.UpdateExtent, *sendstream.Fileattr:
+		// no file data streams only tell which extents changed, file attributes are not applied by btrfs receive either
+		return nil
+	}
+
+	return fmt.Errorf("unsupported command")
+}
+
+// do runs op on the resolved path of the stream
+func (r *receiver) do(path string, op func(e *entry) error) error {
+	e, err := r.entry(path)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+	return op(e)
+}
+
+func (r *receiver) do2(path, to string, op func(from, to *entry) error) error {
+	return r.do(path, func(from *entry) error {
+		return r.do(to, func(to *entry) error {
+			return op(from, to)
+		})
+	})
+}
+
+func (r *receiver) clone(c *sendstream.Clone) error {
+	source, _, err := r.lookup(c.CloneUUID, c.CloneCTransid)
+	if err != nil {
+		return fmt.Errorf("cannot find the clone source: %v", err)
+	}
+	e, err := resolve(source, c.ClonePath)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	src, err := e.open(syscall.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	f, err := r.openFile(c.Path)
+	if err != nil {
+		return err
+	}
+	return ioctl.CloneRange(src.Fd(), c.CloneOffset, c.Len, f.Fd(), c.Offset)
+}
+
+// encodedWrite writes the compressed data as is, zlib data is decompressed if the kernel refuses it
+func (r *receiver) encodedWrite(c *sendstream.EncodedWrite) error {
+	f, err := r.openFile(c.Path)
+	if err != nil {
+		return err
+	}
+
+	err = ioctl.EncodedWrite(f.Fd(), c.Data, c.Offset, c.UnencodedFileLen, c.UnencodedLen, c.UnencodedOffset,
+		c.Compression, c.Encryption)
+	if err != ioctl.ErrEncodedWriteUnsupported {
+		return err
+	}
+
+	if c.Compression != ioctl.EncodedCompressionZlib || c.Encryption != 0 {
+		return fmt.Errorf("%v and compression %d can't be decoded", err, c.Compression)
+	}
+	if c.UnencodedOffset+c.UnencodedFileLen > c.UnencodedLen {
+		return fmt.Errorf("invalid unencoded range %d+%d of %d bytes", c.UnencodedOffset, c.UnencodedFileLen, c.UnencodedLen)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(c.Data))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	data := make([]byte, c.UnencodedLen)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return fmt.Errorf("failed to decompress: %v", err)
+	}
+
+	_, err = f.WriteAt(data[c.UnencodedOffset:c.UnencodedOffset+c.UnencodedFileLen], int64(c.Offset))
+	return err
+}
@@ -0,0 +1,216 @@
+package receive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// see fcntl.h, the syscall package has no O_PATH
+const (
+	oPath             = 0x200000
+	atSymlinkNofollow = 0x100
+	atRemovedir       = 0x200
+)
+
+// entry is a path of the stream resolved below the subvolume: the parent directory is opened without
+// following symlinks, so a symlink of the stream can't redirect the commands out of the subvolume.
+// The commands use the *at syscalls on the directory and the name, which is "." for the subvolume itself.
+type entry struct {
+	// dir is an O_PATH descriptor of the parent directory
+	dir  int
+	name string
+	// path is the absolute path for the error messages
+	path string
+}
+
+// resolve opens the parent directory of the stream path p below root, Close releases it
+func resolve(root, p string) (*entry, error) {
+	path, err := join(root, p)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := syscall.Open(root, oPath|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	e := &entry{dir: dir, name: ".", path: path}
+
+	clean := filepath.Clean(p)
+	if clean == "." {
+		return e, nil
+	}
+
+	parts := strings.Split(clean, "/")
+	for _, part := range parts[:len(parts)-1] {
+		// a symlink fails with ENOTDIR
+		next, err := syscall.Openat(e.dir, part, oPath|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+		syscall.Close(e.dir)
+		if err != nil {
+			return nil, e.error(err)
+		}
+		e.dir = next
+	}
+	e.name = parts[len(parts)-1]
+	return e, nil
+}
+
+func (e *entry) Close() error {
+	return syscall.Close(e.dir)
+}
+
+func (e *entry) error(err error) error {
+	return fmt.Errorf("%s: %v", e.path, err)
+}
+
+// wrap adds the path to the error of an *at syscall
+func (e *entry) wrap(err error) error {
+	if err != nil {
+		return e.error(err)
+	}
+	return nil
+}
+
+// open opens the entry itself, the last component isn't followed either
+func (e *entry) open(flags int, perm uint32) (*os.File, error) {
+	fd, err := syscall.Openat(e.dir, e.name, flags|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, perm)
+	if err != nil {
+		return nil, e.error(err)
+	}
+	return os.NewFile(uintptr(fd), e.path), nil
+}
+
+// proc returns a path of the entry which is looked up through the open parent directory,
+// for the syscalls without an *at variant
+func (e *entry) proc() string {
+	return fmt.Sprintf("/proc/self/fd/%d/%s", e.dir, e.name)
+}
+
+// the syscall package lacks the following *at and l*xattr syscalls
+
+func symlinkat(target string, e *entry) error {
+	t, err := syscall.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+	n, err := syscall.BytePtrFromString(e.name)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_SYMLINKAT, uintptr(unsafe.Pointer(t)), uintptr(e.dir), uintptr(unsafe.Pointer(n)))
+	if errno != 0 {
+		return e.error(errno)
+	}
+	return nil
+}
+
+func linkat(from, to *entry) error {
+	f, err := syscall.BytePtrFromString(from.name)
+	if err != nil {
+		return err
+	}
+	t, err := syscall.BytePtrFromString(to.name)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_LINKAT, uintptr(from.dir), uintptr(unsafe.Pointer(f)),
+		uintptr(to.dir), uintptr(unsafe.Pointer(t)), 0, 0)
+	if errno != 0 {
+		return to.error(errno)
+	}
+	return nil
+}
+
+func unlinkat(e *entry, flags int) error {
+	n, err := syscall.BytePtrFromString(e.name)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_UNLINKAT, uintptr(e.dir), uintptr(unsafe.Pointer(n)), uintptr(flags))
+	if errno != 0 {
+		return e.error(errno)
+	}
+	return nil
+}
+
+func utimensat(e *entry, atime, mtime int64) error {
+	n, err := syscall.BytePtrFromString(e.name)
+	if err != nil {
+		return err
+	}
+
+	ts := []syscall.Timespec{syscall.NsecToTimespec(atime), syscall.NsecToTimespec(mtime)}
+	_, _, errno := syscall.Syscall6(syscall.SYS_UTIMENSAT, uintptr(e.dir), uintptr(unsafe.Pointer(n)),
+		uintptr(unsafe.Pointer(&ts[0])), atSymlinkNofollow, 0, 0)
+	if errno != 0 {
+		return e.error(errno)
+	}
+	return nil
+}
+
+// lchmod changes the mode of the entry, symlinks have no mode and fail, see lchmod of glibc
+func lchmod(e *entry, mode uint32) error {
+	f, err := e.open(oPath, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &st); err != nil {
+		return e.error(err)
+	}
+	if st.Mode&syscall.S_IFMT == syscall.S_IFLNK {
+		return e.error(syscall.EOPNOTSUPP)
+	}
+	if err := syscall.Chmod(fmt.Sprintf("/proc/self/fd/%d", f.Fd()), mode); err != nil {
+		return e.error(err)
+	}
+	return nil
+}
+
+func lsetxattr(e *entry, name string, data []byte) error {
+	p, err := syscall.BytePtrFromString(e.proc())
+	if err != nil {
+		return err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	var v unsafe.Pointer
+	if len(data) > 0 {
+		v = unsafe.Pointer(&data[0])
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_LSETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)),
+		uintptr(v), uintptr(len(data)), 0, 0)
+	if errno != 0 {
+		return e.error(errno)
+	}
+	return nil
+}
+
+func lremovexattr(e *entry, name string) error {
+	p, err := syscall.BytePtrFromString(e.proc())
+	if err != nil {
+		return err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_LREMOVEXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)), 0)
+	if errno != 0 {
+		return e.error(errno)
+	}
+	return nil
+}
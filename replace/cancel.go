@@ -0,0 +1,67 @@
+package replace
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type replaceCancel struct {
+	path string
+
+	executor func(c *replaceCancel) error
+}
+
+func (c *replaceCancel) Path(path string) btrfs.ReplaceCancel {
+	c.path = path
+	return c
+}
+
+func (c *replaceCancel) context() string {
+	return fmt.Sprintf("path='%s'", c.path)
+}
+
+func (c *replaceCancel) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdReplaceCancel), Context: c.context(), Err: err}
+}
+
+func (c *replaceCancel) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *replaceCancel) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlCancelExecute(c *replaceCancel) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return ioctl.DevReplaceCancel(c.path)
+}
+
+// btrfs cli executor
+func cliCancelExecute(c *replaceCancel) error {
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlCancel() interface{} {
+	return &replaceCancel{executor: ioctlCancelExecute}
+}
+
+func cliCancel() interface{} {
+	return &replaceCancel{executor: cliCancelExecute}
+}
@@ -0,0 +1,13 @@
+package replace
+
+import "github.com/plar/btrfs"
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdReplaceStart, ioctlStart)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdReplaceStatus, ioctlStatus)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdReplaceCancel, ioctlCancel)
+
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdReplaceStart, cliStart)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdReplaceStatus, cliStatus)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdReplaceCancel, cliCancel)
+}
@@ -0,0 +1,101 @@
+package replace
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func TestReplaceValidation(t *testing.T) {
+	replace := btrfs.NewIoctl().Replace()
+
+	err := replace.Start().Source("1").Target("/dev/loop0").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = replace.Start().Wait()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "replace was not started")
+
+	err = replace.Start().Path(mount).Target("/dev/loop0").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "source device is empty")
+
+	err = replace.Start().Path(mount).Source("1").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "target device is empty")
+
+	err = replace.Start().Path(mount).Source("1").Target(loop.Image).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a block device")
+
+	_, err = replace.Status().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = replace.Cancel().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+}
+
+func TestReplace(t *testing.T) {
+	replace := btrfs.NewIoctl().Replace()
+
+	progress, err := replace.Status().Path(mount).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "never started", progress.State)
+
+	err = replace.Cancel().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "replace not started")
+
+	// replace the original device by id and wait
+	loop1 := loop.NewLoopDevice("replace1.img")
+	err = replace.Start().Path(mount).Source("1").Target(loop1).Execute()
+	assert.NoError(t, err)
+
+	progress, err = replace.Status().Path(mount).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "finished", progress.State)
+	assert.Equal(t, uint64(1000), progress.Progress)
+	assert.False(t, progress.StartTime.IsZero())
+	assert.False(t, progress.StopTime.Before(progress.StartTime))
+	assert.Equal(t, uint64(0), progress.WriteErrs)
+
+	// replace the new device by path in background and watch it
+	loop2 := loop.NewLoopDevice("replace2.img")
+	start := replace.Start().Path(mount).Source(loop1).Target(loop2).AvoidSource().Background()
+	err = start.Execute()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var last btrfs.ReplaceProgress
+	for progress := range replace.Status().Path(mount).Watch(ctx) {
+		assert.NoError(t, progress.Err)
+		last = progress
+	}
+	assert.Equal(t, "finished", last.State)
+	assert.Equal(t, uint64(1000), last.Progress)
+
+	// the result of the background ioctl
+	assert.NoError(t, start.Wait())
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,168 @@
+package replace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/blkdev"
+	"github.com/plar/btrfs/internal/poll"
+	"github.com/plar/btrfs/ioctl"
+)
+
+// how often a background start checks whether the replace is running
+var startPollInterval = 100 * time.Millisecond
+
+type replaceStart struct {
+	path       string
+	src        string
+	tgt        string
+	avoidSrc   bool
+	force      bool
+	background bool
+
+	// task runs the replace ioctl, it is set by Execute
+	task *poll.Task
+
+	executor func(c *replaceStart) error
+}
+
+func (c *replaceStart) Path(path string) btrfs.ReplaceStart {
+	c.path = path
+	return c
+}
+
+func (c *replaceStart) Source(device string) btrfs.ReplaceStart {
+	c.src = device
+	return c
+}
+
+func (c *replaceStart) Target(device string) btrfs.ReplaceStart {
+	c.tgt = device
+	return c
+}
+
+func (c *replaceStart) AvoidSource() btrfs.ReplaceStart {
+	c.avoidSrc = true
+	return c
+}
+
+func (c *replaceStart) Force() btrfs.ReplaceStart {
+	c.force = true
+	return c
+}
+
+func (c *replaceStart) Background() btrfs.ReplaceStart {
+	c.background = true
+	return c
+}
+
+func (c *replaceStart) context() string {
+	return fmt.Sprintf("path='%s', src='%s', tgt='%s', avoidSrc=%v, force=%v, background=%v",
+		c.path, c.src, c.tgt, c.avoidSrc, c.force, c.background)
+}
+
+func (c *replaceStart) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdReplaceStart), Context: c.context(), Err: err}
+}
+
+// srcDevid returns the source device id if the source is given by id
+func (c *replaceStart) srcDevid() uint64 {
+	id, err := strconv.ParseUint(c.src, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+func (c *replaceStart) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	if len(c.src) == 0 {
+		return errors.New("source device is empty")
+	}
+
+	if len(c.tgt) == 0 {
+		return errors.New("target device is empty")
+	}
+
+	if c.srcDevid() == 0 {
+		if _, err := os.Stat(c.src); err != nil {
+			return err
+		}
+	}
+
+	return blkdev.CheckUnused(c.tgt, c.force)
+}
+
+func (c *replaceStart) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+func (c *replaceStart) Wait() error {
+	if c.task == nil {
+		return c.error(errors.New("replace was not started"))
+	}
+
+	err := c.task.Wait()
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlStartExecute(c *replaceStart) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	var srcDev string
+	srcDevid := c.srcDevid()
+	if srcDevid == 0 {
+		srcDev = c.src
+	}
+
+	// the ioctl returns only when the replace is over, a background start runs it aside and
+	// waits until the kernel reports it as started
+	c.task = poll.Go(func() error {
+		return ioctl.DevReplaceStart(c.path, srcDevid, srcDev, c.tgt, c.avoidSrc)
+	})
+
+	if c.background && c.task.WaitStarted(startPollInterval, func() bool {
+		status, err := ioctl.GetDevReplaceStatus(c.path)
+		return err == nil && status.State == ioctl.DevReplaceStateStarted
+	}) {
+		return nil
+	}
+	return c.task.Wait()
+}
+
+// btrfs cli executor
+func cliStartExecute(c *replaceStart) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlStart() interface{} {
+	return &replaceStart{executor: ioctlStartExecute}
+}
+
+func cliStart() interface{} {
+	return &replaceStart{executor: cliStartExecute}
+}
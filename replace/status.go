@@ -0,0 +1,129 @@
+package replace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/poll"
+	"github.com/plar/btrfs/ioctl"
+)
+
+// how often Watch reads the replace status
+var watchInterval = time.Second
+
+var replaceStates = map[uint64]string{
+	ioctl.DevReplaceStateNeverStarted: "never started",
+	ioctl.DevReplaceStateStarted:      "started",
+	ioctl.DevReplaceStateFinished:     "finished",
+	ioctl.DevReplaceStateCanceled:     "canceled",
+	ioctl.DevReplaceStateSuspended:    "suspended",
+}
+
+type replaceStatus struct {
+	path string
+
+	executor func(c *replaceStatus) (*btrfs.ReplaceProgress, error)
+}
+
+func (c *replaceStatus) Path(path string) btrfs.ReplaceStatus {
+	c.path = path
+	return c
+}
+
+func (c *replaceStatus) context() string {
+	return fmt.Sprintf("path='%s'", c.path)
+}
+
+func (c *replaceStatus) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdReplaceStatus), Context: c.context(), Err: err}
+}
+
+func (c *replaceStatus) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *replaceStatus) Execute() (*btrfs.ReplaceProgress, error) {
+	progress, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return progress, nil
+}
+
+func (c *replaceStatus) Watch(ctx context.Context) <-chan btrfs.ReplaceProgress {
+	ch := make(chan btrfs.ReplaceProgress)
+
+	go func() {
+		defer close(ch)
+
+		poll.Watch(ctx, watchInterval, func() bool {
+			progress, err := c.Execute()
+			if err != nil {
+				progress = &btrfs.ReplaceProgress{Err: err}
+			}
+
+			select {
+			case ch <- *progress:
+			case <-ctx.Done():
+				return false
+			}
+			return err == nil && progress.Running()
+		})
+	}()
+
+	return ch
+}
+
+func unixTime(sec uint64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(sec), 0)
+}
+
+// btrfs ioctl executor
+func ioctlStatusExecute(c *replaceStatus) (*btrfs.ReplaceProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := ioctl.GetDevReplaceStatus(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	state, ok := replaceStates[status.State]
+	if !ok {
+		state = fmt.Sprintf("unknown state %d", status.State)
+	}
+
+	return &btrfs.ReplaceProgress{
+		State:                 state,
+		Progress:              status.Progress1000,
+		StartTime:             unixTime(status.TimeStarted),
+		StopTime:              unixTime(status.TimeStopped),
+		WriteErrs:             status.NumWriteErrors,
+		UncorrectableReadErrs: status.NumUncorrectableReadErrors,
+	}, nil
+}
+
+// btrfs cli executor
+func cliStatusExecute(c *replaceStatus) (*btrfs.ReplaceProgress, error) {
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlStatus() interface{} {
+	return &replaceStatus{executor: ioctlStatusExecute}
+}
+
+func cliStatus() interface{} {
+	return &replaceStatus{executor: cliStatusExecute}
+}
@@ -0,0 +1,322 @@
+// Package retention decides which snapshots to delete.
+//
+// A Policy keeps the newest snapshot of the last N hours, days, weeks and months, never deletes
+// pinned snapshots or snapshots younger than the minimum age, caps the number of snapshots and
+// deletes more of the oldest ones while the filesystem is low on free space. Evaluate only looks at
+// the SubvolInfo data, so policies can be checked without a filesystem, Execute deletes the
+// snapshots of the plan.
+package retention
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+	_ "github.com/plar/btrfs/subvolume"
+	"github.com/satori/go.uuid"
+)
+
+type Policy struct {
+	// Hourly, Daily, Weekly and Monthly keep the newest snapshot of that many periods
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+
+	// MinAge keeps all snapshots younger than it
+	MinAge time.Duration
+	// Pinned snapshots are never deleted, they are matched by path or by name
+	Pinned []string
+	// MaxCount limits the number of kept snapshots, the pinned and the young ones are not limited.
+	// Zero means no limit.
+	MaxCount int
+
+	// MinFree and MinFreePercent delete the oldest snapshots while the free space of the
+	// filesystem is below the thresholds, see Space
+	MinFree        uint64
+	MinFreePercent float64
+
+	// Parent limits the policy to the snapshots of the subvolume with the uuid, others are ignored
+	Parent uuid.UUID
+	// Location defines the hours, days, weeks and months, UTC is used if not set
+	Location *time.Location
+}
+
+// Space describes the filesystem for the free space thresholds
+type Space struct {
+	Total uint64
+	Free  uint64
+	// Exclusive is the space freed by deleting a snapshot by subvolume id, from qgroup show.
+	// Snapshots without a size are assumed to free nothing.
+	Exclusive map[uint64]uint64
+}
+
+// reasons to keep or delete a snapshot
+const (
+	ReasonHourly    = "hourly"
+	ReasonDaily     = "daily"
+	ReasonWeekly    = "weekly"
+	ReasonMonthly   = "monthly"
+	ReasonPinned    = "pinned"
+	ReasonMinAge    = "min age"
+	ReasonExpired   = "expired"
+	ReasonMaxCount  = "max count"
+	ReasonFreeSpace = "free space"
+)
+
+// Decision tells why a snapshot is kept or deleted
+type Decision struct {
+	Snapshot btrfs.SubvolInfo
+	Reasons  []string
+}
+
+// Plan lists the kept and the deleted snapshots, the newest first
+type Plan struct {
+	Keep   []Decision
+	Delete []Decision
+}
+
+func (p *Policy) validate() error {
+	for _, n := range []int{p.Hourly, p.Daily, p.Weekly, p.Monthly, p.MaxCount} {
+		if n < 0 {
+			return fmt.Errorf("negative snapshot count %d", n)
+		}
+	}
+	if p.MinAge < 0 {
+		return fmt.Errorf("negative min age %v", p.MinAge)
+	}
+	if p.MinFreePercent < 0 || p.MinFreePercent > 100 {
+		return fmt.Errorf("free space percent %v is out of range 0..100", p.MinFreePercent)
+	}
+	return nil
+}
+
+func (p *Policy) pinned(s btrfs.SubvolInfo) bool {
+	for _, pin := range p.Pinned {
+		if pin == s.Path || pin == filepath.Base(s.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// bucket is a period of a snapshot, e.g. its day
+type bucket struct {
+	reason string
+	count  int
+	key    func(t time.Time) string
+}
+
+func (p *Policy) buckets() []bucket {
+	return []bucket{
+		{ReasonHourly, p.Hourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{ReasonDaily, p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{ReasonWeekly, p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{ReasonMonthly, p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+}
+
+// freeSpaceLow reports whether free is below the thresholds
+func (p *Policy) freeSpaceLow(space *Space, free uint64) bool {
+	if space == nil {
+		return false
+	}
+	if free < p.MinFree {
+		return true
+	}
+	return p.MinFreePercent > 0 && space.Total > 0 && float64(free)*100/float64(space.Total) < p.MinFreePercent
+}
+
+// Evaluate returns the plan for the snapshots at the time now, space is only used for the free space
+// thresholds and can be nil
+func (p *Policy) Evaluate(snapshots []btrfs.SubvolInfo, now time.Time, space *Space) (*Plan, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var candidates []btrfs.SubvolInfo
+	for _, s := range snapshots {
+		if p.Parent != uuid.Nil && !uuid.Equal(s.ParentUUID, p.Parent) {
+			continue
+		}
+		candidates = append(candidates, s)
+	}
+
+	// the newest first, the origin generation orders snapshots of the same second
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if !a.OriginTime.Equal(b.OriginTime) {
+			return a.OriginTime.After(b.OriginTime)
+		}
+		return a.OriginGeneration > b.OriginGeneration
+	})
+
+	reasons := make([][]string, len(candidates))
+	// protected snapshots are kept by the max count and free space rules
+	protected := make([]bool, len(candidates))
+
+	for i, s := range candidates {
+		if p.pinned(s) {
+			reasons[i] = append(reasons[i], ReasonPinned)
+			protected[i] = true
+		}
+		if p.MinAge > 0 && now.Sub(s.OriginTime) < p.MinAge {
+			reasons[i] = append(reasons[i], ReasonMinAge)
+			protected[i] = true
+		}
+	}
+
+	for _, b := range p.buckets() {
+		seen := map[string]bool{}
+		for i, s := range candidates {
+			if len(seen) >= b.count {
+				break
+			}
+			key := b.key(s.OriginTime.In(loc))
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			reasons[i] = append(reasons[i], b.reason)
+		}
+	}
+
+	deleted := make([]string, len(candidates))
+	for i := range candidates {
+		if len(reasons[i]) == 0 {
+			deleted[i] = ReasonExpired
+		}
+	}
+
+	if p.MaxCount > 0 {
+		kept := 0
+		for i := range candidates {
+			if len(deleted[i]) > 0 || protected[i] {
+				continue
+			}
+			kept++
+			if kept > p.MaxCount {
+				deleted[i] = ReasonMaxCount
+			}
+		}
+	}
+
+	if space != nil && p.freeSpaceLow(space, space.Free) {
+		free := space.Free
+		for i := range candidates {
+			if len(deleted[i]) > 0 {
+				free += space.Exclusive[candidates[i].ID]
+			}
+		}
+
+		// delete the oldest snapshots but keep the newest one, it is the parent of the next incremental backup
+		for i := len(candidates) - 1; i > 0 && p.freeSpaceLow(space, free); i-- {
+			if len(deleted[i]) > 0 || protected[i] {
+				continue
+			}
+			deleted[i] = ReasonFreeSpace
+			free += space.Exclusive[candidates[i].ID]
+		}
+	}
+
+	plan := &Plan{}
+	for i, s := range candidates {
+		if len(deleted[i]) > 0 {
+			plan.Delete = append(plan.Delete, Decision{Snapshot: s, Reasons: []string{deleted[i]}})
+		} else {
+			plan.Keep = append(plan.Keep, Decision{Snapshot: s, Reasons: reasons[i]})
+		}
+	}
+	return plan, nil
+}
+
+// Print writes the plan for a dry run, one line per snapshot
+func (p *Plan) Print(w io.Writer) error {
+	print := func(action string, decisions []Decision) error {
+		for _, d := range decisions {
+			_, err := fmt.Fprintf(w, "%-8s%-48s%s  %s\n", action, d.Snapshot.Path,
+				d.Snapshot.OriginTime.Format(time.RFC3339), strings.Join(d.Reasons, ","))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := print("keep", p.Keep); err != nil {
+		return err
+	}
+	return print("delete", p.Delete)
+}
+
+// Execute deletes the snapshots of the plan, it continues after a failure and returns the first error
+func (p *Plan) Execute(api btrfs.API) error {
+	var first error
+	for _, d := range p.Delete {
+		err := api.Subvolume().Delete().Destination(d.Snapshot.Path).Execute()
+		if err != nil && first == nil {
+			first = fmt.Errorf("Failed to delete '%s': %v", d.Snapshot.Path, err)
+		}
+	}
+	return first
+}
+
+// List returns the subvolumes in the directory, their paths are absolute so the plan can be executed
+func List(api btrfs.API, dir string) ([]btrfs.SubvolInfo, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[uint64]string{}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if ok, err := ioctl.TestIsSubvolume(path); err != nil || !ok {
+			continue
+		}
+
+		id, err := ioctl.GetRootId(path)
+		if err != nil {
+			return nil, err
+		}
+		ids[id] = path
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// any subvolume of the filesystem lists all of them
+	var subvol string
+	for _, path := range ids {
+		subvol = path
+		break
+	}
+
+	subvols, err := api.Subvolume().List().Path(subvol).Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []btrfs.SubvolInfo
+	for _, s := range subvols {
+		if path, ok := ids[s.ID]; ok {
+			s.Path = path
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots, nil
+}
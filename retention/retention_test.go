@@ -0,0 +1,194 @@
+package retention
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/satori/go.uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2026, 3, 15, 12, 30, 0, 0, time.UTC)
+
+var source = uuid.FromBytesOrNil(bytes.Repeat([]byte{1}, uuid.Size))
+
+// hourly returns n snapshots taken every hour before now, the newest first
+func hourly(n int) []btrfs.SubvolInfo {
+	var snapshots []btrfs.SubvolInfo
+	for i := 0; i < n; i++ {
+		t := now.Add(-time.Duration(i) * time.Hour).Truncate(time.Hour)
+		snapshots = append(snapshots, btrfs.SubvolInfo{
+			ID:               uint64(1000 - i),
+			Path:             fmt.Sprintf("snapshots/home.%s", t.Format("20060102T1504")),
+			OriginTime:       t,
+			OriginGeneration: uint64(1000 - i),
+			ParentUUID:       source,
+			IsSnapshot:       true,
+			IsReadOnly:       true,
+		})
+	}
+	return snapshots
+}
+
+func paths(decisions []Decision) []string {
+	var result []string
+	for _, d := range decisions {
+		result = append(result, d.Snapshot.Path)
+	}
+	return result
+}
+
+func TestEvaluateBuckets(t *testing.T) {
+	// 10 days of hourly snapshots
+	snapshots := hourly(240)
+
+	policy := &Policy{Hourly: 6, Daily: 7, Weekly: 4, Monthly: 12}
+	plan, err := policy.Evaluate(snapshots, now, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, len(snapshots), len(plan.Keep)+len(plan.Delete))
+
+	// 6 hourly, 6 more days (today is in the hourly ones) and the newest of the previous week,
+	// all snapshots are of March
+	assert.Len(t, plan.Keep, 6+6+1)
+	assert.Equal(t, "snapshots/home.20260315T1200", plan.Keep[0].Snapshot.Path)
+	assert.Equal(t, []string{ReasonHourly, ReasonDaily, ReasonWeekly, ReasonMonthly}, plan.Keep[0].Reasons)
+	assert.Equal(t, []string{ReasonHourly}, plan.Keep[1].Reasons)
+
+	reasons := map[string][]string{}
+	for _, d := range plan.Keep {
+		reasons[d.Snapshot.Path] = d.Reasons
+	}
+	assert.Equal(t, []string{ReasonDaily}, reasons["snapshots/home.20260314T2300"])
+	assert.Equal(t, []string{ReasonDaily}, reasons["snapshots/home.20260309T2300"])
+	// March 8 is a Sunday, the last day of the previous ISO week
+	assert.Equal(t, []string{ReasonWeekly}, reasons["snapshots/home.20260308T2300"])
+
+	for _, d := range plan.Delete {
+		assert.Equal(t, []string{ReasonExpired}, d.Reasons)
+	}
+}
+
+func TestEvaluatePinnedAndMinAge(t *testing.T) {
+	snapshots := hourly(48)
+
+	policy := &Policy{Daily: 1, MinAge: 3 * time.Hour, Pinned: []string{"home.20260313T1300", "snapshots/home.20260314T0000"}}
+	plan, err := policy.Evaluate(snapshots, now, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"snapshots/home.20260315T1200",
+		"snapshots/home.20260315T1100",
+		"snapshots/home.20260315T1000",
+		"snapshots/home.20260314T0000",
+		"snapshots/home.20260313T1300",
+	}, paths(plan.Keep))
+	assert.Equal(t, []string{ReasonMinAge, ReasonDaily}, plan.Keep[0].Reasons)
+	assert.Equal(t, []string{ReasonPinned}, plan.Keep[4].Reasons)
+}
+
+func TestEvaluateMaxCount(t *testing.T) {
+	snapshots := hourly(24)
+
+	policy := &Policy{Hourly: 24, MaxCount: 5, Pinned: []string{"home.20260314T1300"}}
+	plan, err := policy.Evaluate(snapshots, now, nil)
+	assert.NoError(t, err)
+
+	assert.Len(t, plan.Keep, 6)
+	assert.Equal(t, "snapshots/home.20260314T1300", plan.Keep[5].Snapshot.Path)
+	assert.Len(t, plan.Delete, 18)
+	assert.Equal(t, []string{ReasonMaxCount}, plan.Delete[0].Reasons)
+}
+
+func TestEvaluateFreeSpace(t *testing.T) {
+	snapshots := hourly(10)
+	exclusive := map[uint64]uint64{}
+	for _, s := range snapshots {
+		exclusive[s.ID] = 10
+	}
+
+	policy := &Policy{Hourly: 10, MinFree: 125}
+	plan, err := policy.Evaluate(snapshots, now, &Space{Total: 1000, Free: 100, Exclusive: exclusive})
+	assert.NoError(t, err)
+
+	// three of the oldest snapshots free enough space
+	assert.Len(t, plan.Keep, 7)
+	assert.Equal(t, []string{
+		"snapshots/home.20260315T0500",
+		"snapshots/home.20260315T0400",
+		"snapshots/home.20260315T0300",
+	}, paths(plan.Delete))
+	assert.Equal(t, []string{ReasonFreeSpace}, plan.Delete[0].Reasons)
+
+	// unknown sizes free nothing, all but the newest snapshot are deleted
+	policy = &Policy{Hourly: 10, MinFreePercent: 20}
+	plan, err = policy.Evaluate(snapshots, now, &Space{Total: 1000, Free: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"snapshots/home.20260315T1200"}, paths(plan.Keep))
+
+	// enough free space
+	plan, err = policy.Evaluate(snapshots, now, &Space{Total: 1000, Free: 500})
+	assert.NoError(t, err)
+	assert.Len(t, plan.Keep, 10)
+}
+
+func TestEvaluateParent(t *testing.T) {
+	snapshots := hourly(3)
+	snapshots[1].ParentUUID = uuid.Nil
+
+	policy := &Policy{Parent: source}
+	plan, err := policy.Evaluate(snapshots, now, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Keep)
+	assert.Equal(t, []string{snapshots[0].Path, snapshots[2].Path}, paths(plan.Delete))
+}
+
+func TestEvaluateValidation(t *testing.T) {
+	_, err := (&Policy{Daily: -1}).Evaluate(nil, now, nil)
+	assert.EqualError(t, err, "negative snapshot count -1")
+
+	_, err = (&Policy{MinAge: -time.Hour}).Evaluate(nil, now, nil)
+	assert.EqualError(t, err, "negative min age -1h0m0s")
+
+	_, err = (&Policy{MinFreePercent: 101}).Evaluate(nil, now, nil)
+	assert.EqualError(t, err, "free space percent 101 is out of range 0..100")
+}
+
+func TestPlanPrint(t *testing.T) {
+	policy := &Policy{Hourly: 1}
+	plan, err := policy.Evaluate(hourly(2), now, nil)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, plan.Print(&out))
+	assert.Equal(t, ""+
+		"keep    snapshots/home.20260315T1200                    2026-03-15T12:00:00Z  hourly\n"+
+		"delete  snapshots/home.20260315T1100                    2026-03-15T11:00:00Z  expired\n", out.String())
+}
+
+func TestEvaluateMonthly(t *testing.T) {
+	var snapshots []btrfs.SubvolInfo
+	for i, day := range []time.Time{
+		time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC),
+	} {
+		snapshots = append(snapshots, btrfs.SubvolInfo{ID: uint64(i), Path: day.Format("2006-01-02"), OriginTime: day})
+	}
+
+	policy := &Policy{Monthly: 2}
+	plan, err := policy.Evaluate(snapshots, now, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2026-03-01", "2026-02-28"}, paths(plan.Keep))
+
+	// late February 28 in UTC is March 1 in UTC+1, so the newest of February is February 1
+	policy.Location = time.FixedZone("UTC+1", 3600)
+	snapshots[1].OriginTime = time.Date(2026, 2, 28, 23, 30, 0, 0, time.UTC)
+	plan, err = policy.Evaluate(snapshots, now, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2026-03-01", "2026-02-01"}, paths(plan.Keep))
+}
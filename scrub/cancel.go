@@ -0,0 +1,67 @@
+package scrub
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type scrubCancel struct {
+	path string
+
+	executor func(c *scrubCancel) error
+}
+
+func (c *scrubCancel) Path(path string) btrfs.ScrubCancel {
+	c.path = path
+	return c
+}
+
+func (c *scrubCancel) context() string {
+	return fmt.Sprintf("path='%s'", c.path)
+}
+
+func (c *scrubCancel) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdScrubCancel), Context: c.context(), Err: err}
+}
+
+func (c *scrubCancel) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *scrubCancel) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// btrfs ioctl executor
+func ioctlCancelExecute(c *scrubCancel) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return ioctl.ScrubCancel(c.path)
+}
+
+// btrfs cli executor
+func cliCancelExecute(c *scrubCancel) error {
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlCancel() interface{} {
+	return &scrubCancel{executor: ioctlCancelExecute}
+}
+
+func cliCancel() interface{} {
+	return &scrubCancel{executor: cliCancelExecute}
+}
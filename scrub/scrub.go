@@ -0,0 +1,90 @@
+package scrub
+
+import (
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdScrubStart, ioctlStart)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdScrubStatus, ioctlStatus)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdScrubCancel, ioctlCancel)
+
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdScrubStart, cliStart)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdScrubStatus, cliStatus)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdScrubCancel, cliCancel)
+}
+
+// selectDevices returns the requested devices of the filesystem mounted at path, all devices by default
+func selectDevices(path string, devices []string) ([]ioctl.DevInfo, error) {
+	infos, err := ioctl.GetDevInfos(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(devices) == 0 {
+		return infos, nil
+	}
+
+	var selected []ioctl.DevInfo
+	for _, device := range devices {
+		info, ok := ioctl.FindDevInfo(infos, device)
+		if !ok {
+			return nil, fmt.Errorf("device '%s' is not part of '%s'", device, path)
+		}
+		selected = append(selected, info)
+	}
+	return selected, nil
+}
+
+func newDevice(info ioctl.DevInfo, p *ioctl.ScrubProgress) btrfs.ScrubDevice {
+	device := btrfs.ScrubDevice{DevID: info.DevId, Path: info.Path}
+	if p == nil {
+		return device
+	}
+
+	device.LastPhysical = p.LastPhysical
+	device.ScrubCounters = btrfs.ScrubCounters{
+		DataExtentsScrubbed: p.DataExtentsScrubbed,
+		TreeExtentsScrubbed: p.TreeExtentsScrubbed,
+		DataBytesScrubbed:   p.DataBytesScrubbed,
+		TreeBytesScrubbed:   p.TreeBytesScrubbed,
+		ReadErrs:            p.ReadErrors,
+		CsumErrs:            p.CsumErrors,
+		VerifyErrs:          p.VerifyErrors,
+		SuperErrs:           p.SuperErrors,
+		MallocErrs:          p.MallocErrors,
+		UncorrectableErrs:   p.UncorrectableErrors,
+		CorrectedErrs:       p.CorrectedErrors,
+		UnverifiedErrs:      p.UnverifiedErrors,
+		NoCsum:              p.NoCsum,
+		CsumDiscards:        p.CsumDiscards,
+	}
+	return device
+}
+
+func newProgress(devices []btrfs.ScrubDevice) *btrfs.ScrubProgress {
+	progress := &btrfs.ScrubProgress{Devices: devices}
+	for _, device := range devices {
+		progress.Total.Add(device.ScrubCounters)
+	}
+	return progress
+}
+
+// status reads the progress of the running scrub of every device
+func status(path string, infos []ioctl.DevInfo) (*btrfs.ScrubProgress, error) {
+	devices := make([]btrfs.ScrubDevice, 0, len(infos))
+	for _, info := range infos {
+		p, err := ioctl.GetScrubProgress(path, info.DevId)
+		if err != nil {
+			return nil, err
+		}
+
+		device := newDevice(info, p)
+		device.Running = p != nil
+		devices = append(devices, device)
+	}
+	return newProgress(devices), nil
+}
@@ -0,0 +1,115 @@
+package scrub
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+func TestScrubValidation(t *testing.T) {
+	scrub := btrfs.NewIoctl().Scrub()
+
+	_, err := scrub.Start().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	_, err = scrub.Start().Path(mount).Devices("42").Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "device '42' is not part of")
+
+	_, err = scrub.Start().Wait()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "scrub was not started")
+
+	_, err = scrub.Status().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = scrub.Cancel().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "path is empty")
+
+	err = scrub.Cancel().Path(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "No scrub is running")
+}
+
+func TestScrub(t *testing.T) {
+	scrub := btrfs.NewIoctl().Scrub()
+
+	for i := 0; i < 4; i++ {
+		data := make([]byte, 4*1024*1024)
+		err := ioutil.WriteFile(filepath.Join(mount, fmt.Sprintf("file%d", i)), data, 0600)
+		assert.NoError(t, err)
+	}
+
+	progress, err := scrub.Status().Path(mount).Execute()
+	assert.NoError(t, err)
+	assert.False(t, progress.Running())
+
+	progress, err = scrub.Start().Path(mount).Execute()
+	assert.NoError(t, err)
+	if assert.Len(t, progress.Devices, 1) {
+		device := progress.Devices[0]
+		assert.Equal(t, uint64(1), device.DevID)
+		assert.False(t, device.Running)
+		assert.False(t, device.Canceled)
+		assert.NoError(t, device.Err)
+		assert.True(t, device.DataBytesScrubbed > 0)
+		assert.True(t, device.TreeBytesScrubbed > 0)
+		assert.Equal(t, device.ScrubCounters, progress.Total)
+	}
+	assert.False(t, progress.Total.HasErrors())
+
+	// read only scrub of the device given by path
+	progress, err = scrub.Start().Path(mount).Devices(progress.Devices[0].Path).ReadOnly().Execute()
+	assert.NoError(t, err)
+	assert.Len(t, progress.Devices, 1)
+	assert.False(t, progress.Total.HasErrors())
+}
+
+func TestScrubWatch(t *testing.T) {
+	scrub := btrfs.NewIoctl().Scrub()
+
+	start := scrub.Start().Path(mount).ReadOnly().Background()
+	_, err := start.Execute()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var last btrfs.ScrubProgress
+	for progress := range scrub.Status().Path(mount).Watch(ctx) {
+		assert.NoError(t, progress.Err)
+		last = progress
+	}
+	assert.False(t, last.Running())
+
+	// the device results of the background scrub
+	progress, err := start.Wait()
+	assert.NoError(t, err)
+	if assert.NotNil(t, progress) {
+		assert.Len(t, progress.Devices, 1)
+		assert.False(t, progress.Total.HasErrors())
+	}
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,175 @@
+package scrub
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/poll"
+	"github.com/plar/btrfs/ioctl"
+)
+
+// how often a background start checks whether the devices are being scrubbed
+var startPollInterval = 100 * time.Millisecond
+
+type scrubStart struct {
+	path       string
+	devices    []string
+	readOnly   bool
+	background bool
+
+	// task runs the scrub ioctls of the devices, their results are stored in results
+	task    *poll.Task
+	results []btrfs.ScrubDevice
+
+	executor func(c *scrubStart) (*btrfs.ScrubProgress, error)
+}
+
+func (c *scrubStart) Path(path string) btrfs.ScrubStart {
+	c.path = path
+	return c
+}
+
+func (c *scrubStart) Devices(devices ...string) btrfs.ScrubStart {
+	for _, device := range devices {
+		c.devices = append(c.devices, device)
+	}
+	return c
+}
+
+func (c *scrubStart) ReadOnly() btrfs.ScrubStart {
+	c.readOnly = true
+	return c
+}
+
+func (c *scrubStart) Background() btrfs.ScrubStart {
+	c.background = true
+	return c
+}
+
+func (c *scrubStart) context() string {
+	return fmt.Sprintf("path='%s', devices=%v, readOnly=%v, background=%v",
+		c.path, c.devices, c.readOnly, c.background)
+}
+
+func (c *scrubStart) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdScrubStart), Context: c.context(), Err: err}
+}
+
+func (c *scrubStart) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *scrubStart) Execute() (*btrfs.ScrubProgress, error) {
+	progress, err := c.executor(c)
+	if err != nil {
+		return progress, c.error(err)
+	}
+	return progress, nil
+}
+
+func (c *scrubStart) Wait() (*btrfs.ScrubProgress, error) {
+	if c.task == nil {
+		return nil, c.error(errors.New("scrub was not started"))
+	}
+
+	c.task.Wait()
+	progress, err := finished(c.results)
+	if err != nil {
+		return progress, c.error(err)
+	}
+	return progress, nil
+}
+
+// btrfs ioctl executor
+func ioctlStartExecute(c *scrubStart) (*btrfs.ScrubProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := selectDevices(c.path, c.devices)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ioctl returns only when the device scrub is over, every device runs in its own goroutine
+	devices := make([]btrfs.ScrubDevice, len(infos))
+	c.results = devices
+	c.task = poll.Go(func() error {
+		var wg sync.WaitGroup
+		for i, info := range infos {
+			wg.Add(1)
+			go func(i int, info ioctl.DevInfo) {
+				defer wg.Done()
+
+				p, err := ioctl.Scrub(c.path, info.DevId, c.readOnly)
+				devices[i] = newDevice(info, p)
+				devices[i].Canceled = p != nil && err != nil
+				devices[i].Err = err
+			}(i, info)
+		}
+		wg.Wait()
+		return nil
+	})
+
+	var progress *btrfs.ScrubProgress
+	if c.background && c.task.WaitStarted(startPollInterval, func() bool {
+		p, err := status(c.path, infos)
+		if err != nil || len(p.Devices) != countRunning(p) {
+			return false
+		}
+		progress = p
+		return true
+	}) {
+		return progress, nil
+	}
+
+	c.task.Wait()
+	return finished(c.results)
+}
+
+func countRunning(progress *btrfs.ScrubProgress) int {
+	n := 0
+	for _, device := range progress.Devices {
+		if device.Running {
+			n++
+		}
+	}
+	return n
+}
+
+// finished aggregates the device results and returns the first device error
+func finished(devices []btrfs.ScrubDevice) (*btrfs.ScrubProgress, error) {
+	progress := newProgress(devices)
+	for _, device := range devices {
+		if device.Err != nil {
+			return progress, device.Err
+		}
+	}
+	return progress, nil
+}
+
+// btrfs cli executor
+func cliStartExecute(c *scrubStart) (*btrfs.ScrubProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlStart() interface{} {
+	return &scrubStart{executor: ioctlStartExecute}
+}
+
+func cliStart() interface{} {
+	return &scrubStart{executor: cliStartExecute}
+}
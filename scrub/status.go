@@ -0,0 +1,109 @@
+package scrub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/poll"
+)
+
+// how often Watch reads the scrub progress
+var watchInterval = time.Second
+
+type scrubStatus struct {
+	path    string
+	devices []string
+
+	executor func(c *scrubStatus) (*btrfs.ScrubProgress, error)
+}
+
+func (c *scrubStatus) Path(path string) btrfs.ScrubStatus {
+	c.path = path
+	return c
+}
+
+func (c *scrubStatus) Devices(devices ...string) btrfs.ScrubStatus {
+	for _, device := range devices {
+		c.devices = append(c.devices, device)
+	}
+	return c
+}
+
+func (c *scrubStatus) context() string {
+	return fmt.Sprintf("path='%s', devices=%v", c.path, c.devices)
+}
+
+func (c *scrubStatus) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdScrubStatus), Context: c.context(), Err: err}
+}
+
+func (c *scrubStatus) validate() error {
+	if len(c.path) == 0 {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+func (c *scrubStatus) Execute() (*btrfs.ScrubProgress, error) {
+	progress, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return progress, nil
+}
+
+func (c *scrubStatus) Watch(ctx context.Context) <-chan btrfs.ScrubProgress {
+	ch := make(chan btrfs.ScrubProgress)
+
+	go func() {
+		defer close(ch)
+
+		poll.Watch(ctx, watchInterval, func() bool {
+			progress, err := c.Execute()
+			if err != nil {
+				progress = &btrfs.ScrubProgress{Err: err}
+			}
+
+			select {
+			case ch <- *progress:
+			case <-ctx.Done():
+				return false
+			}
+			return err == nil && progress.Running()
+		})
+	}()
+
+	return ch
+}
+
+// btrfs ioctl executor
+func ioctlStatusExecute(c *scrubStatus) (*btrfs.ScrubProgress, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := selectDevices(c.path, c.devices)
+	if err != nil {
+		return nil, err
+	}
+
+	return status(c.path, infos)
+}
+
+// btrfs cli executor
+func cliStatusExecute(c *scrubStatus) (*btrfs.ScrubProgress, error) {
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlStatus() interface{} {
+	return &scrubStatus{executor: ioctlStatusExecute}
+}
+
+func cliStatus() interface{} {
+	return &scrubStatus{executor: cliStatusExecute}
+}
@@ -0,0 +1,207 @@
+package send
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+func init() {
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdSend, ioctlSend)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdSend, cliSend)
+}
+
+type send struct {
+	subvol       string
+	parent       string
+	cloneSources []string
+	noFileData   bool
+	version      uint32
+	compressed   bool
+	writer       io.Writer
+
+	executor func(c *send) error
+}
+
+func (c *send) Subvolume(path string) btrfs.Send {
+	c.subvol = path
+	return c
+}
+
+func (c *send) Parent(path string) btrfs.Send {
+	c.parent = path
+	return c
+}
+
+func (c *send) CloneSources(paths ...string) btrfs.Send {
+	for _, path := range paths {
+		c.cloneSources = append(c.cloneSources, path)
+	}
+	return c
+}
+
+func (c *send) NoFileData() btrfs.Send {
+	c.noFileData = true
+	return c
+}
+
+func (c *send) ProtocolVersion(version uint32) btrfs.Send {
+	c.version = version
+	return c
+}
+
+func (c *send) Compressed() btrfs.Send {
+	c.compressed = true
+	return c
+}
+
+func (c *send) Writer(w io.Writer) btrfs.Send {
+	c.writer = w
+	return c
+}
+
+func (c *send) context() string {
+	return fmt.Sprintf("subvol='%s', parent='%s', cloneSources=%v, noFileData=%v, version=%d, compressed=%v",
+		c.subvol, c.parent, c.cloneSources, c.noFileData, c.version, c.compressed)
+}
+
+func (c *send) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdSend), Context: c.context(), Err: err}
+}
+
+func (c *send) validate() error {
+	if len(c.subvol) == 0 {
+		return errors.New("subvolume is empty")
+	}
+
+	if c.writer == nil {
+		return errors.New("writer is not set")
+	}
+
+	if c.compressed && c.version > 0 && c.version < 2 {
+		return fmt.Errorf("compressed send requires protocol version 2, got %d", c.version)
+	}
+
+	return nil
+}
+
+func (c *send) Execute() error {
+	err := c.executor(c)
+	if err != nil {
+		return c.error(err)
+	}
+	return nil
+}
+
+// readOnlyRoot returns the root id of the read only subvolume at path
+func readOnlyRoot(path string) (uint64, error) {
+	ok, err := ioctl.TestIsSubvolume(path)
+	if err != nil {
+		return 0, err
+	} else if !ok {
+		return 0, fmt.Errorf("'%s' is not a subvolume", path)
+	}
+
+	flags, err := ioctl.SubvolGetFlags(path)
+	if err != nil {
+		return 0, err
+	}
+	if flags&ioctl.SubvolFlagReadOnly == 0 {
+		return 0, fmt.Errorf("subvolume '%s' is not read only", path)
+	}
+
+	return ioctl.GetRootId(path)
+}
+
+// btrfs ioctl executor
+func ioctlSendExecute(c *send) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	if _, err := readOnlyRoot(c.subvol); err != nil {
+		return err
+	}
+
+	var parentRoot uint64
+	if len(c.parent) > 0 {
+		if parentRoot, err = readOnlyRoot(c.parent); err != nil {
+			return err
+		}
+	}
+
+	var cloneRoots []uint64
+	for _, source := range c.cloneSources {
+		root, err := readOnlyRoot(source)
+		if err != nil {
+			return err
+		}
+		cloneRoots = append(cloneRoots, root)
+	}
+
+	// the parent is a clone source too
+	if parentRoot != 0 {
+		cloneRoots = append(cloneRoots, parentRoot)
+	}
+
+	var flags uint64
+	if c.noFileData {
+		flags |= ioctl.SendFlagNoFileData
+	}
+	version := c.version
+	if c.compressed {
+		flags |= ioctl.SendFlagCompressed
+		if version == 0 {
+			version = 2
+		}
+	}
+	if version > 0 {
+		flags |= ioctl.SendFlagVersion
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	// the kernel writes the stream into the pipe, closing the read end on a writer
+	// failure makes the kernel fail with EPIPE and stops the send
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(c.writer, r)
+		r.Close()
+		copied <- err
+	}()
+
+	err = ioctl.Send(c.subvol, w.Fd(), parentRoot, cloneRoots, flags, version)
+	w.Close()
+
+	if copyErr := <-copied; copyErr != nil {
+		return fmt.Errorf("Failed to write the send stream: %v", copyErr)
+	}
+	return err
+}
+
+// btrfs cli executor
+func cliSendExecute(c *send) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	return errors.New("Unimplemented")
+}
+
+// commands
+func ioctlSend() interface{} {
+	return &send{executor: ioctlSendExecute}
+}
+
+func cliSend() interface{} {
+	return &send{executor: cliSendExecute}
+}
@@ -0,0 +1,182 @@
+package send
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	"github.com/plar/btrfs/sendstream"
+	_ "github.com/plar/btrfs/subvolume"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loop *btrfstest.Loopback
+var mount string
+
+const streamMagic = "btrfs-stream\x00"
+
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n+len(p) > 1024 {
+		return 0, errors.New("disk full")
+	}
+	w.n += len(p)
+	return len(p), nil
+}
+
+func snapshot(t *testing.T, src, name string) string {
+	dest := filepath.Join(mount, name)
+	err := btrfs.NewIoctl().Subvolume().Snapshot().ReadOnly().Source(src).Destination(dest).Execute()
+	assert.NoError(t, err)
+	return dest
+}
+
+// decode parses a stream generated on the loopback filesystem
+func decode(t *testing.T, stream []byte) []sendstream.Command {
+	d := sendstream.NewDecoder(bytes.NewReader(stream))
+	var cmds []sendstream.Command
+	for {
+		c, err := d.Next()
+		if err == io.EOF {
+			return cmds
+		}
+		if !assert.NoError(t, err) {
+			return cmds
+		}
+		cmds = append(cmds, c)
+	}
+}
+
+func subvolInfo(t *testing.T, name string) btrfs.SubvolInfo {
+	subvols, err := btrfs.NewIoctl().Subvolume().List().Path(mount).Execute()
+	assert.NoError(t, err)
+	for _, s := range subvols {
+		if s.Path == name {
+			return s
+		}
+	}
+	t.Fatalf("subvolume '%s' not found", name)
+	return btrfs.SubvolInfo{}
+}
+
+func TestSendValidation(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := btrfs.NewIoctl().Send().Writer(&buf).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "subvolume is empty")
+
+	err = btrfs.NewIoctl().Send().Subvolume(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "writer is not set")
+
+	err = btrfs.NewIoctl().Send().Subvolume(mount).Writer(&buf).ProtocolVersion(1).Compressed().Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "requires protocol version 2")
+
+	err = btrfs.NewIoctl().Send().Subvolume(mount).Writer(&buf).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not read only")
+}
+
+func TestSend(t *testing.T) {
+	src := filepath.Join(mount, "send-src")
+	err := btrfs.NewIoctl().Subvolume().Create().Destination(src).Execute()
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(src, "file1"), bytes.Repeat([]byte("send"), 64*1024), 0600)
+	assert.NoError(t, err)
+
+	snap1 := snapshot(t, src, "send-snap1")
+
+	var full bytes.Buffer
+	err = btrfs.NewIoctl().Send().Subvolume(snap1).Writer(&full).Execute()
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(full.Bytes(), []byte(streamMagic)))
+
+	var meta bytes.Buffer
+	err = btrfs.NewIoctl().Send().Subvolume(snap1).NoFileData().Writer(&meta).Execute()
+	assert.NoError(t, err)
+	assert.True(t, meta.Len() < full.Len())
+
+	err = ioutil.WriteFile(filepath.Join(src, "file2"), []byte("incremental"), 0600)
+	assert.NoError(t, err)
+	snap2 := snapshot(t, src, "send-snap2")
+
+	var incremental bytes.Buffer
+	err = btrfs.NewIoctl().Send().Subvolume(snap2).Parent(snap1).Writer(&incremental).Execute()
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(incremental.Bytes(), []byte(streamMagic)))
+	assert.True(t, incremental.Len() < full.Len())
+
+	var cloned bytes.Buffer
+	err = btrfs.NewIoctl().Send().Subvolume(snap2).CloneSources(snap1).ProtocolVersion(1).Writer(&cloned).Execute()
+	assert.NoError(t, err)
+
+	// decode the generated streams
+	snap1Info := subvolInfo(t, "send-snap1")
+
+	cmds := decode(t, full.Bytes())
+	if assert.NotEmpty(t, cmds) {
+		subvol, ok := cmds[0].(*sendstream.Subvol)
+		assert.True(t, ok)
+		if ok {
+			assert.Equal(t, "send-snap1", subvol.Path)
+			assert.Equal(t, snap1Info.UUID, subvol.UUID)
+		}
+		assert.Equal(t, sendstream.CmdEnd, cmds[len(cmds)-1].Cmd())
+	}
+	var written []byte
+	for _, c := range cmds {
+		if w, ok := c.(*sendstream.Write); ok && w.Path == "file1" {
+			written = append(written, w.Data...)
+		}
+	}
+	assert.Equal(t, bytes.Repeat([]byte("send"), 64*1024), written)
+
+	var dump bytes.Buffer
+	assert.NoError(t, sendstream.Dump(&dump, bytes.NewReader(full.Bytes())))
+	assert.True(t, strings.HasPrefix(dump.String(), "subvol          ./send-snap1"))
+	assert.Contains(t, dump.String(), "write           ./send-snap1/file1")
+
+	for _, c := range decode(t, meta.Bytes()) {
+		assert.NotEqual(t, sendstream.CmdWrite, c.Cmd())
+	}
+
+	cmds = decode(t, incremental.Bytes())
+	if assert.NotEmpty(t, cmds) {
+		snap, ok := cmds[0].(*sendstream.Snapshot)
+		assert.True(t, ok)
+		if ok {
+			assert.Equal(t, "send-snap2", snap.Path)
+			assert.Equal(t, snap1Info.UUID, snap.CloneUUID)
+		}
+	}
+	assert.Contains(t, cmds, &sendstream.Write{Path: "file2", Data: []byte("incremental")})
+
+	err = btrfs.NewIoctl().Send().Subvolume(snap2).Parent(src).Writer(&cloned).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not read only")
+
+	err = btrfs.NewIoctl().Send().Subvolume(snap1).Writer(&failingWriter{}).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+}
+
+func TestMain(m *testing.M) {
+	loop = btrfstest.Setup()
+	mount = loop.Mount
+	code := m.Run()
+	loop.Teardown()
+	os.Exit(code)
+}
@@ -0,0 +1,206 @@
+package sendstream
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Command is a decoded send stream command
+type Command interface {
+	Cmd() Cmd
+}
+
+// Subvol starts a full stream of a new subvolume
+type Subvol struct {
+	Path     string
+	UUID     uuid.UUID
+	CTransid uint64
+}
+
+// Snapshot starts an incremental stream based on the clone source
+type Snapshot struct {
+	Path          string
+	UUID          uuid.UUID
+	CTransid      uint64
+	CloneUUID     uuid.UUID
+	CloneCTransid uint64
+}
+
+type Mkfile struct {
+	Path string
+	Ino  uint64
+}
+
+type Mkdir struct {
+	Path string
+	Ino  uint64
+}
+
+type Mknod struct {
+	Path string
+	Ino  uint64
+	Mode uint64
+	Rdev uint64
+}
+
+type Mkfifo struct {
+	Path string
+	Ino  uint64
+}
+
+type Mksock struct {
+	Path string
+	Ino  uint64
+}
+
+type Symlink struct {
+	Path     string
+	Ino      uint64
+	PathLink string
+}
+
+type Rename struct {
+	Path   string
+	PathTo string
+}
+
+type Link struct {
+	Path     string
+	PathLink string
+}
+
+type Unlink struct {
+	Path string
+}
+
+type Rmdir struct {
+	Path string
+}
+
+type SetXattr struct {
+	Path string
+	Name string
+	Data []byte
+}
+
+type RemoveXattr struct {
+	Path string
+	Name string
+}
+
+type Write struct {
+	Path   string
+	Offset uint64
+	Data   []byte
+}
+
+// Clone copies Len bytes at CloneOffset of ClonePath in the subvolume CloneUUID to Offset of Path
+type Clone struct {
+	Path          string
+	Offset        uint64
+	Len           uint64
+	CloneUUID     uuid.UUID
+	CloneCTransid uint64
+	ClonePath     string
+	CloneOffset   uint64
+}
+
+type Truncate struct {
+	Path string
+	Size uint64
+}
+
+type Chmod struct {
+	Path string
+	Mode uint64
+}
+
+type Chown struct {
+	Path string
+	UID  uint64
+	GID  uint64
+}
+
+type Utimes struct {
+	Path  string
+	Atime time.Time
+	Mtime time.Time
+	Ctime time.Time
+}
+
+// UpdateExtent is sent instead of Write when the stream has no file data
+type UpdateExtent struct {
+	Path   string
+	Offset uint64
+	Size   uint64
+}
+
+type Fallocate struct {
+	Path   string
+	Mode   uint32
+	Offset uint64
+	Size   uint64
+}
+
+type Fileattr struct {
+	Path     string
+	Fileattr uint64
+}
+
+// EncodedWrite carries compressed data as stored on disk
+type EncodedWrite struct {
+	Path             string
+	Offset           uint64
+	UnencodedFileLen uint64
+	UnencodedLen     uint64
+	UnencodedOffset  uint64
+	Compression      uint32
+	Encryption       uint32
+	Data             []byte
+}
+
+type EnableVerity struct {
+	Path      string
+	Algorithm uint8
+	BlockSize uint32
+	Salt      []byte
+	Signature []byte
+}
+
+// End terminates the stream
+type End struct{}
+
+// Unknown is a command this package does not know, its attributes are kept raw
+type Unknown struct {
+	Type  Cmd
+	Attrs map[Attr][]byte
+}
+
+func (c *Subvol) Cmd() Cmd       { return CmdSubvol }
+func (c *Snapshot) Cmd() Cmd     { return CmdSnapshot }
+func (c *Mkfile) Cmd() Cmd       { return CmdMkfile }
+func (c *Mkdir) Cmd() Cmd        { return CmdMkdir }
+func (c *Mknod) Cmd() Cmd        { return CmdMknod }
+func (c *Mkfifo) Cmd() Cmd       { return CmdMkfifo }
+func (c *Mksock) Cmd() Cmd       { return CmdMksock }
+func (c *Symlink) Cmd() Cmd      { return CmdSymlink }
+func (c *Rename) Cmd() Cmd       { return CmdRename }
+func (c *Link) Cmd() Cmd         { return CmdLink }
+func (c *Unlink) Cmd() Cmd       { return CmdUnlink }
+func (c *Rmdir) Cmd() Cmd        { return CmdRmdir }
+func (c *SetXattr) Cmd() Cmd     { return CmdSetXattr }
+func (c *RemoveXattr) Cmd() Cmd  { return CmdRemoveXattr }
+func (c *Write) Cmd() Cmd        { return CmdWrite }
+func (c *Clone) Cmd() Cmd        { return CmdClone }
+func (c *Truncate) Cmd() Cmd     { return CmdTruncate }
+func (c *Chmod) Cmd() Cmd        { return CmdChmod }
+func (c *Chown) Cmd() Cmd        { return CmdChown }
+func (c *Utimes) Cmd() Cmd       { return CmdUtimes }
+func (c *UpdateExtent) Cmd() Cmd { return CmdUpdateExtent }
+func (c *Fallocate) Cmd() Cmd    { return CmdFallocate }
+func (c *Fileattr) Cmd() Cmd     { return CmdFileattr }
+func (c *EncodedWrite) Cmd() Cmd { return CmdEncodedWrite }
+func (c *EnableVerity) Cmd() Cmd { return CmdEnableVerity }
+func (c *End) Cmd() Cmd          { return CmdEnd }
+func (c *Unknown) Cmd() Cmd      { return c.Type }
@@ -0,0 +1,344 @@
+package sendstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// crc32c computes the checksum the way the kernel does: seed 0 and no final inversion
+func crc32c(data ...[]byte) uint32 {
+	crc := ^uint32(0)
+	for _, d := range data {
+		crc = crc32.Update(crc, castagnoli, d)
+	}
+	return ^crc
+}
+
+// Decoder reads commands from a send stream. Several streams written one after
+// another, as `btrfs send` does for multiple subvolumes, are decoded in sequence.
+type Decoder struct {
+	r       io.Reader
+	version uint32
+	header  bool
+	streams int
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Version returns the protocol version of the current stream, it is zero until the first command is read
+func (d *Decoder) Version() uint32 {
+	return d.version
+}
+
+func (d *Decoder) readHeader() error {
+	var hdr [streamHeaderSize]byte
+	n, err := io.ReadFull(d.r, hdr[:])
+	if err == io.EOF && d.streams > 0 {
+		return io.EOF
+	}
+	if err != nil {
+		if n == 0 && err == io.EOF {
+			return errors.New("send stream is empty")
+		}
+		return fmt.Errorf("failed to read the stream header: %v", err)
+	}
+
+	if string(hdr[:len(Magic)]) != Magic {
+		return errors.New("invalid send stream magic")
+	}
+
+	version := binary.LittleEndian.Uint32(hdr[len(Magic):])
+	if version == 0 || version > MaxVersion {
+		return fmt.Errorf("unsupported send stream version %d", version)
+	}
+
+	d.version = version
+	d.header = true
+	d.streams++
+	return nil
+}
+
+// Next returns the next command, io.EOF is returned at the end of the stream
+func (d *Decoder) Next() (Command, error) {
+	if !d.header {
+		if err := d.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	var hdr [cmdHeaderSize]byte
+	n, err := io.ReadFull(d.r, hdr[:])
+	if err != nil {
+		if n == 0 && err == io.EOF {
+			// btrfs receive accepts a stream without the end command as well
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read the command header: %v", err)
+	}
+
+	size := binary.LittleEndian.Uint32(hdr[0:4])
+	cmd := Cmd(binary.LittleEndian.Uint16(hdr[4:6]))
+	crc := binary.LittleEndian.Uint32(hdr[6:10])
+	if size > maxCmdSize {
+		return nil, fmt.Errorf("%s: command size %d is too large", cmd, size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(d.r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%s: failed to read the command: %v", cmd, err)
+	}
+
+	binary.LittleEndian.PutUint32(hdr[6:10], 0)
+	if sum := crc32c(hdr[:], payload); sum != crc {
+		return nil, fmt.Errorf("%s: checksum mismatch, expected 0x%08x got 0x%08x", cmd, crc, sum)
+	}
+
+	a, err := d.parseAttrs(cmd, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := a.command()
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd == CmdEnd {
+		d.header = false
+	}
+	return c, nil
+}
+
+func (d *Decoder) parseAttrs(cmd Cmd, payload []byte) (*attrs, error) {
+	a := &attrs{cmd: cmd, values: map[Attr][]byte{}}
+	for len(payload) > 0 {
+		if len(payload) < tlvHeaderSize {
+			return nil, fmt.Errorf("%s: truncated attribute header", cmd)
+		}
+
+		typ := Attr(binary.LittleEndian.Uint16(payload[0:2]))
+		if d.version >= 2 && typ == AttrData {
+			// since version 2 the data attribute has no length and takes the rest of the command
+			a.values[typ] = payload[2:]
+			break
+		}
+
+		size := int(binary.LittleEndian.Uint16(payload[2:4]))
+		payload = payload[tlvHeaderSize:]
+		if size > len(payload) {
+			return nil, fmt.Errorf("%s: attribute %s is truncated", cmd, typ)
+		}
+
+		a.values[typ] = payload[:size]
+		payload = payload[size:]
+	}
+	return a, nil
+}
+
+// attrs decodes the attributes of a command, the first error is kept
+type attrs struct {
+	cmd    Cmd
+	values map[Attr][]byte
+	err    error
+}
+
+func (a *attrs) get(typ Attr, size int) []byte {
+	value, ok := a.values[typ]
+	if !ok {
+		if a.err == nil {
+			a.err = fmt.Errorf("%s: missing attribute %s", a.cmd, typ)
+		}
+		return nil
+	}
+	if size >= 0 && len(value) != size {
+		if a.err == nil {
+			a.err = fmt.Errorf("%s: attribute %s has size %d, expected %d", a.cmd, typ, len(value), size)
+		}
+		return nil
+	}
+	return value
+}
+
+func (a *attrs) bytes(typ Attr) []byte {
+	return bytes.Clone(a.get(typ, -1))
+}
+
+// optional returns nil instead of failing when the attribute is missing
+func (a *attrs) optional(typ Attr) []byte {
+	if _, ok := a.values[typ]; !ok {
+		return nil
+	}
+	return a.bytes(typ)
+}
+
+func (a *attrs) string(typ Attr) string {
+	return string(a.get(typ, -1))
+}
+
+func (a *attrs) u8(typ Attr) uint8 {
+	if value := a.get(typ, 1); value != nil {
+		return value[0]
+	}
+	return 0
+}
+
+func (a *attrs) u32(typ Attr) uint32 {
+	if value := a.get(typ, 4); value != nil {
+		return binary.LittleEndian.Uint32(value)
+	}
+	return 0
+}
+
+func (a *attrs) u64(typ Attr) uint64 {
+	if value := a.get(typ, 8); value != nil {
+		return binary.LittleEndian.Uint64(value)
+	}
+	return 0
+}
+
+func (a *attrs) uuid(typ Attr) uuid.UUID {
+	if value := a.get(typ, uuid.Size); value != nil {
+		return uuid.FromBytesOrNil(value)
+	}
+	return uuid.Nil
+}
+
+// timespec is struct btrfs_timespec: le64 seconds and le32 nanoseconds
+func (a *attrs) timespec(typ Attr) time.Time {
+	if value := a.get(typ, 12); value != nil {
+		sec := binary.LittleEndian.Uint64(value[0:8])
+		nsec := binary.LittleEndian.Uint32(value[8:12])
+		return time.Unix(int64(sec), int64(nsec))
+	}
+	return time.Time{}
+}
+
+func (a *attrs) command() (Command, error) {
+	var c Command
+	switch a.cmd {
+	case CmdSubvol:
+		c = &Subvol{Path: a.string(AttrPath), UUID: a.uuid(AttrUUID), CTransid: a.u64(AttrCTransid)}
+	case CmdSnapshot:
+		c = &Snapshot{
+			Path:          a.string(AttrPath),
+			UUID:          a.uuid(AttrUUID),
+			CTransid:      a.u64(AttrCTransid),
+			CloneUUID:     a.uuid(AttrCloneUUID),
+			CloneCTransid: a.u64(AttrCloneCTransid),
+		}
+	case CmdMkfile:
+		c = &Mkfile{Path: a.string(AttrPath), Ino: a.u64(AttrIno)}
+	case CmdMkdir:
+		c = &Mkdir{Path: a.string(AttrPath), Ino: a.u64(AttrIno)}
+	case CmdMknod:
+		c = &Mknod{Path: a.string(AttrPath), Ino: a.u64(AttrIno), Mode: a.u64(AttrMode), Rdev: a.u64(AttrRdev)}
+	case CmdMkfifo:
+		c = &Mkfifo{Path: a.string(AttrPath), Ino: a.u64(AttrIno)}
+	case CmdMksock:
+		c = &Mksock{Path: a.string(AttrPath), Ino: a.u64(AttrIno)}
+	case CmdSymlink:
+		c = &Symlink{Path: a.string(AttrPath), Ino: a.u64(AttrIno), PathLink: a.string(AttrPathLink)}
+	case CmdRename:
+		c = &Rename{Path: a.string(AttrPath), PathTo: a.string(AttrPathTo)}
+	case CmdLink:
+		c = &Link{Path: a.string(AttrPath), PathLink: a.string(AttrPathLink)}
+	case CmdUnlink:
+		c = &Unlink{Path: a.string(AttrPath)}
+	case CmdRmdir:
+		c = &Rmdir{Path: a.string(AttrPath)}
+	case CmdSetXattr:
+		c = &SetXattr{Path: a.string(AttrPath), Name: a.string(AttrXattrName), Data: a.bytes(AttrXattrData)}
+	case CmdRemoveXattr:
+		c = &RemoveXattr{Path: a.string(AttrPath), Name: a.string(AttrXattrName)}
+	case CmdWrite:
+		c = &Write{Path: a.string(AttrPath), Offset: a.u64(AttrFileOffset), Data: a.bytes(AttrData)}
+	case CmdClone:
+		c = &Clone{
+			Path:          a.string(AttrPath),
+			Offset:        a.u64(AttrFileOffset),
+			Len:           a.u64(AttrCloneLen),
+			CloneUUID:     a.uuid(AttrCloneUUID),
+			CloneCTransid: a.u64(AttrCloneCTransid),
+			ClonePath:     a.string(AttrClonePath),
+			CloneOffset:   a.u64(AttrCloneOffset),
+		}
+	case CmdTruncate:
+		c = &Truncate{Path: a.string(AttrPath), Size: a.u64(AttrSize)}
+	case CmdChmod:
+		c = &Chmod{Path: a.string(AttrPath), Mode: a.u64(AttrMode)}
+	case CmdChown:
+		c = &Chown{Path: a.string(AttrPath), UID: a.u64(AttrUID), GID: a.u64(AttrGID)}
+	case CmdUtimes:
+		c = &Utimes{
+			Path:  a.string(AttrPath),
+			Atime: a.timespec(AttrAtime),
+			Mtime: a.timespec(AttrMtime),
+			Ctime: a.timespec(AttrCtime),
+		}
+	case CmdUpdateExtent:
+		c = &UpdateExtent{Path: a.string(AttrPath), Offset: a.u64(AttrFileOffset), Size: a.u64(AttrSize)}
+	case CmdFallocate:
+		c = &Fallocate{
+			Path:   a.string(AttrPath),
+			Mode:   a.u32(AttrFallocateMode),
+			Offset: a.u64(AttrFileOffset),
+			Size:   a.u64(AttrSize),
+		}
+	case CmdFileattr:
+		c = &Fileattr{Path: a.string(AttrPath), Fileattr: a.u64(AttrFileattr)}
+	case CmdEncodedWrite:
+		c = &EncodedWrite{
+			Path:             a.string(AttrPath),
+			Offset:           a.u64(AttrFileOffset),
+			UnencodedFileLen: a.u64(AttrUnencodedFileLen),
+			UnencodedLen:     a.u64(AttrUnencodedLen),
+			UnencodedOffset:  a.u64(AttrUnencodedOffset),
+			Compression:      a.u32(AttrCompression),
+			Encryption:       a.encryption(),
+			Data:             a.bytes(AttrData),
+		}
+	case CmdEnableVerity:
+		c = &EnableVerity{
+			Path:      a.string(AttrPath),
+			Algorithm: a.u8(AttrVerityAlgorithm),
+			BlockSize: a.u32(AttrVerityBlockSize),
+			Salt:      a.optional(AttrVeritySaltData),
+			Signature: a.optional(AttrVeritySigData),
+		}
+	case CmdEnd:
+		c = &End{}
+	default:
+		values := map[Attr][]byte{}
+		for typ, value := range a.values {
+			values[typ] = bytes.Clone(value)
+		}
+		c = &Unknown{Type: a.cmd, Attrs: values}
+	}
+
+	if a.err != nil {
+		return nil, a.err
+	}
+	return c, nil
+}
+
+// encryption is optional, the kernel does not send it for unencrypted extents
+func (a *attrs) encryption() uint32 {
+	if _, ok := a.values[AttrEncryption]; !ok {
+		return 0
+	}
+	return a.u32(AttrEncryption)
+}
@@ -0,0 +1,231 @@
+package sendstream
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// field is an attribute of a dumped command, the value is a string, raw bytes or an uint64
+type field struct {
+	key   string
+	value interface{}
+}
+
+// dumpTimeFormat is the format of the timestamps, they are printed in UTC so dumps can be compared
+const dumpTimeFormat = "2006-01-02T15:04:05-0700"
+
+func dumpTime(t time.Time) string {
+	return t.UTC().Format(dumpTimeFormat)
+}
+
+func dumpMode(mode uint64) string {
+	return strconv.FormatUint(mode, 8)
+}
+
+// dumper keeps the path of the current subvolume, the paths of the commands are relative to it
+type dumper struct {
+	subvol string
+}
+
+func (d *dumper) path(p string) string {
+	return "./" + path.Join(d.subvol, p)
+}
+
+// fields returns the path and the attributes of the command
+func (d *dumper) fields(cmd Command) (string, []field) {
+	switch c := cmd.(type) {
+	case *Subvol:
+		d.subvol = c.Path
+		return d.path(""), []field{{"uuid", c.UUID.String()}, {"transid", c.CTransid}}
+	case *Snapshot:
+		d.subvol = c.Path
+		return d.path(""), []field{
+			{"uuid", c.UUID.String()},
+			{"transid", c.CTransid},
+			{"parent_uuid", c.CloneUUID.String()},
+			{"parent_transid", c.CloneCTransid},
+		}
+	case *Mkfile:
+		return d.path(c.Path), nil
+	case *Mkdir:
+		return d.path(c.Path), nil
+	case *Mknod:
+		return d.path(c.Path), []field{{"mode", dumpMode(c.Mode)}, {"dev", fmt.Sprintf("0x%x", c.Rdev)}}
+	case *Mkfifo:
+		return d.path(c.Path), nil
+	case *Mksock:
+		return d.path(c.Path), nil
+	case *Symlink:
+		return d.path(c.Path), []field{{"dest", c.PathLink}}
+	case *Rename:
+		return d.path(c.Path), []field{{"dest", d.path(c.PathTo)}}
+	case *Link:
+		return d.path(c.Path), []field{{"dest", c.PathLink}}
+	case *Unlink:
+		return d.path(c.Path), nil
+	case *Rmdir:
+		return d.path(c.Path), nil
+	case *SetXattr:
+		return d.path(c.Path), []field{{"name", c.Name}, {"data", c.Data}, {"len", uint64(len(c.Data))}}
+	case *RemoveXattr:
+		return d.path(c.Path), []field{{"name", c.Name}}
+	case *Write:
+		return d.path(c.Path), []field{{"offset", c.Offset}, {"len", uint64(len(c.Data))}}
+	case *Clone:
+		return d.path(c.Path), []field{
+			{"offset", c.Offset},
+			{"len", c.Len},
+			{"from", c.ClonePath},
+			{"clone_offset", c.CloneOffset},
+			{"clone_uuid", c.CloneUUID.String()},
+		}
+	case *Truncate:
+		return d.path(c.Path), []field{{"size", c.Size}}
+	case *Chmod:
+		return d.path(c.Path), []field{{"mode", dumpMode(c.Mode)}}
+	case *Chown:
+		return d.path(c.Path), []field{{"gid", c.GID}, {"uid", c.UID}}
+	case *Utimes:
+		return d.path(c.Path), []field{
+			{"atime", dumpTime(c.Atime)},
+			{"mtime", dumpTime(c.Mtime)},
+			{"ctime", dumpTime(c.Ctime)},
+		}
+	case *UpdateExtent:
+		return d.path(c.Path), []field{{"offset", c.Offset}, {"len", c.Size}}
+	case *Fallocate:
+		return d.path(c.Path), []field{{"mode", uint64(c.Mode)}, {"offset", c.Offset}, {"len", c.Size}}
+	case *Fileattr:
+		return d.path(c.Path), []field{{"fileattr", fmt.Sprintf("0x%x", c.Fileattr)}}
+	case *EncodedWrite:
+		return d.path(c.Path), []field{
+			{"offset", c.Offset},
+			{"len", c.UnencodedFileLen},
+			{"unencoded_len", c.UnencodedLen},
+			{"unencoded_offset", c.UnencodedOffset},
+			{"compression", uint64(c.Compression)},
+			{"encryption", uint64(c.Encryption)},
+			{"encoded_len", uint64(len(c.Data))},
+		}
+	case *EnableVerity:
+		return d.path(c.Path), []field{
+			{"algorithm", uint64(c.Algorithm)},
+			{"block_size", uint64(c.BlockSize)},
+			{"salt_len", uint64(len(c.Salt))},
+			{"sig_len", uint64(len(c.Signature))},
+		}
+	case *Unknown:
+		return "", []field{{"attrs", uint64(len(c.Attrs))}}
+	}
+	return "", nil
+}
+
+// escape makes paths and values printable on one line: spaces and backslashes are escaped
+// with a backslash, other special characters as octal
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Dump reads the send stream and writes one line per command with its path and attributes
+// like `btrfs receive --dump` does. The end commands are not printed.
+func Dump(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+	err := dump(r, func(cmd Command, p string, fields []field) error {
+		var line strings.Builder
+		fmt.Fprintf(&line, "%-16s%-32s", cmd.Cmd(), escape(p))
+		for i, f := range fields {
+			if i > 0 {
+				line.WriteByte(' ')
+			}
+			switch v := f.value.(type) {
+			case string:
+				fmt.Fprintf(&line, "%s=%s", f.key, escape(v))
+			case []byte:
+				fmt.Fprintf(&line, "%s=%s", f.key, escape(string(v)))
+			default:
+				fmt.Fprintf(&line, "%s=%v", f.key, v)
+			}
+		}
+		_, err := fmt.Fprintln(bw, strings.TrimRight(line.String(), " "))
+		return err
+	})
+	if flushErr := bw.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// DumpJSON reads the send stream and writes one JSON object per line and command, the object
+// has the "command" and "path" keys plus the attributes of the text dump. Raw values like
+// the xattr data are base64 encoded. Paths and names which aren't valid UTF-8 are base64 encoded
+// as well and the key gets the suffix "_base64", e.g. "path_base64".
+func DumpJSON(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := dump(r, func(cmd Command, p string, fields []field) error {
+		obj := map[string]interface{}{"command": cmd.Cmd().String()}
+		if len(p) > 0 {
+			setJSON(obj, "path", p)
+		}
+		for _, f := range fields {
+			setJSON(obj, f.key, f.value)
+		}
+		return enc.Encode(obj)
+	})
+	if flushErr := bw.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// setJSON sets the value of the key, strings which aren't valid UTF-8 would be replaced
+// by U+FFFD in JSON and are stored as bytes under the key with the suffix "_base64"
+func setJSON(obj map[string]interface{}, key string, value interface{}) {
+	if s, ok := value.(string); ok && !utf8.ValidString(s) {
+		obj[key+"_base64"] = []byte(s)
+		return
+	}
+	obj[key] = value
+}
+
+func dump(r io.Reader, print func(cmd Command, p string, fields []field) error) error {
+	d := NewDecoder(r)
+	var dumper dumper
+	for {
+		cmd, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if cmd.Cmd() == CmdEnd {
+			continue
+		}
+
+		p, fields := dumper.fields(cmd)
+		if err := print(cmd, p, fields); err != nil {
+			return err
+		}
+	}
+}
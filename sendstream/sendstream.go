@@ -0,0 +1,188 @@
+// Package sendstream decodes the btrfs send stream format without the kernel.
+//
+// A stream starts with the "btrfs-stream" magic and the protocol version followed
+// by commands. Every command has a header with its length, type and crc32c and
+// carries TLV attributes. See fs/btrfs/send.h in the kernel for the format.
+package sendstream
+
+import "fmt"
+
+// Magic starts every send stream
+const Magic = "btrfs-stream\x00"
+
+// MaxVersion is the highest supported protocol version
+const MaxVersion = 3
+
+// sizes of the stream, command and attribute headers
+const (
+	streamHeaderSize = len(Magic) + 4
+	cmdHeaderSize    = 4 + 2 + 4
+	tlvHeaderSize    = 2 + 2
+)
+
+// maxCmdSize limits the memory used by a corrupted length
+const maxCmdSize = 16 << 20
+
+type Cmd uint16
+
+const (
+	CmdUnspec Cmd = iota
+	CmdSubvol
+	CmdSnapshot
+	CmdMkfile
+	CmdMkdir
+	CmdMknod
+	CmdMkfifo
+	CmdMksock
+	CmdSymlink
+	CmdRename
+	CmdLink
+	CmdUnlink
+	CmdRmdir
+	CmdSetXattr
+	CmdRemoveXattr
+	CmdWrite
+	CmdClone
+	CmdTruncate
+	CmdChmod
+	CmdChown
+	CmdUtimes
+	CmdEnd
+	CmdUpdateExtent
+
+	// version 2
+	CmdFallocate
+	CmdFileattr
+	CmdEncodedWrite
+
+	// version 3
+	CmdEnableVerity
+)
+
+var cmdNames = map[Cmd]string{
+	CmdUnspec:       "unspec",
+	CmdSubvol:       "subvol",
+	CmdSnapshot:     "snapshot",
+	CmdMkfile:       "mkfile",
+	CmdMkdir:        "mkdir",
+	CmdMknod:        "mknod",
+	CmdMkfifo:       "mkfifo",
+	CmdMksock:       "mksock",
+	CmdSymlink:      "symlink",
+	CmdRename:       "rename",
+	CmdLink:         "link",
+	CmdUnlink:       "unlink",
+	CmdRmdir:        "rmdir",
+	CmdSetXattr:     "set_xattr",
+	CmdRemoveXattr:  "remove_xattr",
+	CmdWrite:        "write",
+	CmdClone:        "clone",
+	CmdTruncate:     "truncate",
+	CmdChmod:        "chmod",
+	CmdChown:        "chown",
+	CmdUtimes:       "utimes",
+	CmdEnd:          "end",
+	CmdUpdateExtent: "update_extent",
+	CmdFallocate:    "fallocate",
+	CmdFileattr:     "fileattr",
+	CmdEncodedWrite: "encoded_write",
+	CmdEnableVerity: "enable_verity",
+}
+
+func (c Cmd) String() string {
+	if name, ok := cmdNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("cmd_%d", uint16(c))
+}
+
+type Attr uint16
+
+const (
+	AttrUnspec Attr = iota
+	AttrUUID
+	AttrCTransid
+	AttrIno
+	AttrSize
+	AttrMode
+	AttrUID
+	AttrGID
+	AttrRdev
+	AttrCtime
+	AttrMtime
+	AttrAtime
+	AttrOtime
+	AttrXattrName
+	AttrXattrData
+	AttrPath
+	AttrPathTo
+	AttrPathLink
+	AttrFileOffset
+	AttrData
+	AttrCloneUUID
+	AttrCloneCTransid
+	AttrClonePath
+	AttrCloneOffset
+	AttrCloneLen
+
+	// version 2
+	AttrFallocateMode
+	AttrFileattr
+	AttrUnencodedFileLen
+	AttrUnencodedLen
+	AttrUnencodedOffset
+	AttrCompression
+	AttrEncryption
+
+	// version 3
+	AttrVerityAlgorithm
+	AttrVerityBlockSize
+	AttrVeritySaltData
+	AttrVeritySigData
+)
+
+var attrNames = map[Attr]string{
+	AttrUnspec:           "unspec",
+	AttrUUID:             "uuid",
+	AttrCTransid:         "ctransid",
+	AttrIno:              "ino",
+	AttrSize:             "size",
+	AttrMode:             "mode",
+	AttrUID:              "uid",
+	AttrGID:              "gid",
+	AttrRdev:             "rdev",
+	AttrCtime:            "ctime",
+	AttrMtime:            "mtime",
+	AttrAtime:            "atime",
+	AttrOtime:            "otime",
+	AttrXattrName:        "xattr_name",
+	AttrXattrData:        "xattr_data",
+	AttrPath:             "path",
+	AttrPathTo:           "path_to",
+	AttrPathLink:         "path_link",
+	AttrFileOffset:       "file_offset",
+	AttrData:             "data",
+	AttrCloneUUID:        "clone_uuid",
+	AttrCloneCTransid:    "clone_ctransid",
+	AttrClonePath:        "clone_path",
+	AttrCloneOffset:      "clone_offset",
+	AttrCloneLen:         "clone_len",
+	AttrFallocateMode:    "fallocate_mode",
+	AttrFileattr:         "fileattr",
+	AttrUnencodedFileLen: "unencoded_file_len",
+	AttrUnencodedLen:     "unencoded_len",
+	AttrUnencodedOffset:  "unencoded_offset",
+	AttrCompression:      "compression",
+	AttrEncryption:       "encryption",
+	AttrVerityAlgorithm:  "verity_algorithm",
+	AttrVerityBlockSize:  "verity_block_size",
+	AttrVeritySaltData:   "verity_salt_data",
+	AttrVeritySigData:    "verity_sig_data",
+}
+
+func (a Attr) String() string {
+	if name, ok := attrNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("attr_%d", uint16(a))
+}
@@ -0,0 +1,313 @@
+package sendstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// encoder builds send streams the same way the kernel does
+type encoder struct {
+	buf     bytes.Buffer
+	version uint32
+}
+
+func newEncoder(version uint32) *encoder {
+	e := &encoder{version: version}
+	e.header()
+	return e
+}
+
+func (e *encoder) header() {
+	e.buf.WriteString(Magic)
+	binary.Write(&e.buf, binary.LittleEndian, e.version)
+}
+
+type tlv struct {
+	typ   Attr
+	value []byte
+}
+
+func str(typ Attr, value string) tlv {
+	return tlv{typ, []byte(value)}
+}
+
+func u32(typ Attr, value uint32) tlv {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, value)
+	return tlv{typ, b}
+}
+
+func u64(typ Attr, value uint64) tlv {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, value)
+	return tlv{typ, b}
+}
+
+func timespec(typ Attr, sec uint64, nsec uint32) tlv {
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint64(b, sec)
+	binary.LittleEndian.PutUint32(b[8:], nsec)
+	return tlv{typ, b}
+}
+
+func (e *encoder) command(cmd Cmd, attrs ...tlv) []byte {
+	var payload bytes.Buffer
+	for _, a := range attrs {
+		binary.Write(&payload, binary.LittleEndian, uint16(a.typ))
+		if e.version < 2 || a.typ != AttrData {
+			binary.Write(&payload, binary.LittleEndian, uint16(len(a.value)))
+		}
+		payload.Write(a.value)
+	}
+
+	hdr := make([]byte, cmdHeaderSize)
+	binary.LittleEndian.PutUint32(hdr[0:4], uint32(payload.Len()))
+	binary.LittleEndian.PutUint16(hdr[4:6], uint16(cmd))
+	binary.LittleEndian.PutUint32(hdr[6:10], crc32c(hdr, payload.Bytes()))
+
+	start := e.buf.Len()
+	e.buf.Write(hdr)
+	e.buf.Write(payload.Bytes())
+	return e.buf.Bytes()[start:]
+}
+
+func testUUID(seed byte) uuid.UUID {
+	return uuid.FromBytesOrNil(bytes.Repeat([]byte{seed}, uuid.Size))
+}
+
+func decodeAll(t *testing.T, data []byte) []Command {
+	d := NewDecoder(bytes.NewReader(data))
+	var cmds []Command
+	for {
+		c, err := d.Next()
+		if err == io.EOF {
+			return cmds
+		}
+		if !assert.NoError(t, err) {
+			return cmds
+		}
+		cmds = append(cmds, c)
+	}
+}
+
+func TestCrc32c(t *testing.T) {
+	// crc32c as used by the kernel, seeded with zero and without the final inversion
+	assert.Equal(t, uint32(0), crc32c(nil))
+	assert.Equal(t, uint32(0x58e3fa20), crc32c([]byte("123456789")))
+	assert.Equal(t, crc32c([]byte("123456789")), crc32c([]byte("1234"), []byte("56789")))
+}
+
+func TestDecodeFull(t *testing.T) {
+	id := testUUID(1)
+	e := newEncoder(1)
+	e.command(CmdSubvol, str(AttrPath, "snap"), tlv{AttrUUID, id.Bytes()}, u64(AttrCTransid, 7))
+	e.command(CmdMkdir, str(AttrPath, "o257-7-0"), u64(AttrIno, 257))
+	e.command(CmdRename, str(AttrPath, "o257-7-0"), str(AttrPathTo, "dir"))
+	e.command(CmdMkfile, str(AttrPath, "o258-7-0"), u64(AttrIno, 258))
+	e.command(CmdWrite, str(AttrPath, "dir/file"), u64(AttrFileOffset, 4096), tlv{AttrData, []byte("hello")})
+	e.command(CmdSetXattr, str(AttrPath, "dir/file"), str(AttrXattrName, "user.a"), tlv{AttrXattrData, []byte("b")})
+	e.command(CmdChown, str(AttrPath, "dir/file"), u64(AttrUID, 1000), u64(AttrGID, 100))
+	e.command(CmdChmod, str(AttrPath, "dir/file"), u64(AttrMode, 0644))
+	e.command(CmdUtimes, str(AttrPath, "dir/file"),
+		timespec(AttrAtime, 1, 2), timespec(AttrMtime, 3, 4), timespec(AttrCtime, 5, 6))
+	e.command(CmdEnd)
+
+	cmds := decodeAll(t, e.buf.Bytes())
+	assert.Len(t, cmds, 10)
+	assert.Equal(t, &Subvol{Path: "snap", UUID: id, CTransid: 7}, cmds[0])
+	assert.Equal(t, &Mkdir{Path: "o257-7-0", Ino: 257}, cmds[1])
+	assert.Equal(t, &Rename{Path: "o257-7-0", PathTo: "dir"}, cmds[2])
+	assert.Equal(t, &Mkfile{Path: "o258-7-0", Ino: 258}, cmds[3])
+	assert.Equal(t, &Write{Path: "dir/file", Offset: 4096, Data: []byte("hello")}, cmds[4])
+	assert.Equal(t, &SetXattr{Path: "dir/file", Name: "user.a", Data: []byte("b")}, cmds[5])
+	assert.Equal(t, &Chown{Path: "dir/file", UID: 1000, GID: 100}, cmds[6])
+	assert.Equal(t, &Chmod{Path: "dir/file", Mode: 0644}, cmds[7])
+	assert.Equal(t, &Utimes{Path: "dir/file", Atime: time.Unix(1, 2), Mtime: time.Unix(3, 4), Ctime: time.Unix(5, 6)}, cmds[8])
+	assert.Equal(t, CmdEnd, cmds[9].Cmd())
+}
+
+func TestDecodeIncremental(t *testing.T) {
+	id, parent := testUUID(2), testUUID(1)
+	e := newEncoder(1)
+	e.command(CmdSnapshot, str(AttrPath, "snap2"), tlv{AttrUUID, id.Bytes()}, u64(AttrCTransid, 9),
+		tlv{AttrCloneUUID, parent.Bytes()}, u64(AttrCloneCTransid, 7))
+	e.command(CmdClone, str(AttrPath, "b"), u64(AttrFileOffset, 0), u64(AttrCloneLen, 8192),
+		tlv{AttrCloneUUID, parent.Bytes()}, u64(AttrCloneCTransid, 7), str(AttrClonePath, "a"), u64(AttrCloneOffset, 4096))
+	e.command(CmdUnlink, str(AttrPath, "c"))
+	e.command(CmdTruncate, str(AttrPath, "b"), u64(AttrSize, 10))
+	e.command(CmdUpdateExtent, str(AttrPath, "b"), u64(AttrFileOffset, 0), u64(AttrSize, 10))
+	e.command(CmdEnd)
+
+	cmds := decodeAll(t, e.buf.Bytes())
+	assert.Len(t, cmds, 6)
+	assert.Equal(t, &Snapshot{Path: "snap2", UUID: id, CTransid: 9, CloneUUID: parent, CloneCTransid: 7}, cmds[0])
+	assert.Equal(t, &Clone{Path: "b", Len: 8192, CloneUUID: parent, CloneCTransid: 7, ClonePath: "a", CloneOffset: 4096}, cmds[1])
+	assert.Equal(t, &Unlink{Path: "c"}, cmds[2])
+	assert.Equal(t, &Truncate{Path: "b", Size: 10}, cmds[3])
+	assert.Equal(t, &UpdateExtent{Path: "b", Size: 10}, cmds[4])
+}
+
+func TestDecodeV2(t *testing.T) {
+	e := newEncoder(2)
+	e.command(CmdSubvol, str(AttrPath, "snap"), tlv{AttrUUID, make([]byte, 16)}, u64(AttrCTransid, 1))
+	// the data attribute has no length since version 2
+	e.command(CmdWrite, str(AttrPath, "file"), u64(AttrFileOffset, 0), tlv{AttrData, bytes.Repeat([]byte{'x'}, 70000)})
+	e.command(CmdEncodedWrite, str(AttrPath, "file"), u64(AttrFileOffset, 0), u64(AttrUnencodedFileLen, 131072),
+		u64(AttrUnencodedLen, 131072), u64(AttrUnencodedOffset, 0), u32(AttrCompression, 3), u32(AttrEncryption, 0),
+		tlv{AttrData, []byte("zstd")})
+	e.command(CmdFallocate, str(AttrPath, "file"), u32(AttrFallocateMode, 1), u64(AttrFileOffset, 0), u64(AttrSize, 4096))
+	e.command(CmdFileattr, str(AttrPath, "file"), u64(AttrFileattr, 0x10))
+	e.command(CmdEnd)
+
+	d := NewDecoder(bytes.NewReader(e.buf.Bytes()))
+	var cmds []Command
+	for {
+		c, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		cmds = append(cmds, c)
+	}
+	assert.Equal(t, uint32(2), d.Version())
+	assert.Len(t, cmds, 6)
+	assert.Len(t, cmds[1].(*Write).Data, 70000)
+	assert.Equal(t, &EncodedWrite{Path: "file", UnencodedFileLen: 131072, UnencodedLen: 131072, Compression: 3,
+		Data: []byte("zstd")}, cmds[2])
+	assert.Equal(t, &Fallocate{Path: "file", Mode: 1, Size: 4096}, cmds[3])
+	assert.Equal(t, &Fileattr{Path: "file", Fileattr: 0x10}, cmds[4])
+}
+
+func TestDecodeConcatenated(t *testing.T) {
+	e := newEncoder(1)
+	e.command(CmdSubvol, str(AttrPath, "a"), tlv{AttrUUID, make([]byte, 16)}, u64(AttrCTransid, 1))
+	e.command(CmdEnd)
+	e.header()
+	e.command(CmdSubvol, str(AttrPath, "b"), tlv{AttrUUID, make([]byte, 16)}, u64(AttrCTransid, 1))
+	e.command(CmdEnd)
+
+	cmds := decodeAll(t, e.buf.Bytes())
+	assert.Len(t, cmds, 4)
+	assert.Equal(t, "a", cmds[0].(*Subvol).Path)
+	assert.Equal(t, "b", cmds[2].(*Subvol).Path)
+}
+
+func TestDecodeUnknown(t *testing.T) {
+	e := newEncoder(1)
+	e.command(Cmd(100), str(AttrPath, "x"))
+
+	cmds := decodeAll(t, e.buf.Bytes())
+	assert.Equal(t, []Command{&Unknown{Type: Cmd(100), Attrs: map[Attr][]byte{AttrPath: []byte("x")}}}, cmds)
+	assert.Equal(t, "cmd_100", Cmd(100).String())
+	assert.Equal(t, "encoded_write", CmdEncodedWrite.String())
+	assert.Equal(t, "clone_uuid", AttrCloneUUID.String())
+}
+
+func TestDecodeErrors(t *testing.T) {
+	next := func(data []byte) error {
+		d := NewDecoder(bytes.NewReader(data))
+		var err error
+		for err == nil {
+			_, err = d.Next()
+		}
+		return err
+	}
+
+	assert.EqualError(t, next(nil), "send stream is empty")
+	assert.EqualError(t, next([]byte("btrfs-stream")), "failed to read the stream header: unexpected EOF")
+	assert.EqualError(t, next([]byte("btrfs-strean\x00\x01\x00\x00\x00")), "invalid send stream magic")
+	assert.EqualError(t, next(newEncoder(4).buf.Bytes()), "unsupported send stream version 4")
+
+	e := newEncoder(1)
+	cmd := e.command(CmdUnlink, str(AttrPath, "file"))
+	cmd[len(cmd)-1] = 'x'
+	assert.Contains(t, next(e.buf.Bytes()).Error(), "unlink: checksum mismatch")
+
+	e = newEncoder(1)
+	e.command(CmdUnlink, str(AttrPath, "file"))
+	assert.EqualError(t, next(e.buf.Bytes()[:e.buf.Len()-2]), "unlink: failed to read the command: unexpected EOF")
+
+	e = newEncoder(1)
+	e.command(CmdUnlink)
+	assert.EqualError(t, next(e.buf.Bytes()), "unlink: missing attribute path")
+
+	e = newEncoder(1)
+	e.command(CmdTruncate, str(AttrPath, "file"), u32(AttrSize, 1))
+	assert.EqualError(t, next(e.buf.Bytes()), "truncate: attribute size has size 4, expected 8")
+
+	e = newEncoder(1)
+	e.command(CmdUnlink, str(AttrPath, "file"))
+	e.buf.Write([]byte{0xff, 0xff, 0xff, 0xff, 0x0b, 0x00, 0, 0, 0, 0})
+	assert.EqualError(t, next(e.buf.Bytes()), "unlink: command size 4294967295 is too large")
+}
+
+func dumpStream() []byte {
+	e := newEncoder(1)
+	e.command(CmdSubvol, str(AttrPath, "snap"), tlv{AttrUUID, testUUID(1).Bytes()}, u64(AttrCTransid, 7))
+	e.command(CmdMkfile, str(AttrPath, "o257-7-0"), u64(AttrIno, 257))
+	e.command(CmdRename, str(AttrPath, "o257-7-0"), str(AttrPathTo, "my file"))
+	e.command(CmdWrite, str(AttrPath, "my file"), u64(AttrFileOffset, 0), tlv{AttrData, []byte("hello")})
+	e.command(CmdChmod, str(AttrPath, "my file"), u64(AttrMode, 0644))
+	e.command(CmdSetXattr, str(AttrPath, "my file"), str(AttrXattrName, "user.bin"), tlv{AttrXattrData, []byte{0, 0xff, 'a'}})
+	e.command(CmdRename, str(AttrPath, "my file"), str(AttrPathTo, "latin1 \xe9"))
+	e.command(CmdUtimes, str(AttrPath, "my file"),
+		timespec(AttrAtime, 0, 0), timespec(AttrMtime, 60, 0), timespec(AttrCtime, 3600, 0))
+	e.command(CmdEnd)
+	return e.buf.Bytes()
+}
+
+func TestDump(t *testing.T) {
+	var out bytes.Buffer
+	err := Dump(&out, bytes.NewReader(dumpStream()))
+	assert.NoError(t, err)
+
+	expected := "" +
+		"subvol          ./snap                          uuid=" + testUUID(1).String() + " transid=7\n" +
+		"mkfile          ./snap/o257-7-0\n" +
+		"rename          ./snap/o257-7-0                 dest=./snap/my\\ file\n" +
+		"write           ./snap/my\\ file                 offset=0 len=5\n" +
+		"chmod           ./snap/my\\ file                 mode=644\n" +
+		"set_xattr       ./snap/my\\ file                 name=user.bin data=\\000\\377a len=3\n" +
+		"rename          ./snap/my\\ file                 dest=./snap/latin1\\ \\351\n" +
+		"utimes          ./snap/my\\ file                 " +
+		"atime=1970-01-01T00:00:00+0000 mtime=1970-01-01T00:01:00+0000 ctime=1970-01-01T01:00:00+0000\n"
+	assert.Equal(t, expected, out.String())
+
+	err = Dump(&out, bytes.NewReader([]byte("garbage")))
+	assert.Error(t, err)
+}
+
+func TestDumpJSON(t *testing.T) {
+	var out bytes.Buffer
+	err := DumpJSON(&out, bytes.NewReader(dumpStream()))
+	assert.NoError(t, err)
+
+	var objs []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var obj map[string]interface{}
+		assert.NoError(t, dec.Decode(&obj))
+		objs = append(objs, obj)
+	}
+
+	assert.Len(t, objs, 8)
+	assert.Equal(t, map[string]interface{}{"command": "subvol", "path": "./snap", "uuid": testUUID(1).String(), "transid": float64(7)}, objs[0])
+	assert.Equal(t, map[string]interface{}{"command": "rename", "path": "./snap/o257-7-0", "dest": "./snap/my file"}, objs[2])
+	assert.Equal(t, map[string]interface{}{"command": "write", "path": "./snap/my file", "offset": float64(0), "len": float64(5)}, objs[3])
+	assert.Equal(t, map[string]interface{}{"command": "chmod", "path": "./snap/my file", "mode": "644"}, objs[4])
+	// the binary data is base64 encoded
+	assert.Equal(t, map[string]interface{}{"command": "set_xattr", "path": "./snap/my file", "name": "user.bin", "data": "AP9h", "len": float64(3)}, objs[5])
+	// the invalid UTF-8 name is kept as base64 instead of U+FFFD
+	assert.Equal(t, map[string]interface{}{"command": "rename", "path": "./snap/my file", "dest_base64": "Li9zbmFwL2xhdGluMSDp"}, objs[6])
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, `a\ b\\c\012d\377`, escape("a b\\c\nd\xff"))
+}
@@ -0,0 +1,99 @@
+package subvolume
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/ioctl"
+)
+
+type subvolDiff struct {
+	from string
+	to   string
+
+	executor func(c *subvolDiff) ([]btrfs.SubvolChange, error)
+}
+
+func (c *subvolDiff) From(path string) btrfs.SubvolDiff {
+	c.from = path
+	return c
+}
+
+func (c *subvolDiff) To(path string) btrfs.SubvolDiff {
+	c.to = path
+	return c
+}
+
+func (c *subvolDiff) context() string {
+	return fmt.Sprintf("from='%s', to='%s'", c.from, c.to)
+}
+
+func (c *subvolDiff) error(err error) *btrfs.BtrfsError {
+	return &btrfs.BtrfsError{Func: string(btrfs.CmdSubvolDiff), Context: c.context(), Err: err}
+}
+
+func (c *subvolDiff) validate() error {
+	if len(c.from) == 0 {
+		return errors.New("old snapshot is empty")
+	}
+	if len(c.to) == 0 {
+		return errors.New("new snapshot is empty")
+	}
+	return nil
+}
+
+func (c *subvolDiff) Execute() ([]btrfs.SubvolChange, error) {
+	changes, err := c.executor(c)
+	if err != nil {
+		return nil, c.error(err)
+	}
+	return changes, nil
+}
+
+var changeKinds = map[ioctl.DiffKind]btrfs.ChangeKind{
+	ioctl.DiffAdded:    btrfs.ChangeAdded,
+	ioctl.DiffModified: btrfs.ChangeModified,
+	ioctl.DiffDeleted:  btrfs.ChangeDeleted,
+	ioctl.DiffRenamed:  btrfs.ChangeRenamed,
+}
+
+// btrfs ioctl executor
+func ioctlDiffExecute(c *subvolDiff) ([]btrfs.SubvolChange, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	entries, err := ioctl.SubvolDiff(c.from, c.to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []btrfs.SubvolChange
+	for _, e := range entries {
+		changes = append(changes, btrfs.SubvolChange{
+			Kind:    changeKinds[e.Kind],
+			Path:    e.Path,
+			OldPath: e.OldPath,
+			IsDir:   e.IsDir,
+		})
+	}
+	return changes, nil
+}
+
+// btrfs cli executor
+func cliDiffExecute(c *subvolDiff) ([]btrfs.SubvolChange, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("Unimplemented")
+}
+
+// commands
+func ioctlDiff() interface{} {
+	return &subvolDiff{executor: ioctlDiffExecute}
+}
+
+func cliDiff() interface{} {
+	return &subvolDiff{executor: cliDiffExecute}
+}
@@ -43,7 +43,7 @@ func ioctlFindNewExecute(c *subvolFindNew) error {
 		return fmt.Errorf("Subvolume is required")
 	}
 
-	_ /*genId*/, err := ioctl.SubvolFindNew(c.dest, c.lastGen)
+	_ /*genId*/, _ /*inodes*/, err := ioctl.SubvolFindNew(c.dest, c.lastGen)
 	if err != nil {
 		return err
 	}
@@ -3,10 +3,11 @@ package subvolume
 import (
 	"errors"
 	"fmt"
-	"path/filepath"
+	"time"
 
 	"github.com/plar/btrfs"
 	"github.com/plar/btrfs/ioctl"
+	"github.com/satori/go.uuid"
 )
 
 type subvolList struct {
@@ -50,15 +51,30 @@ func ioctlListExecute(c *subvolList) ([]btrfs.SubvolInfo, error) {
 		return nil, fmt.Errorf("Subvolume is required")
 	}
 
-	path := filepath.Dir(c.dest)
-	// name := filepath.Base(c.dest)
-
-	err := ioctl.SubvolList(path, 0)
+	results, err := ioctl.SubvolList(c.dest)
 	if err != nil {
 		return nil, err
 	}
 
-	return nil, nil
+	var subvols []btrfs.SubvolInfo
+	for _, r := range results {
+		parentUUID := uuid.FromBytesOrNil(r.ParentUUID)
+		subvols = append(subvols, btrfs.SubvolInfo{
+			Path:             r.Path,
+			ParentID:         r.Parent,
+			ID:               r.Id,
+			OriginGeneration: r.CGen,
+			Generation:       r.Gen,
+			OriginTime:       time.Unix(int64(r.OTime.Sec), int64(r.OTime.NSec)),
+			ParentUUID:       parentUUID,
+			UUID:             uuid.FromBytesOrNil(r.UUID),
+			ReceivedUUID:     uuid.FromBytesOrNil(r.ReceivedUUID),
+			IsSnapshot:       parentUUID != uuid.Nil,
+			IsReadOnly:       r.IsReadOnly(),
+		})
+	}
+
+	return subvols, nil
 }
 
 // btrfs cli executor
@@ -8,6 +8,8 @@ func init() {
 	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdSubvolFindNew, ioctlFindNew)
 	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdSubvolDelete, ioctlDelete)
 	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdSubvolList, ioctlList)
+	btrfs.RegisterAPI(btrfs.IOCTL, btrfs.CmdSubvolDiff, ioctlDiff)
 
 	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdSubvolCreate, cliCreate)
+	btrfs.RegisterAPI(btrfs.CLI, btrfs.CmdSubvolDiff, cliDiff)
 }
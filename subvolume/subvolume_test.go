@@ -2,20 +2,23 @@ package subvolume
 
 import (
 	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
-	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/plar/btrfs"
+	"github.com/plar/btrfs/internal/btrfstest"
+	"github.com/plar/btrfs/ioctl"
+	btrfsmount "github.com/plar/btrfs/mount"
 
 	"github.com/stretchr/testify/assert"
 )
 
-var rootDir, mount string
+var loop *btrfstest.Loopback
+var mount string
 
 func TestSubVolumeCreateValidation(t *testing.T) {
 	subvol := btrfs.NewIoctl().Subvolume()
@@ -97,6 +100,17 @@ func TestSubVolumeFindNew(t *testing.T) {
 	commit0 := filepath.Join(repo, "commit0")
 	err = subvol.Snapshot().Source(master).Destination(commit0).Execute()
 	assert.NoError(t, err)
+
+	gen, _, err := ioctl.SubvolFindNew(master, 0)
+	assert.NoError(t, err)
+	file := filepath.Join(master, "file")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("new"), 0600))
+	fi, err := os.Stat(file)
+	assert.NoError(t, err)
+
+	_, inodes, err := ioctl.SubvolFindNew(master, gen+1)
+	assert.NoError(t, err)
+	assert.Contains(t, inodes, fi.Sys().(*syscall.Stat_t).Ino)
 }
 
 func TestSubVolumeDelete(t *testing.T) {
@@ -118,60 +132,168 @@ func TestSubVolumeDelete(t *testing.T) {
 func TestSubVolumeList(t *testing.T) {
 	subvol := btrfs.NewIoctl().Subvolume()
 
-	_, err := subvol.List().Path("/mnt/btrfs-sandbox/").Execute()
+	err := subvol.Create().Destination(filepath.Join(mount, "list")).Execute()
+	assert.NoError(t, err)
+	err = os.Mkdir(filepath.Join(mount, "list/dir"), 0700)
+	assert.NoError(t, err)
+	err = subvol.Create().Destination(filepath.Join(mount, "list/dir/nested")).Execute()
+	assert.NoError(t, err)
+	err = subvol.Snapshot().ReadOnly().Source(filepath.Join(mount, "list")).Destination(filepath.Join(mount, "list-snap")).Execute()
+	assert.NoError(t, err)
+
+	subvols, err := subvol.List().Path(mount).Execute()
 	assert.NoError(t, err)
-}
 
-func run(cmd string, args ...string) error {
-	log.Printf("Run %s %s", cmd, args)
-	_, err := exec.Command(cmd, args...).CombinedOutput()
-	if err != nil {
-		return err
+	byPath := map[string]btrfs.SubvolInfo{}
+	for _, s := range subvols {
+		byPath[s.Path] = s
 	}
-	return nil
-}
 
-func setup() {
-	var err error
+	list, ok := byPath["list"]
+	if assert.True(t, ok) {
+		assert.Equal(t, uint64(5), list.ParentID)
+		assert.False(t, list.IsSnapshot)
+		assert.False(t, list.IsReadOnly)
+		assert.WithinDuration(t, time.Now(), list.OriginTime, time.Minute)
+	}
 
-	rootDir, err = ioutil.TempDir("/var/tmp", "btrfs-test-")
-	if err != nil {
-		log.Fatalf("Cannot create tmp directory, err=%s", err)
+	nested, ok := byPath["list/dir/nested"]
+	if assert.True(t, ok) {
+		assert.Equal(t, list.ID, nested.ParentID)
 	}
 
-	mount = path.Join(rootDir, "btrfs")
-	if err := os.MkdirAll(mount, 0700); err != nil {
-		log.Fatalf("ERROR: MkdirAll %s, err=%s", mount, err)
+	snap, ok := byPath["list-snap"]
+	if assert.True(t, ok) {
+		assert.True(t, snap.IsSnapshot)
+		assert.True(t, snap.IsReadOnly)
+		assert.Equal(t, list.UUID, snap.ParentUUID)
 	}
+}
 
-	imageFileName := filepath.Join(rootDir, "btrfs.img")
-	ioutil.WriteFile(imageFileName, []byte("datadatadata"), 0700)
-	os.Truncate(imageFileName, 1024*1024*1024) // 1GB
+func TestSubVolumeDiffValidation(t *testing.T) {
+	subvol := btrfs.NewIoctl().Subvolume()
+	_, err := subvol.Diff().To(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "old snapshot is empty")
 
-	if err := run("mkfs.btrfs", imageFileName); err != nil {
-		log.Fatalf("ERROR: mkfs.btrfs %s, err=%s", imageFileName, err)
-	}
+	_, err = subvol.Diff().From(mount).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "new snapshot is empty")
+}
+
+func TestSubVolumeDiff(t *testing.T) {
+	subvol := btrfs.NewIoctl().Subvolume()
+
+	src := filepath.Join(mount, "diff")
+	err := subvol.Create().Destination(src).Execute()
+	assert.NoError(t, err)
 
-	if err := run("mount", imageFileName, mount); err != nil {
-		log.Fatalf("ERROR: mount %s %s, err=%s", imageFileName, mount, err)
+	for _, name := range []string{"keep", "change", "remove", "move", "olddir/file"} {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0700)
+		assert.NoError(t, err)
+		err = ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0600)
+		assert.NoError(t, err)
 	}
+
+	v1 := filepath.Join(mount, "diff-v1")
+	err = subvol.Snapshot().ReadOnly().Source(src).Destination(v1).Execute()
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(src, "change"), []byte("changed"), 0600)
+	assert.NoError(t, err)
+	err = os.Remove(filepath.Join(src, "remove"))
+	assert.NoError(t, err)
+	err = os.Rename(filepath.Join(src, "move"), filepath.Join(src, "moved"))
+	assert.NoError(t, err)
+	err = os.RemoveAll(filepath.Join(src, "olddir"))
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(src, "newdir"), 0700)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(src, "newdir/file"), []byte("new"), 0600)
+	assert.NoError(t, err)
+
+	v2 := filepath.Join(mount, "diff-v2")
+	err = subvol.Snapshot().ReadOnly().Source(src).Destination(v2).Execute()
+	assert.NoError(t, err)
+
+	changes, err := subvol.Diff().From(v1).To(v2).Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, []btrfs.SubvolChange{
+		{Kind: btrfs.ChangeModified, Path: "change"},
+		{Kind: btrfs.ChangeRenamed, Path: "moved", OldPath: "move"},
+		{Kind: btrfs.ChangeAdded, Path: "newdir", IsDir: true},
+		{Kind: btrfs.ChangeAdded, Path: "newdir/file"},
+		{Kind: btrfs.ChangeDeleted, Path: "olddir", IsDir: true},
+		{Kind: btrfs.ChangeDeleted, Path: "olddir/file"},
+		{Kind: btrfs.ChangeDeleted, Path: "remove"},
+	}, changes)
+
+	// the live subvolume is compared to its snapshot too
+	changes, err = subvol.Diff().From(v2).To(src).Execute()
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = subvol.Diff().From(v2).To(v1).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is newer than")
+
+	_, err = subvol.Diff().From(src).To(v2).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a read only snapshot")
+
+	other := filepath.Join(mount, "diff-other")
+	err = subvol.Create().Destination(other).Execute()
+	assert.NoError(t, err)
+	_, err = subvol.Diff().From(v1).To(other).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "are not snapshots of the same subvolume")
 }
 
-func teardown() {
-	if err := run("umount", mount); err != nil {
-		log.Fatal("ERROR: umount, err=%s", err)
-	}
+func TestSubVolumeMount(t *testing.T) {
+	subvol := btrfs.NewIoctl().Subvolume()
 
-	// just to make sure that we're going to delete our temp directory
-	if strings.HasPrefix(rootDir, "/var/tmp/btrfs-test-") {
-		os.RemoveAll(rootDir)
-	}
+	src := filepath.Join(mount, "mounted")
+	err := subvol.Create().Destination(src).Execute()
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(src, "file"), []byte("data"), 0600)
+	assert.NoError(t, err)
+
+	target := filepath.Join(loop.RootDir, "mounted")
+	assert.NoError(t, os.Mkdir(target, 0700))
+
+	// by path relative to the top level subvolume
+	err = btrfsmount.Mount(loop.Device, target, btrfsmount.Options{Subvol: "mounted", ReadOnly: true, NoAtime: true})
+	assert.NoError(t, err)
+	data, err := ioutil.ReadFile(filepath.Join(target, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	err = ioutil.WriteFile(filepath.Join(target, "new"), nil, 0600)
+	assert.Error(t, err)
+	assert.NoError(t, btrfsmount.Unmount(target))
 
+	// by id of the subvolume path
+	err = btrfsmount.MountSubvolume(src, target, btrfsmount.Options{Compress: "zstd"})
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(target, "file"))
+	assert.NoError(t, err)
+
+	// busy mounts are detached lazily
+	f, err := os.Open(filepath.Join(target, "file"))
+	assert.NoError(t, err)
+	assert.NoError(t, btrfsmount.LazyUnmount(target))
+	f.Close()
+	_, err = os.Stat(filepath.Join(target, "file"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = btrfsmount.Unmount(target)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a mount point")
 }
 
 func TestMain(m *testing.M) {
-	setup()
+	loop = btrfstest.Setup()
+	mount = loop.Mount
 	code := m.Run()
-	teardown()
+	loop.Teardown()
 	os.Exit(code)
 }
@@ -1,7 +1,10 @@
 package validators
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/plar/btrfs"
@@ -18,3 +21,106 @@ func ValidSubvolumeName(name string) error {
 
 	return nil
 }
+
+// compressionLevels are the highest levels of the algorithms, lzo has no levels
+var compressionLevels = map[string]uint64{"zlib": 9, "lzo": 0, "zstd": 15}
+
+// ParseCompression parses a compression the way the kernel accepts it: an algorithm with an optional
+// level, e.g. zstd:3, or "no" and "none" which disable the compression and return "none".
+// The level is 0 if it isn't given, the default level of the algorithm.
+func ParseCompression(value string) (string, uint64, error) {
+	algorithm, level, hasLevel := value, "", false
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		algorithm, level, hasLevel = value[:i], value[i+1:], true
+	}
+
+	if algorithm == "no" || algorithm == "none" {
+		if hasLevel {
+			return "", 0, fmt.Errorf("invalid compression '%s'", value)
+		}
+		return "none", 0, nil
+	}
+
+	max, ok := compressionLevels[algorithm]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown compression algorithm '%s', expected zlib, lzo, zstd or none", algorithm)
+	}
+	if !hasLevel {
+		return algorithm, 0, nil
+	}
+
+	n, err := strconv.ParseUint(level, 10, 64)
+	if err != nil || n < 1 || n > max {
+		return "", 0, fmt.Errorf("invalid compression level %s for '%s'", level, algorithm)
+	}
+	return algorithm, n, nil
+}
+
+// ValidCompression checks a compression value, see ParseCompression
+func ValidCompression(value string) error {
+	_, _, err := ParseCompression(value)
+	return err
+}
+
+// ParseSize parses a size in bytes with an optional K, M, G or T binary suffix, e.g. 512M
+func ParseSize(size string) (uint64, error) {
+	if len(size) == 0 {
+		return 0, errors.New("size is empty")
+	}
+
+	var mult uint64 = 1
+	switch strings.ToUpper(size[len(size)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	case "T":
+		mult = 1 << 40
+	}
+
+	num := size
+	if mult > 1 {
+		num = size[:len(size)-1]
+	}
+
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+
+	if n > math.MaxUint64/mult {
+		return 0, fmt.Errorf("size '%s' is too big", size)
+	}
+
+	return n * mult, nil
+}
+
+// qgroup ids keep the level in the upper 16 bits
+const qgroupLevelShift = 48
+
+// ParseQgroupID parses a qgroup id in the level/id form, e.g. 1/100, a plain number
+// is a level 0 qgroup of the subvolume with that id
+func ParseQgroupID(qgroupid string) (uint64, error) {
+	if len(qgroupid) == 0 {
+		return 0, errors.New("qgroup id is empty")
+	}
+
+	level, id := "0", qgroupid
+	if idx := strings.Index(qgroupid, "/"); idx >= 0 {
+		level, id = qgroupid[:idx], qgroupid[idx+1:]
+	}
+
+	l, err := strconv.ParseUint(level, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid qgroup id '%s', expected level/id", qgroupid)
+	}
+
+	n, err := strconv.ParseUint(id, 10, qgroupLevelShift)
+	if err != nil {
+		return 0, fmt.Errorf("invalid qgroup id '%s', expected level/id", qgroupid)
+	}
+
+	return l<<qgroupLevelShift | n, nil
+}
@@ -31,3 +31,90 @@ func TestValidSubvolumeName(t *testing.T) {
 	err = ValidSubvolumeName("subvol1")
 	assert.NoError(t, err)
 }
+
+func TestValidCompression(t *testing.T) {
+	for _, name := range []string{"zlib", "zlib:1", "zlib:9", "lzo", "zstd", "zstd:15", "no", "none"} {
+		assert.NoError(t, ValidCompression(name), name)
+	}
+	for _, name := range []string{"", "gzip", "zstd:", "zstd:high", "zstd:0", "zstd:16", "zlib:10", "lzo:1", "none:0"} {
+		assert.Error(t, ValidCompression(name), name)
+	}
+
+	err := ValidCompression("gzip")
+	assert.EqualError(t, err, "unknown compression algorithm 'gzip', expected zlib, lzo, zstd or none")
+
+	err = ValidCompression("zlib:10")
+	assert.EqualError(t, err, "invalid compression level 10 for 'zlib'")
+}
+
+func TestParseCompression(t *testing.T) {
+	algorithm, level, err := ParseCompression("zstd:3")
+	assert.NoError(t, err)
+	assert.Equal(t, "zstd", algorithm)
+	assert.Equal(t, uint64(3), level)
+
+	algorithm, level, err = ParseCompression("zlib")
+	assert.NoError(t, err)
+	assert.Equal(t, "zlib", algorithm)
+	assert.Equal(t, uint64(0), level)
+
+	algorithm, _, err = ParseCompression("no")
+	assert.NoError(t, err)
+	assert.Equal(t, "none", algorithm)
+}
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]uint64{
+		"0":    0,
+		"4096": 4096,
+		"1k":   1024,
+		"1K":   1024,
+		"512M": 512 * 1024 * 1024,
+		"2G":   2 * 1024 * 1024 * 1024,
+		"3t":   3 * 1024 * 1024 * 1024 * 1024,
+	}
+	for size, expected := range sizes {
+		n, err := ParseSize(size)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, n, size)
+	}
+
+	_, err := ParseSize("")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "size is empty")
+
+	for _, size := range []string{"G", "1X", "-1G", "+1G", "1.5G", "max"} {
+		_, err = ParseSize(size)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid size")
+	}
+
+	_, err = ParseSize("16777216T")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is too big")
+}
+
+func TestParseQgroupID(t *testing.T) {
+	ids := map[string]uint64{
+		"0/5":               5,
+		"256":               256,
+		"1/100":             1<<48 | 100,
+		"65535/0":           65535 << 48,
+		"2/281474976710655": 2<<48 | (1<<48 - 1),
+	}
+	for qgroupid, expected := range ids {
+		n, err := ParseQgroupID(qgroupid)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, n, qgroupid)
+	}
+
+	_, err := ParseQgroupID("")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "qgroup id is empty")
+
+	for _, qgroupid := range []string{"/", "1/", "/5", "a/5", "1/b", "65536/1", "0/281474976710656", "1/2/3", "-1"} {
+		_, err = ParseQgroupID(qgroupid)
+		assert.Error(t, err, qgroupid)
+		assert.Contains(t, err.Error(), "invalid qgroup id", qgroupid)
+	}
+}